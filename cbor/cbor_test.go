@@ -0,0 +1,184 @@
+package cbor_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/cbor"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ts := time.Date(2020, 3, 4, 5, 6, 7, 890123456, time.FixedZone(``, 3600))
+	for _, v := range []dgo.Value{
+		vf.Nil,
+		vf.True,
+		vf.False,
+		vf.Integer(0),
+		vf.Integer(23),
+		vf.Integer(-24),
+		vf.Integer(1000000),
+		vf.Integer(math.MaxInt64),
+		vf.Integer(math.MinInt64),
+		vf.Float(1.0),
+		vf.Float(-1.5e300),
+		vf.String(``),
+		vf.String(`ünicode`),
+		vf.Binary([]byte{0, 1, 2, 255}, true),
+		vf.Time(ts),
+		vf.Sensitive(`secret`),
+		vf.Values(1, `two`, 3.0, vf.Values()),
+		vf.Map(`a`, 1, 2, `b`, 3.5, vf.Sensitive(vf.Values(`x`))),
+	} {
+		bs, err := cbor.Marshal(v)
+		require.Nil(t, err)
+		r, err := cbor.Unmarshal(bs)
+		require.Nil(t, err)
+		require.Equal(t, v, r)
+		require.Equal(t, v.Type(), r.Type())
+	}
+	bs, err := cbor.Marshal(vf.Time(ts))
+	require.Nil(t, err)
+	r, err := cbor.Unmarshal(bs)
+	require.Nil(t, err)
+	require.True(t, ts.Equal(r.(dgo.Time).GoTime()))
+	_, offset := r.(dgo.Time).GoTime().Zone()
+	require.Equal(t, 3600, offset)
+}
+
+func TestEncoding(t *testing.T) {
+	// Examples from RFC 8949 Appendix A
+	for h, v := range map[string]dgo.Value{
+		`00`:                 vf.Integer(0),
+		`17`:                 vf.Integer(23),
+		`1818`:               vf.Integer(24),
+		`1903e8`:             vf.Integer(1000),
+		`1a000f4240`:         vf.Integer(1000000),
+		`1b000000e8d4a51000`: vf.Integer(1000000000000),
+		`20`:                 vf.Integer(-1),
+		`3903e7`:             vf.Integer(-1000),
+		`f4`:                 vf.False,
+		`f6`:                 vf.Nil,
+		`60`:                 vf.String(``),
+		`6449455446`:         vf.String(`IETF`),
+		`4401020304`:         vf.Binary([]byte{1, 2, 3, 4}, true),
+		`83010203`:           vf.Values(1, 2, 3),
+		`a201020304`:         vf.Map(1, 2, 3, 4),
+		`fb3ff199999999999a`: vf.Float(1.1),
+	} {
+		bs, err := cbor.Marshal(v)
+		require.Nil(t, err)
+		require.Equal(t, h, hex.EncodeToString(bs))
+	}
+}
+
+func TestDecoding(t *testing.T) {
+	// Examples from RFC 8949 Appendix A that the encoder doesn't produce
+	for h, v := range map[string]interface{}{
+		`f93c00`:                     1.0,
+		`f9c400`:                     -4.0,
+		`f90001`:                     5.960464477539063e-8,
+		`f97c00`:                     math.Inf(1),
+		`fa47c35000`:                 100000.0,
+		`f7`:                         vf.Nil,
+		`c11a514b67b0`:               vf.Time(time.Unix(1363896240, 0)),
+		`c1fb41d452d9ec200000`:       vf.Time(time.Unix(1363896240, 500000000)),
+		`d9d9f7f5`:                   true,
+		`5f42010243030405ff`:         vf.Binary([]byte{1, 2, 3, 4, 5}, true),
+		`7f657374726561646d696e67ff`: `streaming`,
+		`9f018202039f0405ffff`:       vf.Values(1, vf.Values(2, 3), vf.Values(4, 5)),
+		`9fff`:                       vf.Values(),
+		`bf61610161629f0203ffff`:     vf.Map(`a`, 1, `b`, vf.Values(2, 3)),
+		`c074323031332d30332d32315432303a30343a30305a`: vf.Time(time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)),
+	} {
+		bs, _ := hex.DecodeString(h)
+		r, err := cbor.Unmarshal(bs)
+		require.Nil(t, err)
+		require.Equal(t, vf.Value(v), r)
+	}
+	bs, _ := hex.DecodeString(`f97e00`)
+	r, err := cbor.Unmarshal(bs)
+	require.Nil(t, err)
+	require.True(t, math.IsNaN(r.(dgo.Float).GoFloat()))
+}
+
+func TestDecoding_errors(t *testing.T) {
+	for h, msg := range map[string]string{
+		``:                   `EOF`,
+		`1b`:                 `unexpected EOF`,
+		`1bffffffffffffffff`: `integer overflows int64`,
+		`1f`:                 `integer cannot have indefinite length`,
+		`1c`:                 `invalid additional information 28`,
+		`45010203`:           `unexpected EOF`,
+		`5f4101ff00`:         `unexpected data after top-level value`,
+		`5f6101ff`:           `invalid chunk in indefinite length string`,
+		`5f5fffff`:           `nested indefinite length string`,
+		`8201`:               `unexpected EOF`,
+		`9f01`:               `unexpected EOF`,
+		`a101`:               `unexpected EOF`,
+		`ff`:                 `unexpected break`,
+		`82ff`:               `unexpected break`,
+		`c2420100`:           `unsupported tag 2`,
+		`c001`:               `invalid content for tag 0`,
+		`c06178`:             `invalid timestamp`,
+		`f0`:                 `unsupported simple value 0xf0`,
+		`5c`:                 `invalid additional information 28`,
+		`5f`:                 `unexpected EOF`,
+		`5f5c`:               `invalid additional information 28`,
+		`5f4201`:             `unexpected EOF`,
+		`5bffffffffffffffff`: `length overflows int64`,
+		`9c`:                 `invalid additional information 28`,
+		`bc`:                 `invalid additional information 28`,
+		`a1`:                 `unexpected EOF`,
+		`dc`:                 `invalid additional information 28`,
+		`c0`:                 `unexpected EOF`,
+		`f9`:                 `unexpected EOF`,
+	} {
+		bs, _ := hex.DecodeString(h)
+		_, err := cbor.Unmarshal(bs)
+		require.True(t, err != nil, h)
+		require.True(t, bytes.Contains([]byte(err.Error()), []byte(msg)), h+`: `+err.Error())
+	}
+
+	deep := bytes.Repeat([]byte{0x81}, 1100)
+	_, err := cbor.Unmarshal(append(deep, 0))
+	require.Equal(t, `cbor: maximum nesting depth exceeded`, err.Error())
+
+	_, err = cbor.Marshal(vf.Values(vf.String(`x`).Type()))
+	require.NotNil(t, err)
+
+	bs, err := cbor.Marshal(nil)
+	require.Nil(t, err)
+	require.Equal(t, `f6`, hex.EncodeToString(bs))
+}
+
+func TestStreaming(t *testing.T) {
+	var b bytes.Buffer
+	e := cbor.NewEncoder(&b)
+	require.Nil(t, e.StartMap())
+	require.Nil(t, e.Encode(vf.String(`a`)))
+	require.Nil(t, e.Encode(vf.Integer(1)))
+	require.Nil(t, e.Encode(vf.String(`b`)))
+	require.Nil(t, e.Encode(vf.Sensitive(2)))
+	require.Nil(t, e.End())
+	require.Nil(t, e.Encode(vf.Map(`c`, 3)))
+
+	d := cbor.NewDecoder(&b)
+	m := vf.MutableMap(nil)
+	require.Nil(t, d.DecodeMap(func(k, v dgo.Value) { m.Put(k, v) }))
+	require.Equal(t, vf.Map(`a`, 1, `b`, vf.Sensitive(2)), m)
+	m = vf.MutableMap(nil)
+	require.Nil(t, d.DecodeMap(func(k, v dgo.Value) { m.Put(k, v) }))
+	require.Equal(t, vf.Map(`c`, 3), m)
+	require.Equal(t, io.EOF, d.DecodeMap(func(k, v dgo.Value) {}))
+
+	require.Nil(t, e.Encode(vf.Values()))
+	require.Equal(t, `cbor: expected a map, got major type 4`, d.DecodeMap(func(k, v dgo.Value) {}).Error())
+}
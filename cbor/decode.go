@@ -0,0 +1,335 @@
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+)
+
+// maxDepth is the maximum nesting of arrays, maps, and tags that the Decoder accepts
+const maxDepth = 1000
+
+// errBreak is returned internally when a "break" code is encountered
+var errBreak = errors.New(`cbor: unexpected break`)
+
+// Decoder reads CBOR encoded values from an io.Reader
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns a Decoder that reads from the given io.Reader. The Decoder may read data beyond the values
+// that it decodes.
+func NewDecoder(r io.Reader) *Decoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Decoder{r: br}
+}
+
+// Unmarshal decodes the given CBOR encoded data. It is an error if the data contains more than one value.
+func Unmarshal(data []byte) (dgo.Value, error) {
+	d := NewDecoder(bytes.NewReader(data))
+	v, err := d.Decode()
+	if err == nil {
+		if _, err = d.r.ReadByte(); err == nil {
+			err = errors.New(`cbor: unexpected data after top-level value`)
+		} else if err == io.EOF {
+			err = nil
+		}
+	}
+	return v, err
+}
+
+// Decode reads the next value. The returned error is io.EOF if the reader has no more data.
+func (d *Decoder) Decode() (dgo.Value, error) {
+	return d.value(0)
+}
+
+// DecodeMap reads the next value, which must be a map, and calls the given actor with each of its entries as soon
+// as the entry has been decoded. The map may be of indefinite length.
+func (d *Decoder) DecodeMap(actor func(key, value dgo.Value)) error {
+	ib, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if ib>>5 != majorMap {
+		return fmt.Errorf(`cbor: expected a map, got major type %d`, ib>>5)
+	}
+	return d.mapEntries(ib, 0, actor)
+}
+
+func (d *Decoder) value(depth int) (dgo.Value, error) {
+	ib, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if ib == breakCode {
+		return nil, errBreak
+	}
+	if depth > maxDepth {
+		return nil, errors.New(`cbor: maximum nesting depth exceeded`)
+	}
+	switch ib >> 5 {
+	case majorArray:
+		return d.array(ib, depth)
+	case majorMap:
+		m := vf.MutableMap(nil)
+		if err = d.mapEntries(ib, depth, func(k, v dgo.Value) { m.Put(k, v) }); err != nil {
+			return nil, err
+		}
+		return m, nil
+	case majorTag:
+		return d.tag(ib, depth)
+	case majorSimple:
+		return d.simple(ib)
+	default:
+		return d.scalar(ib)
+	}
+}
+
+// scalar decodes an integer, a byte string, or a text string
+func (d *Decoder) scalar(ib byte) (dgo.Value, error) {
+	if major := ib >> 5; major == majorUint || major == majorNegInt {
+		n, err := d.uint(ib)
+		if err != nil {
+			return nil, err
+		}
+		if major == majorNegInt {
+			return vf.Integer(-1 - int64(n)), nil
+		}
+		return vf.Integer(int64(n)), nil
+	}
+	bs, err := d.bytes(ib)
+	if err != nil {
+		return nil, err
+	}
+	if ib>>5 == majorBytes {
+		return vf.Binary(bs, true), nil
+	}
+	return vf.String(string(bs)), nil
+}
+
+// arg returns the argument of the given initial byte. The returned boolean is true if the initial byte denotes an
+// indefinite length.
+func (d *Decoder) arg(ib byte) (uint64, bool, error) {
+	info := ib & 0x1f
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), false, nil
+	case info == 31:
+		return 0, true, nil
+	case info > 27:
+		return 0, false, fmt.Errorf(`cbor: invalid additional information %d`, info)
+	default:
+		size = 1 << (info - 24)
+	}
+	var n uint64
+	for i := 0; i < size; i++ {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return 0, false, unexpectedEOF(err)
+		}
+		n = n<<8 | uint64(b)
+	}
+	return n, false, nil
+}
+
+// uint returns the argument of the given initial byte as an integer that fits in an int64
+func (d *Decoder) uint(ib byte) (uint64, error) {
+	n, indefinite, err := d.arg(ib)
+	if err == nil {
+		if indefinite {
+			err = errors.New(`cbor: integer cannot have indefinite length`)
+		} else if n > math.MaxInt64 {
+			err = errors.New(`cbor: integer overflows int64`)
+		}
+	}
+	return n, err
+}
+
+func (d *Decoder) bytes(ib byte) ([]byte, error) {
+	n, indefinite, err := d.arg(ib)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if !indefinite {
+		return d.readN(&b, n)
+	}
+	// An indefinite string is a sequence of definite strings of the same major type
+	for {
+		cb, err := d.r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if cb == breakCode {
+			return b.Bytes(), nil
+		}
+		if cb>>5 != ib>>5 {
+			return nil, errors.New(`cbor: invalid chunk in indefinite length string`)
+		}
+		if n, indefinite, err = d.arg(cb); err != nil {
+			return nil, err
+		}
+		if indefinite {
+			return nil, errors.New(`cbor: nested indefinite length string`)
+		}
+		if _, err = d.readN(&b, n); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readN appends n bytes to the given buffer. The buffer grows as data arrives so that a bogus length in the input
+// doesn't cause a huge allocation.
+func (d *Decoder) readN(b *bytes.Buffer, n uint64) ([]byte, error) {
+	if n > math.MaxInt64 {
+		return nil, errors.New(`cbor: length overflows int64`)
+	}
+	if _, err := io.CopyN(b, d.r, int64(n)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b.Bytes(), nil
+}
+
+func (d *Decoder) array(ib byte, depth int) (dgo.Value, error) {
+	n, indefinite, err := d.arg(ib)
+	if err != nil {
+		return nil, err
+	}
+	var vs []dgo.Value
+	for i := uint64(0); indefinite || i < n; i++ {
+		v, err := d.value(depth + 1)
+		if err == errBreak && indefinite {
+			break
+		}
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		vs = append(vs, v)
+	}
+	return vf.Array(vs), nil
+}
+
+func (d *Decoder) mapEntries(ib byte, depth int, actor func(key, value dgo.Value)) error {
+	n, indefinite, err := d.arg(ib)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); indefinite || i < n; i++ {
+		k, err := d.value(depth + 1)
+		if err == errBreak && indefinite {
+			break
+		}
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		actor(k, v)
+	}
+	return nil
+}
+
+func (d *Decoder) tag(ib byte, depth int) (dgo.Value, error) {
+	tag, err := d.uint(ib)
+	if err != nil {
+		return nil, err
+	}
+	v, err := d.value(depth + 1)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	switch tag {
+	case tagTime:
+		if s, ok := v.(dgo.String); ok {
+			t, err := time.Parse(time.RFC3339Nano, s.GoString())
+			if err != nil {
+				return nil, fmt.Errorf(`cbor: invalid timestamp: %s`, err.Error())
+			}
+			return vf.Time(t), nil
+		}
+	case tagEpoch:
+		switch n := v.(type) {
+		case dgo.Integer:
+			return vf.Time(time.Unix(n.GoInt(), 0)), nil
+		case dgo.Float:
+			s, f := math.Modf(n.GoFloat())
+			return vf.Time(time.Unix(int64(s), int64(f*1e9))), nil
+		}
+	case SensitiveTag:
+		return vf.Sensitive(v), nil
+	case tagSelfDescribe:
+		return v, nil
+	default:
+		return nil, fmt.Errorf(`cbor: unsupported tag %d`, tag)
+	}
+	return nil, fmt.Errorf(`cbor: invalid content for tag %d`, tag)
+}
+
+func (d *Decoder) simple(ib byte) (dgo.Value, error) {
+	switch ib {
+	case simpleFalse:
+		return vf.False, nil
+	case simpleTrue:
+		return vf.True, nil
+	case simpleNull, simpleUndefined:
+		return vf.Nil, nil
+	case simpleFloat16, simpleFloat32, simpleFloat64:
+		n, _, err := d.arg(ib)
+		if err != nil {
+			return nil, err
+		}
+		switch ib {
+		case simpleFloat16:
+			return vf.Float(halfToFloat(uint16(n))), nil
+		case simpleFloat32:
+			return vf.Float(float64(math.Float32frombits(uint32(n)))), nil
+		default:
+			return vf.Float(math.Float64frombits(n)), nil
+		}
+	default:
+		return nil, fmt.Errorf(`cbor: unsupported simple value 0x%x`, ib)
+	}
+}
+
+// halfToFloat converts an IEEE 754 half precision float to a float64
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
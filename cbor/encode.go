@@ -0,0 +1,185 @@
+// Package cbor implements the CBOR (RFC 8949) encoding of dgo values that plugins and hosts use as an alternative
+// to JSON. In contrast to JSON, CBOR preserves the distinction between integers and floats, binary values,
+// timestamps, sensitive values, and map keys that are not strings.
+//
+// Timestamps are encoded as RFC 3339 strings with tag 0 so that both nanoseconds and the zone offset are
+// preserved. Sensitive values are encoded using the SensitiveTag.
+package cbor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+)
+
+// ContentType is the media type of CBOR encoded data
+const ContentType = `application/cbor`
+
+// SensitiveTag is the CBOR tag used for values that are wrapped using vf.Sensitive. The tag is in the range that
+// RFC 8949 leaves for first come first served use.
+const SensitiveTag = 0x53454e53
+
+const (
+	majorUint = iota
+	majorNegInt
+	majorBytes
+	majorText
+	majorArray
+	majorMap
+	majorTag
+	majorSimple
+)
+
+const (
+	tagTime         = 0
+	tagEpoch        = 1
+	tagSelfDescribe = 55799
+
+	simpleFalse     = 0xf4
+	simpleTrue      = 0xf5
+	simpleNull      = 0xf6
+	simpleUndefined = 0xf7
+	simpleFloat16   = 0xf9
+	simpleFloat32   = 0xfa
+	simpleFloat64   = 0xfb
+	indefiniteMap   = 0xbf
+	breakCode       = 0xff
+)
+
+// Encoder writes CBOR encoded values to an io.Writer
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns an Encoder that writes to the given io.Writer
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Marshal returns the CBOR encoding of the given value
+func Marshal(v dgo.Value) ([]byte, error) {
+	var b bytes.Buffer
+	if err := NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Encode writes the CBOR encoding of the given value
+func (e *Encoder) Encode(v dgo.Value) error {
+	bs, err := appendValue(nil, v)
+	if err == nil {
+		_, err = e.w.Write(bs)
+	}
+	return err
+}
+
+// StartMap writes the start of a map of indefinite length. The map consists of alternating keys and values
+// written using Encode and must be ended by a call to End.
+func (e *Encoder) StartMap() error {
+	_, err := e.w.Write([]byte{indefiniteMap})
+	return err
+}
+
+// End writes the "break" code that ends a map of indefinite length
+func (e *Encoder) End() error {
+	_, err := e.w.Write([]byte{breakCode})
+	return err
+}
+
+func appendHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return append(b, major|25, byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		return append(b, major|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	default:
+		return append(b, major|27, byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32),
+			byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendValue(b []byte, v dgo.Value) ([]byte, error) {
+	switch v := v.(type) {
+	case dgo.Sensitive:
+		return appendValue(appendHead(b, majorTag, SensitiveTag), v.Unwrap())
+	case dgo.Array:
+		return appendArray(b, v)
+	case dgo.Map:
+		return appendMap(b, v)
+	}
+	return appendScalar(b, v)
+}
+
+// appendScalar appends the encoding of a null, boolean, number, string, binary, or time value
+func appendScalar(b []byte, v dgo.Value) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		b = append(b, simpleNull)
+	case dgo.Boolean:
+		if v.GoBool() {
+			b = append(b, simpleTrue)
+		} else {
+			b = append(b, simpleFalse)
+		}
+	case dgo.Integer:
+		if i := v.GoInt(); i < 0 {
+			b = appendHead(b, majorNegInt, uint64(-1-i))
+		} else {
+			b = appendHead(b, majorUint, uint64(i))
+		}
+	case dgo.Float:
+		n := math.Float64bits(v.GoFloat())
+		b = append(b, simpleFloat64, byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32),
+			byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	case dgo.String:
+		s := v.GoString()
+		b = append(appendHead(b, majorText, uint64(len(s))), s...)
+	case dgo.Binary:
+		bs := v.GoBytes()
+		b = append(appendHead(b, majorBytes, uint64(len(bs))), bs...)
+	case dgo.Time:
+		s := v.GoTime().Format(time.RFC3339Nano)
+		b = append(appendHead(appendHead(b, majorTag, tagTime), majorText, uint64(len(s))), s...)
+	default:
+		if v != vf.Nil {
+			return b, fmt.Errorf(`cbor: unable to encode a value of type %s`, v.Type())
+		}
+		b = append(b, simpleNull)
+	}
+	return b, nil
+}
+
+// appendArray appends the encoding of an array and its elements
+func appendArray(b []byte, a dgo.Array) (_ []byte, err error) {
+	b = appendHead(b, majorArray, uint64(a.Len()))
+	a.EachWithIndex(func(e dgo.Value, _ int) {
+		if err == nil {
+			b, err = appendValue(b, e)
+		}
+	})
+	return b, err
+}
+
+// appendMap appends the encoding of a map and its entries
+func appendMap(b []byte, m dgo.Map) (_ []byte, err error) {
+	b = appendHead(b, majorMap, uint64(m.Len()))
+	m.EachEntry(func(e dgo.MapEntry) {
+		if err == nil {
+			if b, err = appendValue(b, e.Key()); err == nil {
+				b, err = appendValue(b, e.Value())
+			}
+		}
+	})
+	return b, err
+}
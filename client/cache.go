@@ -0,0 +1,81 @@
+package client
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/hierasdk/events"
+)
+
+// cache holds the values that the plugin responded with together with their ETags, keyed by request URL. All
+// methods are no-ops on a nil cache.
+type cache struct {
+	lock    sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	etag  string
+	value dgo.Value
+}
+
+func newCache() *cache {
+	return &cache{entries: make(map[string]*cacheEntry)}
+}
+
+func (c *cache) get(u string) *cacheEntry {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.entries[u]
+}
+
+// put stores the given value under the given URL. The value is frozen since it is shared by all callers that
+// request the same URL. A value without an ETag is not cached.
+func (c *cache) put(u, etag string, v dgo.Value) {
+	if c == nil {
+		return
+	}
+	if etag == `` {
+		c.remove(u)
+		return
+	}
+	if f, ok := v.(dgo.Freezable); ok {
+		f.Freeze()
+	}
+	c.lock.Lock()
+	c.entries[u] = &cacheEntry{etag: etag, value: v}
+	c.lock.Unlock()
+}
+
+func (c *cache) remove(u string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	delete(c.entries, u)
+	c.lock.Unlock()
+}
+
+// removeFunction removes the entries of the function that the given event names, or all entries when the event
+// doesn't name a function.
+func (c *cache) removeFunction(base string, e events.Event) {
+	if c == nil {
+		return
+	}
+	prefix := base + `/`
+	if e.Function != `` {
+		prefix += e.Kind + `/` + url.PathEscape(e.Function)
+	}
+	c.lock.Lock()
+	for u := range c.entries {
+		if strings.HasPrefix(u, prefix) && (len(u) == len(prefix) || e.Function == `` || u[len(prefix)] == '?') {
+			delete(c.entries, u)
+		}
+	}
+	c.lock.Unlock()
+}
@@ -0,0 +1,388 @@
+// Package client provides the host side of the RESTful plugin protocol. A host uses a Client to call the lookup
+// functions of a plugin at the address that the plugin announced in its handshake.
+package client
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/cbor"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/richjson"
+)
+
+// notFoundMessage is the message that the plugin sends with a 404 when a function doesn't find a value. Any other
+// 404 means that the function doesn't exist.
+const notFoundMessage = `404 value not found`
+
+type (
+	// Client calls the lookup functions of one plugin
+	Client struct {
+		base   string
+		hc     *http.Client
+		accept string
+		cache  *cache
+		host   hiera.HostInfo
+	}
+
+	// Option configures a Client
+	Option func(*Client)
+
+	// Error is returned when the plugin responds with an unexpected HTTP status. This includes a 404 response for
+	// a function that doesn't exist.
+	Error struct {
+		// Status is the HTTP status code
+		Status int
+
+		// Message is the error message sent by the plugin
+		Message string
+	}
+)
+
+// New returns a Client for the plugin at the given address. The address is either the "address" from the plugin
+// handshake, e.g. "127.0.0.1:10000", or a URL such as "http://127.0.0.1:10000". The Client requests compressed
+// responses and decompresses them transparently.
+func New(address string, opts ...Option) *Client {
+	return NewWithHTTPClient(address, http.DefaultClient, opts...)
+}
+
+// NewWithHTTPClient is like New but the Client will use the given http.Client for all requests
+func NewWithHTTPClient(address string, hc *http.Client, opts ...Option) *Client {
+	if !strings.Contains(address, `://`) {
+		address = `http://` + address
+	}
+	c := &Client{base: strings.TrimSuffix(address, `/`), hc: hc, accept: `application/json`}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithCache makes the Client cache the values of responses that carry an ETag. Subsequent calls with the same
+// arguments send the ETag in an If-None-Match header and return the cached value when the plugin responds with
+// 304 Not Modified. Cached values are frozen. The cache is not used by StreamDataHash.
+func WithCache() Option {
+	return func(c *Client) {
+		c.cache = newCache()
+	}
+}
+
+// WithRichJSON makes the Client request responses in the rich JSON encoding, which preserves binary values,
+// timestamps, sensitive values, and dgo types. See package richjson.
+func WithRichJSON() Option {
+	return func(c *Client) {
+		c.accept = richjson.ContentType
+	}
+}
+
+// WithCBOR makes the Client request responses in the CBOR encoding, which preserves the distinction between
+// integers and floats, binary values, timestamps, and sensitive values.
+func WithCBOR() Option {
+	return func(c *Client) {
+		c.accept = cbor.ContentType
+	}
+}
+
+// Error returns the status and the message of the response
+func (e *Error) Error() string {
+	return fmt.Sprintf(`plugin responded with status %d: %s`, e.Status, e.Message)
+}
+
+// WithHost returns a copy of the Client that sends the given HostInfo with each call. The copy shares the cache of
+// the Client, if any. The InvocationID, CallbackToken, and Depth of the HostInfo don't affect the caching.
+func (c *Client) WithHost(h hiera.HostInfo) *Client {
+	cc := *c
+	cc.host = h
+	return &cc
+}
+
+// DataDig calls the data_dig function with the given name. The returned value is nil when the function doesn't
+// find a value.
+func (c *Client) DataDig(name string, key dgo.Array, options dgo.Map) (dgo.Value, error) {
+	js, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.call(`data_dig`, name, string(js), options)
+}
+
+// DataHash calls the data_hash function with the given name. The returned value is nil when the function doesn't
+// find a value.
+func (c *Client) DataHash(name string, options dgo.Map) (dgo.Value, error) {
+	return c.call(`data_hash`, name, ``, options)
+}
+
+// LookupKey calls the lookup_key function with the given name. The returned value is nil when the function doesn't
+// find a value.
+func (c *Client) LookupKey(name, key string, options dgo.Map) (dgo.Value, error) {
+	return c.call(`lookup_key`, name, key, options)
+}
+
+// StreamDataHash calls the data_hash function with the given name and decodes the response incrementally. The
+// given actor is called once for each entry as soon as it has been decoded. The returned boolean is false when the
+// function didn't find a value.
+//
+// A StreamingDataHash function flags sensitive values in JSON responses when all entries have been sent. The
+// entries passed to the actor are therefore only wrapped as sensitive when the Client uses CBOR or rich JSON. Use
+// DataHash for functions that may return sensitive values when using plain JSON.
+func (c *Client) StreamDataHash(name string, options dgo.Map, actor func(key string, value dgo.Value)) (bool, error) {
+	u, _, err := c.url(`data_hash`, name, ``, options)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.get(u, ``)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return false, responseError(resp)
+	}
+	ct := mediaType(resp)
+	if ct == cbor.ContentType {
+		return true, cbor.NewDecoder(resp.Body).DecodeMap(func(key, value dgo.Value) {
+			actor(key.String(), value)
+		})
+	}
+	unmarshal := vf.UnmarshalJSON
+	if ct == richjson.ContentType {
+		unmarshal = richjson.Unmarshal
+	}
+	dec := json.NewDecoder(resp.Body)
+	if err = expectDelim(dec, '{'); err != nil {
+		return false, err
+	}
+	for dec.More() {
+		var t json.Token
+		if t, err = dec.Token(); err != nil {
+			return false, err
+		}
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			return false, err
+		}
+		var v dgo.Value
+		if v, err = unmarshal(raw); err != nil {
+			return false, err
+		}
+		actor(t.(string), v)
+	}
+	return true, expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err == nil && t != delim {
+		err = fmt.Errorf(`expected '%c', got %v`, delim, t)
+	}
+	return err
+}
+
+func (c *Client) call(kind, name, key string, options dgo.Map) (dgo.Value, error) {
+	u, ck, err := c.url(kind, name, key, options)
+	if err != nil {
+		return nil, err
+	}
+	etag := ``
+	ce := c.cache.get(ck)
+	if ce != nil {
+		etag = ce.etag
+	}
+	resp, err := c.get(u, etag)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		if ce != nil {
+			return ce.value, nil
+		}
+		return nil, &Error{Status: resp.StatusCode, Message: `unexpected Not Modified response`}
+	default:
+		c.cache.remove(ck)
+		return nil, responseError(resp)
+	}
+	v, err := decodeValue(resp)
+	if err == nil {
+		c.cache.put(ck, resp.Header.Get(`ETag`), v)
+	}
+	return v, err
+}
+
+// decodeValue decodes the body of the given response according to its Content-Type
+func decodeValue(resp *http.Response) (dgo.Value, error) {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// Sensitive values are retained by the CBOR and rich JSON encodings
+	switch mediaType(resp) {
+	case cbor.ContentType:
+		return cbor.Unmarshal(body)
+	case richjson.ContentType:
+		return richjson.Unmarshal(body)
+	}
+	v, err := vf.UnmarshalJSON(body)
+	if err != nil {
+		return nil, err
+	}
+	sh := resp.Header.Get(hiera.SensitiveHeader)
+	if sh == `` {
+		sh = resp.Trailer.Get(hiera.SensitiveHeader)
+	}
+	if sh != `` {
+		var pointers []string
+		if err = json.Unmarshal([]byte(sh), &pointers); err != nil {
+			return nil, err
+		}
+		// Pointers to nested values come after the pointers to their containers
+		for i := len(pointers) - 1; i >= 0; i-- {
+			v = wrapSensitive(v, pointers[i])
+		}
+	}
+	return v, nil
+}
+
+// url returns the URL of a call to the given function and the key of the call in the cache. The key is the URL
+// without the invocation id, the callback token, and the depth of the HostInfo since they change between lookups.
+func (c *Client) url(kind, name, key string, options dgo.Map) (string, string, error) {
+	q := url.Values{}
+	if key != `` {
+		q.Set(`key`, key)
+	}
+	if options != nil && options.Len() > 0 {
+		js, err := json.Marshal(options)
+		if err != nil {
+			return ``, ``, err
+		}
+		q.Set(`options`, string(js))
+	}
+	h := c.host
+	h.InvocationID = ``
+	h.CallbackToken = ``
+	h.Depth = 0
+	h.Encode(q)
+	u := c.base + `/` + kind + `/` + url.PathEscape(name)
+	ck := u
+	if len(q) > 0 {
+		ck += `?` + q.Encode()
+	}
+	h = hiera.HostInfo{InvocationID: c.host.InvocationID, CallbackToken: c.host.CallbackToken, Depth: c.host.Depth}
+	h.Encode(q)
+	if len(q) > 0 {
+		u += `?` + q.Encode()
+	}
+	return u, ck, nil
+}
+
+// get sends a GET request to the given URL. The request is conditional when the given etag is not empty.
+func (c *Client) get(u, etag string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if etag != `` {
+		req.Header.Set(`If-None-Match`, etag)
+	}
+	req.Header.Set(`Accept`, c.accept)
+	req.Header.Set(`Accept-Encoding`, `gzip, deflate`)
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err = decodeBody(resp); err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// mediaType returns the media type of the Content-Type of the given response without parameters
+func mediaType(resp *http.Response) string {
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get(`Content-Type`))
+	return mt
+}
+
+// decodeBody replaces the body of the given response with a reader that decompresses it according to its
+// Content-Encoding.
+func decodeBody(resp *http.Response) error {
+	var r io.ReadCloser
+	var err error
+	switch resp.Header.Get(`Content-Encoding`) {
+	case ``:
+		return nil
+	case `gzip`:
+		r, err = gzip.NewReader(resp.Body)
+	case `deflate`:
+		r, err = zlib.NewReader(resp.Body)
+	default:
+		return fmt.Errorf(`unsupported Content-Encoding %q`, resp.Header.Get(`Content-Encoding`))
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body = &decodedBody{ReadCloser: r, body: resp.Body}
+	resp.Header.Del(`Content-Encoding`)
+	return nil
+}
+
+// decodedBody closes both the decompressing reader and the original response body
+type decodedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (d *decodedBody) Close() error {
+	_ = d.ReadCloser.Close()
+	return d.body.Close()
+}
+
+// responseError returns the error that corresponds to the given response, or nil if the response means that the
+// function didn't find a value.
+func responseError(resp *http.Response) error {
+	bs, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	msg := strings.TrimSpace(string(bs))
+	if resp.StatusCode == http.StatusNotFound && msg == notFoundMessage {
+		return nil
+	}
+	return &Error{Status: resp.StatusCode, Message: msg}
+}
+
+// wrapSensitive returns the given value with the value that the given JSON pointer selects wrapped as sensitive
+func wrapSensitive(v dgo.Value, pointer string) dgo.Value {
+	if pointer == `` {
+		return vf.Sensitive(v)
+	}
+	token := pointer[1:]
+	rest := ``
+	if i := strings.IndexByte(token, '/'); i >= 0 {
+		token, rest = token[:i], token[i:]
+	}
+	token = strings.Replace(strings.Replace(token, `~1`, `/`, -1), `~0`, `~`, -1)
+	switch c := v.(type) {
+	case dgo.Map:
+		if e := c.Get(token); e != nil {
+			return c.With(token, wrapSensitive(e, rest))
+		}
+	case dgo.Array:
+		if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < c.Len() {
+			a := c.Copy(false)
+			a.Set(i, wrapSensitive(c.Get(i), rest))
+			return a
+		}
+	}
+	return v
+}
@@ -0,0 +1,577 @@
+package client_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/typ"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/client"
+	"github.com/lyraproj/hierasdk/events"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
+	"github.com/lyraproj/hierasdk/richjson"
+	"github.com/lyraproj/hierasdk/routes"
+)
+
+var richData = vf.Map(`f`, 1.0, `t`, vf.Time(time.Unix(1, 2)), `b`, vf.Binary([]byte{1, 2}, true), 1, `int key`)
+
+func newServer() *httptest.Server {
+	return httptest.NewServer(newHandler())
+}
+
+func newHandler() http.Handler {
+	reg := register.NewRegistry()
+	reg.DataDig(`dd`, func(ctx hiera.ProviderContext, key dgo.Array) dgo.Value {
+		if key.Equals(vf.Values(`a`, 1)) {
+			return vf.Map(`x`, vf.Sensitive(vf.Values(1, vf.Sensitive(2))))
+		}
+		return nil
+	})
+	reg.DataHash(`dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		if ctx.Option(`fail`) != nil {
+			panic(errors.New(`goodbye`))
+		}
+		return ctx.Option(`data`)
+	})
+	reg.DataHash(`rich`, func(ctx hiera.ProviderContext) dgo.Value {
+		return richData
+	})
+	reg.StreamingDataHash(`sdh`, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) {
+		n, _ := ctx.IntOption(`count`)
+		for i := 0; i < n; i++ {
+			v := vf.Value(i)
+			if i == 1 {
+				v = vf.Sensitive(v)
+			}
+			yield(`k/`+vf.Value(i).String(), v)
+			if _, fail := ctx.IntOption(`fail`); fail && i == 2 {
+				panic(errors.New(`goodbye`))
+			}
+		}
+	})
+	reg.LookupKey(`lk`, func(ctx hiera.ProviderContext, key string) dgo.Value {
+		switch key {
+		case `secret`:
+			return vf.Sensitive(`xyz`)
+		case `type`:
+			return typ.String
+		}
+		return ctx.Option(key)
+	})
+	h, _ := routes.RegisterWith(reg)
+	return h
+}
+
+func TestClient(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+	c := client.NewWithHTTPClient(s.URL+`/`, s.Client())
+
+	v, err := c.DataHash(`dh`, vf.Map(`data`, vf.Map(`a`, 1)))
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`a`, 1), v)
+
+	v, err = c.DataHash(`dh`, nil)
+	require.Nil(t, err)
+	require.Nil(t, v)
+
+	_, err = c.DataHash(`dh`, vf.Map(`fail`, true))
+	require.Equal(t, `plugin responded with status 500: goodbye`, err.Error())
+	require.Equal(t, 500, err.(*client.Error).Status)
+
+	v, err = c.LookupKey(`lk`, `a`, vf.Map(`a`, `b`))
+	require.Nil(t, err)
+	require.Equal(t, `b`, v)
+
+	v, err = c.LookupKey(`lk`, `secret`, nil)
+	require.Nil(t, err)
+	require.Equal(t, vf.Sensitive(`xyz`), v)
+
+	v, err = c.DataDig(`dd`, vf.Values(`a`, 1), nil)
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`x`, vf.Sensitive(vf.Values(1, vf.Sensitive(2)))), v)
+
+	v, err = c.DataDig(`dd`, vf.Values(`a`, 2), nil)
+	require.Nil(t, err)
+	require.Nil(t, v)
+}
+
+func TestClient_stream(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+	c := client.New(s.Listener.Addr().String())
+
+	var keys []string
+	found, err := c.StreamDataHash(`sdh`, vf.Map(`count`, 3), func(key string, value dgo.Value) {
+		keys = append(keys, key)
+		require.Equal(t, vf.Value(len(keys)-1), value)
+	})
+	require.Nil(t, err)
+	require.True(t, found)
+	require.Equal(t, []string{`k/0`, `k/1`, `k/2`}, keys)
+
+	found, err = c.StreamDataHash(`sdh`, nil, func(key string, value dgo.Value) {})
+	require.Nil(t, err)
+	require.False(t, found)
+
+	_, err = c.StreamDataHash(`sdh`, vf.Map(`count`, 5, `fail`, 1), func(key string, value dgo.Value) {})
+	require.NotNil(t, err)
+
+	_, err = c.StreamDataHash(`dh`, vf.Map(`data`, vf.Values(1)), func(key string, value dgo.Value) {})
+	require.Equal(t, `expected '{', got [`, err.Error())
+
+	_, err = c.StreamDataHash(`nope`, nil, func(key string, value dgo.Value) {})
+	require.Equal(t, 404, err.(*client.Error).Status)
+
+	// A streamed data_hash can also be read in full, in which case sensitive values are flagged
+	v, err := c.DataHash(`sdh`, vf.Map(`count`, 3))
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`k/0`, 0, `k/1`, vf.Sensitive(1), `k/2`, 2), v)
+}
+
+func TestClient_compressed(t *testing.T) {
+	h := newHandler()
+	var encodings []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		encodings = append(encodings, w.Header().Get(`Content-Encoding`))
+	}))
+	defer s.Close()
+	c := client.New(s.URL)
+
+	big := vf.Map(`a`, strings.Repeat(`x`, 2*routes.CompressThreshold))
+	v, err := c.DataHash(`dh`, vf.Map(`data`, big))
+	require.Nil(t, err)
+	require.Equal(t, big, v)
+
+	n := 0
+	found, err := c.StreamDataHash(`sdh`, vf.Map(`count`, 500), func(key string, value dgo.Value) { n++ })
+	require.Nil(t, err)
+	require.True(t, found)
+	require.Equal(t, 500, n)
+
+	v, err = c.DataHash(`dh`, vf.Map(`data`, vf.Map(`a`, 1)))
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`a`, 1), v)
+	require.Equal(t, []string{`gzip`, `gzip`, ``}, encodings)
+}
+
+func TestClient_contentEncodings(t *testing.T) {
+	var deflated bytes.Buffer
+	zw := zlib.NewWriter(&deflated)
+	_, _ = zw.Write([]byte(`{"a":1}`))
+	_ = zw.Close()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := strings.TrimPrefix(r.URL.Path, `/data_hash/`)
+		w.Header().Set(`Content-Type`, `application/json`)
+		w.Header().Set(`Content-Encoding`, enc)
+		if enc == `deflate` {
+			_, _ = w.Write(deflated.Bytes())
+		} else {
+			_, _ = w.Write([]byte(`{"a":"not compressed"}`))
+		}
+	}))
+	defer s.Close()
+	c := client.New(s.URL)
+
+	v, err := c.DataHash(`deflate`, nil)
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`a`, 1), v)
+	_, err = c.DataHash(`gzip`, nil)
+	require.Match(t, `gzip: invalid header`, err.Error())
+	_, err = c.DataHash(`br`, nil)
+	require.Equal(t, `unsupported Content-Encoding "br"`, err.Error())
+}
+
+func TestClient_cbor(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+	c := client.New(s.URL, client.WithCBOR())
+
+	v, err := c.DataHash(`rich`, nil)
+	require.Nil(t, err)
+	require.Equal(t, richData, v)
+	require.Equal(t, richData.Get(`f`).Type(), v.(dgo.Map).Get(`f`).Type())
+
+	v, err = c.DataDig(`dd`, vf.Values(`a`, 1), nil)
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`x`, vf.Sensitive(vf.Values(1, vf.Sensitive(2)))), v)
+
+	m := vf.MutableMap(nil)
+	found, err := c.StreamDataHash(`sdh`, vf.Map(`count`, 3), func(key string, value dgo.Value) { m.Put(key, value) })
+	require.Nil(t, err)
+	require.True(t, found)
+	require.Equal(t, vf.Map(`k/0`, 0, `k/1`, vf.Sensitive(1), `k/2`, 2), m)
+
+	_, err = c.StreamDataHash(`dh`, vf.Map(`data`, vf.Values(1)), func(key string, value dgo.Value) {})
+	require.Equal(t, `cbor: expected a map, got major type 4`, err.Error())
+}
+
+func TestClient_richJSON(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+	c := client.New(s.URL, client.WithRichJSON())
+
+	v, err := c.DataHash(`rich`, nil)
+	require.Nil(t, err)
+	require.Equal(t, richData, v)
+	require.Equal(t, richData.Get(`f`).Type(), v.(dgo.Map).Get(`f`).Type())
+
+	v, err = c.DataDig(`dd`, vf.Values(`a`, 1), nil)
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`x`, vf.Sensitive(vf.Values(1, vf.Sensitive(2)))), v)
+
+	v, err = c.LookupKey(`lk`, `type`, nil)
+	require.Nil(t, err)
+	require.Equal(t, typ.String, v)
+
+	m := vf.MutableMap(nil)
+	found, err := c.StreamDataHash(`sdh`, vf.Map(`count`, 3), func(key string, value dgo.Value) { m.Put(key, value) })
+	require.Nil(t, err)
+	require.True(t, found)
+	require.Equal(t, vf.Map(`k/0`, 0, `k/1`, vf.Sensitive(1), `k/2`, 2), m)
+}
+
+func TestClient_cache(t *testing.T) {
+	reg := register.NewRegistry()
+	version := `1`
+	produced := 0
+	reg.DataHash(`dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		if ctx.SetVersion(version) {
+			return nil
+		}
+		produced++
+		return vf.Map(`version`, version)
+	})
+	reg.LookupKey(`lk`, func(ctx hiera.ProviderContext, key string) dgo.Value {
+		produced++
+		return vf.String(key)
+	})
+	h, _ := routes.RegisterWith(reg)
+	s := httptest.NewServer(h)
+	defer s.Close()
+	c := client.New(s.URL, client.WithCache())
+
+	for i := 0; i < 3; i++ {
+		v, err := c.DataHash(`dh`, nil)
+		require.Nil(t, err)
+		require.Equal(t, vf.Map(`version`, `1`), v)
+		require.True(t, v.(dgo.Freezable).Frozen())
+	}
+	require.Equal(t, 1, produced)
+
+	version = `2`
+	v, err := c.DataHash(`dh`, nil)
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`version`, `2`), v)
+	require.Equal(t, 2, produced)
+
+	// Values without a version are not cached
+	for i := 0; i < 2; i++ {
+		v, err = c.LookupKey(`lk`, `a`, nil)
+		require.Nil(t, err)
+		require.Equal(t, `a`, v)
+	}
+	require.Equal(t, 4, produced)
+
+	// Without the cache, the value is always produced
+	c = client.New(s.URL)
+	_, err = c.DataHash(`dh`, nil)
+	require.Nil(t, err)
+	_, err = c.DataHash(`dh`, nil)
+	require.Nil(t, err)
+	require.Equal(t, 6, produced)
+}
+
+func TestClient_unexpectedNotModified(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer s.Close()
+	_, err := client.New(s.URL, client.WithCache()).DataHash(`dh`, nil)
+	require.Equal(t, `plugin responded with status 304: unexpected Not Modified response`, err.Error())
+}
+
+func TestClient_errors(t *testing.T) {
+	c := client.New(`127.0.0.1:1`)
+	_, err := c.DataHash(`dh`, nil)
+	require.NotNil(t, err)
+	_, err = c.StreamDataHash(`dh`, nil, func(key string, value dgo.Value) {})
+	require.NotNil(t, err)
+}
+
+func TestClient_malformedResponses(t *testing.T) {
+	mux := http.NewServeMux()
+	respond := func(path, contentType, sensitive, body string) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(`Content-Type`, contentType)
+			if sensitive != `` {
+				w.Header().Set(hiera.SensitiveHeader, sensitive)
+			}
+			_, _ = w.Write([]byte(body))
+		})
+	}
+	respond(`/data_hash/json`, `application/json`, ``, `{`)
+	respond(`/data_hash/sensitive`, `application/json`, `[`, `{}`)
+	respond(`/data_hash/pointers`, `application/json`, `["/missing","/a/b","/l/x","/l/1"]`, `{"a":1,"l":[2]}`)
+	respond(`/data_hash/key`, `application/json`, ``, `{1}`)
+	respond(`/data_hash/value`, `application/json`, ``, `{"a":}`)
+	respond(`/data_hash/rich`, richjson.ContentType, ``, `{"a":{"__type":"unknown","__value":1}}`)
+	mux.HandleFunc(`/data_hash/truncated`, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(`Content-Length`, `10`)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	c := client.New(s.URL)
+
+	_, err := c.DataHash(`json`, nil)
+	require.Match(t, `EOF`, err.Error())
+	_, err = c.DataHash(`sensitive`, nil)
+	require.Match(t, `unexpected end of JSON input`, err.Error())
+	_, err = c.DataHash(`truncated`, nil)
+	require.Match(t, `unexpected EOF`, err.Error())
+
+	// Pointers to missing values are ignored
+	v, err := c.DataHash(`pointers`, nil)
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`a`, 1, `l`, vf.Values(2)), v)
+
+	stream := func(name string) error {
+		_, err := c.StreamDataHash(name, nil, func(key string, value dgo.Value) {})
+		return err
+	}
+	require.Match(t, `object member name must be a string`, stream(`key`).Error())
+	require.Match(t, `invalid character '}'`, stream(`value`).Error())
+	require.Match(t, `unable to decode __type: unknown`, stream(`rich`).Error())
+}
+
+func TestClient_invalidArguments(t *testing.T) {
+	c := client.New(`127.0.0.1:1`)
+	nan := vf.Map(`a`, math.NaN())
+	_, err := c.DataDig(`dd`, vf.Values(math.NaN()), nil)
+	require.Match(t, `json: error calling MarshalJSON`, err.Error())
+	_, err = c.DataHash(`dh`, nan)
+	require.Match(t, `json: error calling MarshalJSON`, err.Error())
+	_, err = c.StreamDataHash(`dh`, nan, func(key string, value dgo.Value) {})
+	require.Match(t, `json: error calling MarshalJSON`, err.Error())
+
+	_, err = client.New(`://x`).DataHash(`dh`, nil)
+	require.Match(t, `missing protocol scheme`, err.Error())
+}
+
+func TestClient_Subscribe(t *testing.T) {
+	reg := register.NewRegistry()
+	produced := 0
+	reg.DataHash(`dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		if ctx.SetVersion(`1`) {
+			return nil
+		}
+		produced++
+		return vf.Map(`a`, 1)
+	})
+	h, _ := routes.RegisterWith(reg)
+	s := httptest.NewServer(h)
+	defer s.Close()
+	c := client.New(s.URL, client.WithCache())
+	_, err := c.DataHash(`dh`, nil)
+	require.Nil(t, err)
+
+	received := make(chan events.Event, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Subscribe(ctx, func(e events.Event) { received <- e }) }()
+
+	// The subscription is established asynchronously so the event is published until it is received
+	e := events.Event{Kind: `data_hash`, Function: `dh`, Reason: `test`}
+	var r events.Event
+	for r == (events.Event{}) {
+		events.Publish(e)
+		select {
+		case r = <-received:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	require.Equal(t, e, r)
+	cancel()
+	require.Nil(t, <-done)
+
+	// The cached value was discarded
+	_, err = c.DataHash(`dh`, nil)
+	require.Nil(t, err)
+	require.Equal(t, 2, produced)
+}
+
+func TestClient_Subscribe_errors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(`/ended/events`, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(": comment\nevent: other\ndata: {}\n\nevent: invalidate\nid\ndata: {}\n\n"))
+	})
+	mux.HandleFunc(`/bad/events`, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("event: invalidate\ndata: {\n\n"))
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	ctx := context.Background()
+
+	var received []events.Event
+	err := client.New(s.URL+`/ended`).Subscribe(ctx, func(e events.Event) { received = append(received, e) })
+	require.Match(t, `event stream ended`, err.Error())
+	require.Equal(t, 1, len(received))
+
+	err = client.New(s.URL+`/bad`).Subscribe(ctx, func(e events.Event) {})
+	require.Match(t, `unexpected end of JSON input`, err.Error())
+
+	err = client.New(s.URL+`/missing`).Subscribe(ctx, func(e events.Event) {})
+	require.Match(t, `status 404`, err.Error())
+
+	err = client.New(`://x`).Subscribe(ctx, func(e events.Event) {})
+	require.Match(t, `missing protocol scheme`, err.Error())
+
+	c := client.New(s.URL + `/ended`)
+	s.Close()
+	err = c.Subscribe(ctx, func(e events.Event) {})
+	require.Match(t, `connection refused`, err.Error())
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Nil(t, c.Subscribe(cctx, func(e events.Event) {}))
+}
+
+func TestClient_WithHost(t *testing.T) {
+	reg := register.NewRegistry()
+	produced := 0
+	reg.DataHash(`dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		if ctx.SetVersion(`1`) {
+			return nil
+		}
+		produced++
+		return vf.Map(`level`, ctx.Level(), `invocation`, ctx.InvocationID())
+	})
+	h, _ := routes.RegisterWith(reg)
+	s := httptest.NewServer(h)
+	defer s.Close()
+	c := client.New(s.URL, client.WithCache())
+
+	v, err := c.WithHost(hiera.HostInfo{Level: `common`, InvocationID: `1`}).DataHash(`dh`, nil)
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`level`, `common`, `invocation`, `1`), v)
+
+	// The invocation id doesn't affect the caching
+	_, err = c.WithHost(hiera.HostInfo{Level: `common`, InvocationID: `2`}).DataHash(`dh`, nil)
+	require.Nil(t, err)
+	require.Equal(t, 1, produced)
+
+	v, err = c.WithHost(hiera.HostInfo{Level: `other`}).DataHash(`dh`, nil)
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`level`, `other`, `invocation`, ``), v)
+	require.Equal(t, 2, produced)
+
+	v, err = c.DataHash(`dh`, nil)
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`level`, ``, `invocation`, ``), v)
+	require.Equal(t, 3, produced)
+}
+
+func TestLookupHandler(t *testing.T) {
+	reg := register.NewRegistry()
+	reg.LookupKey(`lk`, func(ctx hiera.ProviderContext, key string) dgo.Value {
+		switch key {
+		case `greeting`:
+			return vf.String(`hello`)
+		case `alias`:
+			key = `greeting`
+		case `loop`:
+		default:
+			return nil
+		}
+		v, err := ctx.Lookup(key)
+		if err != nil {
+			panic(err)
+		}
+		return v
+	})
+	h, _ := routes.RegisterWith(reg)
+	plugin := httptest.NewServer(h)
+	defer plugin.Close()
+
+	// The host answers lookups by calling the plugin and passes on the depth of the nested lookup
+	var host *httptest.Server
+	c := client.New(plugin.URL)
+	host = httptest.NewServer(client.LookupHandler(`secret`, func(key string, hi hiera.HostInfo) (dgo.Value, error) {
+		hc := c.WithHost(hiera.HostInfo{Callback: host.URL, CallbackToken: `secret`, Depth: hi.Depth})
+		return hc.LookupKey(`lk`, key, nil)
+	}))
+	defer host.Close()
+	hc := c.WithHost(hiera.HostInfo{Callback: host.URL, CallbackToken: `secret`})
+
+	v, err := hc.LookupKey(`lk`, `alias`, nil)
+	require.Nil(t, err)
+	require.Equal(t, `hello`, v)
+
+	v, err = hc.LookupKey(`lk`, `missing`, nil)
+	require.Nil(t, err)
+	require.True(t, v == nil)
+
+	_, err = hc.LookupKey(`lk`, `loop`, nil)
+	require.Match(t, `lookup of 'loop' exceeds the maximum lookup depth 16`, err.Error())
+
+	_, err = c.WithHost(hiera.HostInfo{Callback: host.URL, CallbackToken: `wrong`}).LookupKey(`lk`, `alias`, nil)
+	require.Match(t, `status 401`, err.Error())
+
+	resp, err := http.Get(host.URL + `?key=x&depth=17`)
+	require.Nil(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestLookupHandler_requests(t *testing.T) {
+	h := client.LookupHandler(``, func(key string, hi hiera.HostInfo) (dgo.Value, error) {
+		switch key {
+		case `fail`:
+			return nil, errors.New(`goodbye`)
+		case `nan`:
+			return vf.Float(math.NaN()), nil
+		case `none`:
+			return nil, nil
+		}
+		return vf.String(key), nil
+	})
+	serve := func(method, query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(method, `/?`+query, nil))
+		return rr
+	}
+
+	rr := serve(http.MethodGet, `key=x`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, `"x"`, rr.Body.String())
+	rr = serve(http.MethodPost, `key=x`)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	require.Equal(t, http.MethodGet, rr.Header().Get(`Allow`))
+	rr = serve(http.MethodGet, ``)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, "400 missing key\n", rr.Body.String())
+	rr = serve(http.MethodGet, `key=x&depth=17`)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, "400 lookup depth exceeds 16\n", rr.Body.String())
+	rr = serve(http.MethodGet, `key=fail`)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.Equal(t, "500 goodbye\n", rr.Body.String())
+	rr = serve(http.MethodGet, `key=nan`)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.Equal(t, "500 json: unsupported value: NaN\n", rr.Body.String())
+	rr = serve(http.MethodGet, `key=none`)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/lyraproj/hierasdk/events"
+)
+
+// Subscribe connects to the "/events" path of the plugin and calls the given actor with each change notification
+// that the plugin publishes. Cached values of the function that an event names, or all cached values when the event
+// doesn't name a function, are discarded before the actor is called.
+//
+// Subscribe blocks until the given context is done, which results in a nil error, or until the connection is lost.
+// A plugin may drop notifications for a subscriber that doesn't keep up, so a host must treat an error as a change
+// of all values.
+func (c *Client) Subscribe(ctx context.Context, actor func(events.Event)) error {
+	req, err := http.NewRequest(http.MethodGet, c.base+`/events`, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set(`Accept`, `text/event-stream`)
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return &Error{Status: resp.StatusCode, Message: resp.Status}
+	}
+	err = readEvents(bufio.NewScanner(resp.Body), func(e events.Event) {
+		c.cache.removeFunction(c.base, e)
+		actor(e)
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err == nil {
+		err = &Error{Status: resp.StatusCode, Message: `event stream ended`}
+	}
+	return err
+}
+
+// readEvents reads server-sent events of type "invalidate" from the given scanner and calls the actor with each
+// one. Comments and events of other types are ignored.
+func readEvents(s *bufio.Scanner, actor func(events.Event)) error {
+	eventType := ``
+	var data []string
+	for s.Scan() {
+		line := s.Text()
+		if line == `` {
+			if eventType == `invalidate` && len(data) > 0 {
+				var e events.Event
+				if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &e); err != nil {
+					return err
+				}
+				actor(e)
+			}
+			eventType = ``
+			data = nil
+			continue
+		}
+		if strings.HasPrefix(line, `:`) {
+			continue
+		}
+		field, value := line, ``
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], ` `)
+		}
+		switch field {
+		case `event`:
+			eventType = value
+		case `data`:
+			data = append(data, value)
+		}
+	}
+	return s.Err()
+}
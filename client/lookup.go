@@ -0,0 +1,62 @@
+package client
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/richjson"
+)
+
+// LookupHandler returns the handler that a host serves at the callback URL that it sends to plugins in the
+// Callback of a HostInfo. The handler answers the requests that hiera.ProviderContext.Lookup makes by calling the
+// given lookup function with the requested key and the HostInfo of the request, which holds the Depth of the nested
+// lookup that the host must pass on to the plugins that it calls while performing the lookup.
+//
+// Requests must carry the given token as a bearer token unless the token is empty. The lookup function returns nil
+// when the key isn't found. The value is sent in the rich JSON encoding.
+func LookupHandler(token string, lookup func(key string, host hiera.HostInfo) (dgo.Value, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set(`Allow`, http.MethodGet)
+			http.Error(w, `405 method not allowed`, http.StatusMethodNotAllowed)
+			return
+		}
+		if token != `` {
+			auth := r.Header.Get(`Authorization`)
+			if !strings.HasPrefix(auth, `Bearer `) ||
+				subtle.ConstantTimeCompare([]byte(auth[len(`Bearer `):]), []byte(token)) != 1 {
+				http.Error(w, `401 unauthorized`, http.StatusUnauthorized)
+				return
+			}
+		}
+		q := r.URL.Query()
+		key := q.Get(`key`)
+		if key == `` {
+			http.Error(w, `400 missing key`, http.StatusBadRequest)
+			return
+		}
+		host := hiera.HostInfoFromQuery(q)
+		if host.Depth > hiera.MaxLookupDepth {
+			http.Error(w, fmt.Sprintf(`400 lookup depth exceeds %d`, hiera.MaxLookupDepth), http.StatusBadRequest)
+			return
+		}
+		v, err := lookup(key, host)
+		if err == nil && v != nil {
+			var bs []byte
+			if bs, err = richjson.Marshal(v); err == nil {
+				w.Header().Set(`Content-Type`, richjson.ContentType)
+				_, _ = w.Write(bs)
+				return
+			}
+		}
+		if err != nil {
+			http.Error(w, `500 `+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, `404 value not found`, http.StatusNotFound)
+	})
+}
@@ -0,0 +1,128 @@
+// Package decrypt provides decryption of eyaml style encrypted blocks such as "ENC[PKCS7,MIIBiQYJKoZIhvc...]"
+// embedded in the values that lookup functions return.
+package decrypt
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+)
+
+type (
+	// Decryptor decrypts values that were encrypted using one specific encryption scheme
+	Decryptor interface {
+		// Scheme returns the name of the encryption scheme, e.g. "PKCS7", as it appears in the ENC[<scheme>,...] block
+		Scheme() string
+
+		// Decrypt decrypts the given base64 decoded data. The ProviderContext is passed so that the Decryptor can
+		// obtain key material from the options.
+		Decrypt(ctx hiera.ProviderContext, data []byte) ([]byte, error)
+	}
+)
+
+var encPattern = regexp.MustCompile(`ENC\[([A-Za-z0-9_]+),([A-Za-z0-9+/=\s]+)\]`)
+
+var lock sync.RWMutex
+var decryptors = map[string]Decryptor{}
+
+// Register registers the given Decryptor so that it is used for values encrypted with its scheme. A previously
+// registered Decryptor for the same scheme is replaced.
+func Register(d Decryptor) {
+	lock.Lock()
+	decryptors[d.Scheme()] = d
+	lock.Unlock()
+}
+
+func decryptorFor(scheme string) Decryptor {
+	lock.RLock()
+	d := decryptors[scheme]
+	lock.RUnlock()
+	if d == nil {
+		panic(fmt.Errorf(`no decryptor is registered for encryption scheme %q`, scheme))
+	}
+	return d
+}
+
+// Value returns the given value with all ENC[<scheme>,<base64 data>] blocks in strings replaced by their decrypted
+// content. A string that contained encrypted blocks is wrapped using vf.Sensitive. Maps and arrays are traversed
+// recursively. The value is returned unchanged if it contains no encrypted blocks, even when a string mentions
+// "ENC[". A decryption failure results in a panic.
+func Value(ctx hiera.ProviderContext, v dgo.Value) dgo.Value {
+	switch v := v.(type) {
+	case dgo.String:
+		s := v.GoString()
+		if !encPattern.MatchString(s) {
+			return v
+		}
+		return vf.Sensitive(vf.String(String(ctx, s)))
+	case dgo.Array:
+		changed := false
+		a := v.Map(func(e dgo.Value) interface{} {
+			d := Value(ctx, e)
+			if d != e {
+				changed = true
+			}
+			return d
+		})
+		if changed {
+			return a
+		}
+	case dgo.Map:
+		changed := false
+		m := v.Map(func(e dgo.MapEntry) interface{} {
+			d := Value(ctx, e.Value())
+			if d != e.Value() {
+				changed = true
+			}
+			return d
+		})
+		if changed {
+			return m
+		}
+	}
+	return v
+}
+
+// String returns the given string with all ENC[<scheme>,<base64 data>] blocks replaced by their decrypted content.
+// A decryption failure results in a panic.
+func String(ctx hiera.ProviderContext, s string) string {
+	return encPattern.ReplaceAllStringFunc(s, func(block string) string {
+		parts := encPattern.FindStringSubmatch(block)
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(parts[2]), ``))
+		if err != nil {
+			panic(fmt.Errorf(`unable to decode ENC[%s] block: %s`, parts[1], err.Error()))
+		}
+		plain, err := decryptorFor(parts[1]).Decrypt(ctx, data)
+		if err != nil {
+			panic(fmt.Errorf(`unable to decrypt ENC[%s] block: %w`, parts[1], err))
+		}
+		return string(plain)
+	})
+}
+
+// DataDig returns a DataDig function that decrypts the values returned by the given function
+func DataDig(f hiera.DataDig) hiera.DataDig {
+	return func(ctx hiera.ProviderContext, key dgo.Array) dgo.Value {
+		return Value(ctx, f(ctx, key))
+	}
+}
+
+// DataHash returns a DataHash function that decrypts the values returned by the given function
+func DataHash(f hiera.DataHash) hiera.DataHash {
+	return func(ctx hiera.ProviderContext) dgo.Value {
+		return Value(ctx, f(ctx))
+	}
+}
+
+// LookupKey returns a LookupKey function that decrypts the values returned by the given function
+func LookupKey(f hiera.LookupKey) hiera.LookupKey {
+	return func(ctx hiera.ProviderContext, key string) dgo.Value {
+		return Value(ctx, f(ctx, key))
+	}
+}
@@ -0,0 +1,49 @@
+package decrypt
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// keyFile is a key that was parsed from a file together with the modification time and size of that file
+type keyFile struct {
+	modTime time.Time
+	size    int64
+	key     interface{}
+}
+
+var keyLock sync.Mutex
+var keyFiles = map[string]*keyFile{}
+
+// loadKey returns the key that the given parse function produces from the content of the file at the given path.
+// The key is cached using the kind and the path and is parsed again only when the file's modification time or size
+// changes, so that a data hash with many encrypted blocks doesn't read and parse the key for each block.
+func loadKey(kind, path string, parse func(content []byte) (interface{}, error)) (interface{}, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	ck := kind + `:` + path
+	keyLock.Lock()
+	kf := keyFiles[ck]
+	keyLock.Unlock()
+	if kf != nil && kf.modTime.Equal(fi.ModTime()) && kf.size == fi.Size() {
+		return kf.key, nil
+	}
+
+	/* #nosec */
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parse(content)
+	if err != nil {
+		return nil, err
+	}
+	keyLock.Lock()
+	keyFiles[ck] = &keyFile{modTime: fi.ModTime(), size: fi.Size(), key: key}
+	keyLock.Unlock()
+	return key, nil
+}
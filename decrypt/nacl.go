@@ -0,0 +1,154 @@
+package decrypt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/lyraproj/hierasdk/hiera"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const nonceSize = 24
+
+// Secretbox is the Decryptor for the SECRETBOX scheme. Values are encrypted with NaCl secretbox using a
+// symmetric key that is read from the file given by the option "secretbox_key". The file must contain the base64
+// encoded 32 byte key. The encrypted data is the 24 byte nonce followed by the sealed box.
+type Secretbox struct{}
+
+// X25519 is the Decryptor for the X25519 scheme. Values are encrypted for a recipient's X25519 public key using
+// an anonymous NaCl box, which makes it possible to encrypt values without access to the private key. The private
+// key is read from the file given by the option "x25519_private_key". The file must contain the base64 encoded
+// 32 byte key.
+type X25519 struct{}
+
+func init() {
+	Register(Secretbox{})
+	Register(X25519{})
+}
+
+// Scheme returns "SECRETBOX"
+func (Secretbox) Scheme() string {
+	return `SECRETBOX`
+}
+
+// Decrypt opens the given nonce prefixed secretbox
+func (Secretbox) Decrypt(ctx hiera.ProviderContext, data []byte) ([]byte, error) {
+	key, err := readKeyOption(ctx, `secretbox_key`)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < nonceSize {
+		return nil, errors.New(`message is too short`)
+	}
+	var nonce [nonceSize]byte
+	copy(nonce[:], data)
+	plain, ok := secretbox.Open(nil, data[nonceSize:], &nonce, key)
+	if !ok {
+		return nil, errors.New(`message authentication failed`)
+	}
+	return plain, nil
+}
+
+// Scheme returns "X25519"
+func (X25519) Scheme() string {
+	return `X25519`
+}
+
+// Decrypt opens the given anonymous box
+func (X25519) Decrypt(ctx hiera.ProviderContext, data []byte) ([]byte, error) {
+	priv, err := readKeyOption(ctx, `x25519_private_key`)
+	if err != nil {
+		return nil, err
+	}
+	var pub [32]byte
+	curve25519.ScalarBaseMult(&pub, priv)
+	plain, ok := box.OpenAnonymous(nil, data, &pub, priv)
+	if !ok {
+		return nil, errors.New(`message authentication failed`)
+	}
+	return plain, nil
+}
+
+// EncryptSecretbox encrypts the given value using the given secretbox key and returns the resulting
+// ENC[SECRETBOX,...] block.
+func EncryptSecretbox(key *[32]byte, value []byte) (string, error) {
+	var nonce [nonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return ``, err
+	}
+	return encBlock(`SECRETBOX`, secretbox.Seal(nonce[:], value, &nonce, key)), nil
+}
+
+// EncryptX25519 encrypts the given value for the recipient with the given public key and returns the resulting
+// ENC[X25519,...] block.
+func EncryptX25519(publicKey *[32]byte, value []byte) (string, error) {
+	data, err := box.SealAnonymous(nil, value, publicKey, rand.Reader)
+	if err != nil {
+		return ``, err
+	}
+	return encBlock(`X25519`, data), nil
+}
+
+// GenerateSecretboxKey returns a new random secretbox key
+func GenerateSecretboxKey() (*[32]byte, error) {
+	var key [32]byte
+	if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GenerateX25519Key returns a new random X25519 key pair
+func GenerateX25519Key() (publicKey, privateKey *[32]byte, err error) {
+	return box.GenerateKey(rand.Reader)
+}
+
+// EncodeKey returns the base64 encoding of the given key, which is the format used in key files
+func EncodeKey(key *[32]byte) string {
+	return base64.StdEncoding.EncodeToString(key[:])
+}
+
+// ReadKeyFile reads a base64 encoded 32 byte key from the given file
+func ReadKeyFile(path string) (*[32]byte, error) {
+	/* #nosec */
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseKey(path, content)
+}
+
+func parseKey(path string, content []byte) (*[32]byte, error) {
+	bs, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(bs) != 32 {
+		return nil, fmt.Errorf(`%s: expected a base64 encoded 32 byte key`, path)
+	}
+	var key [32]byte
+	copy(key[:], bs)
+	return &key, nil
+}
+
+func readKeyOption(ctx hiera.ProviderContext, option string) (*[32]byte, error) {
+	path, err := optionPath(ctx, option)
+	if err != nil {
+		return nil, err
+	}
+	key, err := loadKey(`nacl key`, path, func(content []byte) (interface{}, error) {
+		return parseKey(path, content)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key.(*[32]byte), nil
+}
+
+func encBlock(scheme string, data []byte) string {
+	return `ENC[` + scheme + `,` + base64.StdEncoding.EncodeToString(data) + `]`
+}
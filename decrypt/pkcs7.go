@@ -0,0 +1,106 @@
+package decrypt
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"path/filepath"
+
+	"github.com/lyraproj/hierasdk/hiera"
+	"go.mozilla.org/pkcs7"
+)
+
+// PKCS7 is the Decryptor for the PKCS7 scheme used by hiera-eyaml. It reads the PEM encoded certificate and RSA
+// private key from the files given by the options "pkcs7_public_key" and "pkcs7_private_key".
+type PKCS7 struct{}
+
+func init() {
+	Register(PKCS7{})
+}
+
+// Scheme returns "PKCS7"
+func (PKCS7) Scheme() string {
+	return `PKCS7`
+}
+
+// Decrypt decrypts the given DER encoded PKCS7 enveloped data
+func (PKCS7) Decrypt(ctx hiera.ProviderContext, data []byte) ([]byte, error) {
+	cert, err := readCertificate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := readPrivateKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p7, err := pkcs7.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return p7.Decrypt(cert, key)
+}
+
+// optionPath returns the key file given by the option with the given name. A relative path is resolved in the same
+// way as the paths of the data files, i.e. relative to the datadir when the host sent one, and relative to the
+// directory of hiera.yaml otherwise. A missing option results in a *hiera.OptionError.
+func optionPath(ctx hiera.ProviderContext, option string) (string, error) {
+	r := ctx.Options()
+	path, err := r.String(option, ``)
+	if err != nil {
+		return ``, err
+	}
+	if path == `` {
+		return ``, hiera.NewOptionError(option, `required option is missing`)
+	}
+	if dd := ctx.DataDir(); dd != `` && !filepath.IsAbs(path) {
+		return filepath.Join(dd, path), nil
+	}
+	return r.ResolvePath(path), nil
+}
+
+func decodePEM(path string, content []byte) (*pem.Block, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf(`%s: no PEM data found`, path)
+	}
+	return block, nil
+}
+
+func readCertificate(ctx hiera.ProviderContext) (*x509.Certificate, error) {
+	path, err := optionPath(ctx, `pkcs7_public_key`)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := loadKey(`certificate`, path, func(content []byte) (interface{}, error) {
+		block, err := decodePEM(path, content)
+		if err != nil {
+			return nil, err
+		}
+		return x509.ParseCertificate(block.Bytes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cert.(*x509.Certificate), nil
+}
+
+func readPrivateKey(ctx hiera.ProviderContext) (crypto.PrivateKey, error) {
+	path, err := optionPath(ctx, `pkcs7_private_key`)
+	if err != nil {
+		return nil, err
+	}
+	return loadKey(`private key`, path, func(content []byte) (interface{}, error) {
+		block, err := decodePEM(path, content)
+		if err != nil {
+			return nil, err
+		}
+		if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+			return key, nil
+		}
+		if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+			return key, nil
+		}
+		return nil, hiera.NewOptionError(`pkcs7_private_key`, `file does not contain an RSA private key`)
+	})
+}
@@ -0,0 +1,97 @@
+// Package events provides the change notifications that a plugin publishes to tell its host that values that the
+// host has obtained from the plugin's functions may have changed. The notifications are served to the host as
+// server-sent events on the "/events" path.
+package events
+
+import (
+	"sync"
+)
+
+// subscriptionBuffer is the number of events that can be queued for a subscriber
+const subscriptionBuffer = 64
+
+type (
+	// Event tells the host that values obtained from a function may have changed
+	Event struct {
+		// Kind is the function type, i.e. "data_dig", "data_hash", or "lookup_key". An empty Kind together with
+		// an empty Function means that values obtained from all functions may have changed.
+		Kind string `json:"kind,omitempty"`
+
+		// Function is the name of the function
+		Function string `json:"function,omitempty"`
+
+		// Reason is a human readable description of the change
+		Reason string `json:"reason,omitempty"`
+	}
+
+	// Broker distributes published events to all current subscribers. The zero value is not usable, use NewBroker.
+	Broker struct {
+		lock   sync.Mutex
+		subs   map[chan Event]bool
+		closed bool
+	}
+)
+
+var global = NewBroker()
+
+// NewBroker returns a new Broker without subscribers
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[chan Event]bool)}
+}
+
+// Global returns the Broker that serves the "/events" path of the plugin
+func Global() *Broker {
+	return global
+}
+
+// Publish publishes the given event to the global Broker
+func Publish(e Event) {
+	global.Publish(e)
+}
+
+// Publish sends the given event to all current subscribers. A subscriber that doesn't keep up with the events is
+// unsubscribed and its channel is closed. A host must therefore treat a lost connection as a change of all values.
+func (b *Broker) Publish(e Event) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel that receives all events published after this call, and a function that ends the
+// subscription. The channel is closed when the subscription ends.
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriptionBuffer)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = true
+	return ch, func() {
+		b.lock.Lock()
+		if b.subs[ch] {
+			delete(b.subs, ch)
+			close(ch)
+		}
+		b.lock.Unlock()
+	}
+}
+
+// Close ends all subscriptions. Subscriptions made after Close are ended immediately.
+func (b *Broker) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
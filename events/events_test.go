@@ -0,0 +1,123 @@
+package events_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/hierasdk/events"
+)
+
+func TestBroker(t *testing.T) {
+	b := events.NewBroker()
+	ch1, cancel1 := b.Subscribe()
+	ch2, cancel2 := b.Subscribe()
+	e := events.Event{Kind: `data_hash`, Function: `f`, Reason: `test`}
+	b.Publish(e)
+	require.Equal(t, e, <-ch1)
+	require.Equal(t, e, <-ch2)
+
+	cancel1()
+	cancel1()
+	_, ok := <-ch1
+	require.False(t, ok)
+
+	b.Close()
+	_, ok = <-ch2
+	require.False(t, ok)
+	cancel2()
+
+	ch3, _ := b.Subscribe()
+	_, ok = <-ch3
+	require.False(t, ok)
+}
+
+func TestBroker_slowSubscriber(t *testing.T) {
+	b := events.NewBroker()
+	ch, cancel := b.Subscribe()
+	defer cancel()
+	n := 0
+	for i := 0; i < 100; i++ {
+		b.Publish(events.Event{})
+	}
+	for range ch {
+		n++
+	}
+	require.True(t, n < 100)
+}
+
+func TestFileWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `events`)
+	require.Nil(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, `data.yaml`)
+
+	b := events.NewBroker()
+	ch, cancel := b.Subscribe()
+	defer cancel()
+	w := events.NewFileWatcher(b, time.Hour)
+	defer w.Stop()
+	e := events.Event{Kind: `data_hash`, Function: `yaml_data`}
+	w.Watch(path, e)
+	w.Watch(path, e)
+
+	w.Check()
+	require.Equal(t, 0, len(ch))
+
+	require.Nil(t, ioutil.WriteFile(path, []byte(`a: 1`), 0600))
+	w.Check()
+	e.Reason = `file created: ` + path
+	require.Equal(t, e, <-ch)
+
+	require.Nil(t, ioutil.WriteFile(path, []byte(`a: 12`), 0600))
+	w.Check()
+	e.Reason = `file modified: ` + path
+	require.Equal(t, e, <-ch)
+
+	require.Nil(t, os.Remove(path))
+	w.Check()
+	e.Reason = `file removed: ` + path
+	require.Equal(t, e, <-ch)
+	require.Equal(t, 0, len(ch))
+}
+
+func TestFileWatcher_poll(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `events`)
+	require.Nil(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, `data.yaml`)
+
+	b := events.NewBroker()
+	ch, cancel := b.Subscribe()
+	defer cancel()
+	w := events.NewFileWatcher(b, time.Millisecond)
+	e := events.Event{Kind: `data_hash`, Function: `yaml_data`}
+	w.Watch(path, e)
+
+	require.Nil(t, ioutil.WriteFile(path, []byte(`a: 1`), 0600))
+	select {
+	case r := <-ch:
+		require.Equal(t, `file created: `+path, r.Reason)
+	case <-time.After(5 * time.Second):
+		t.Fatal(`change was not detected by polling`)
+	}
+
+	// No events are published once the polling has stopped. A tick may race with the Stop so the removal happens
+	// when the polling goroutine has had time to return.
+	w.Stop()
+	w.Stop()
+	time.Sleep(20 * time.Millisecond)
+	for len(ch) > 0 {
+		<-ch
+	}
+	require.Nil(t, os.Remove(path))
+	select {
+	case r := <-ch:
+		t.Fatalf(`unexpected event after Stop: %v`, r)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,124 @@
+package events
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is the interval at which the global FileWatcher checks its files
+const DefaultPollInterval = 2 * time.Second
+
+type (
+	// FileWatcher polls files for changes and publishes events when a file is created, removed, or modified.
+	FileWatcher struct {
+		broker   *Broker
+		interval time.Duration
+		lock     sync.Mutex
+		files    map[string]*watchedFile
+		stop     chan struct{}
+	}
+
+	watchedFile struct {
+		state  fileState
+		events map[Event]bool
+	}
+
+	fileState struct {
+		exists  bool
+		size    int64
+		modTime int64
+	}
+)
+
+var globalWatcher = NewFileWatcher(global, DefaultPollInterval)
+
+// NewFileWatcher returns a FileWatcher that publishes events to the given Broker. Files are checked at the given
+// interval once the first file is watched.
+func NewFileWatcher(b *Broker, interval time.Duration) *FileWatcher {
+	return &FileWatcher{broker: b, interval: interval, files: make(map[string]*watchedFile)}
+}
+
+// WatchFile makes the global FileWatcher publish the given event when the given file changes
+func WatchFile(path string, e Event) {
+	globalWatcher.Watch(path, e)
+}
+
+// Watch makes the watcher publish the given event when the given file changes. The Reason of the event is set to
+// describe the change. Watching a file that doesn't exist is allowed, its creation is a change. Watching the same
+// file for the same event more than once has no effect.
+func (w *FileWatcher) Watch(path string, e Event) {
+	path = filepath.Clean(path)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	wf, ok := w.files[path]
+	if !ok {
+		wf = &watchedFile{state: stat(path), events: make(map[Event]bool)}
+		w.files[path] = wf
+	}
+	wf.events[e] = true
+	if w.stop == nil {
+		w.stop = make(chan struct{})
+		go w.poll(w.stop)
+	}
+}
+
+// Stop stops the polling. It is restarted when another file is watched.
+func (w *FileWatcher) Stop() {
+	w.lock.Lock()
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+	w.lock.Unlock()
+}
+
+func (w *FileWatcher) poll(stop chan struct{}) {
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			w.Check()
+		}
+	}
+}
+
+// Check checks all watched files immediately and publishes events for the files that changed
+func (w *FileWatcher) Check() {
+	var changed []Event
+	w.lock.Lock()
+	for path, wf := range w.files {
+		s := stat(path)
+		if s == wf.state {
+			continue
+		}
+		reason := `file modified: ` + path
+		switch {
+		case !s.exists:
+			reason = `file removed: ` + path
+		case !wf.state.exists:
+			reason = `file created: ` + path
+		}
+		wf.state = s
+		for e := range wf.events {
+			e.Reason = reason
+			changed = append(changed, e)
+		}
+	}
+	w.lock.Unlock()
+	for _, e := range changed {
+		w.broker.Publish(e)
+	}
+}
+
+func stat(path string) fileState {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, size: fi.Size(), modTime: fi.ModTime().UnixNano()}
+}
@@ -1,5 +1,10 @@
 module github.com/lyraproj/hierasdk
 
-require github.com/lyraproj/dgo v0.2.0
+require (
+	github.com/lyraproj/dgo v0.2.0
+	go.mozilla.org/pkcs7 v0.9.0
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 go 1.13
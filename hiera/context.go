@@ -3,13 +3,15 @@ package hiera
 
 import (
 	"net/url"
+	"path/filepath"
 
 	"github.com/lyraproj/dgo/dgo"
 	"github.com/lyraproj/dgo/vf"
 )
 
 type (
-	// ProviderContext provides utility functions to a provider function
+	// ProviderContext provides utility functions to a provider function. Methods may be added to the interface, so
+	// an implementation outside of this module should embed a ProviderContext created using NewProviderContext.
 	ProviderContext interface {
 		// Option returns the given option or nil if no such option exists
 		Option(option string) dgo.Value
@@ -33,28 +35,117 @@ type (
 		// returns 0.0, false
 		FloatOption(option string) (float64, bool)
 
-		// ToData converts the given value into Data
+		// Options returns an OptionReader for the options of the context. Unlike the other option accessors, the
+		// OptionReader supports defaults, coercion, and more types, and returns errors that name the offending
+		// option.
+		Options() OptionReader
+
+		// AllOptions returns all options of the context as a map. The map is empty when the host sent no options.
+		AllOptions() dgo.Map
+
+		// ConfigPath returns the path of the hiera.yaml file that declares the hierarchy level that the function was
+		// called for, or an empty string if the host didn't send it. The host sends the path in the "config_path"
+		// query parameter of the request.
+		ConfigPath() string
+
+		// DataDir returns the datadir of the hierarchy level that the function was called for, or an empty string
+		// if the host didn't send it. A relative datadir is resolved relative to the directory of ConfigPath.
+		DataDir() string
+
+		// Level returns the name of the hierarchy level that the function was called for, or an empty string if the
+		// host didn't send it.
+		Level() string
+
+		// Environment returns the name of the environment that the lookup is performed in, or an empty string if
+		// the host didn't send it.
+		Environment() string
+
+		// InvocationID returns the id that the host assigned to the lookup that the call is part of, or an empty
+		// string if the host didn't send it. It is intended for diagnostics, e.g. to correlate log entries.
+		InvocationID() string
+
+		// Lookup asks the host to look up the given key, e.g. to resolve an alias. The returned value is nil when
+		// the key isn't found. An error is returned when the host doesn't accept lookups, when the lookup fails,
+		// and when the lookup would be nested deeper than MaxLookupDepth.
+		Lookup(key string) (dgo.Value, error)
+
+		// ToData converts the given value into Data. See the package level ToData function for details.
 		ToData(value interface{}) dgo.Value
+
+		// SetVersion declares the version of the value that the function produces, e.g. a file modification time,
+		// a content hash, or a backend revision. The version is used to answer conditional requests from the host.
+		// The returned boolean is true when the host already has the value of the given version, in which case the
+		// function may return nil instead of producing the value. A StreamingDataHash must call SetVersion before
+		// it yields its first entry.
+		SetVersion(version string) bool
+
+		// Version returns the version declared using SetVersion or an empty string if no version was declared
+		Version() string
+
+		// WatchFile asks the plugin to notify the host when the given file is created, removed, or modified so
+		// that the host can discard the values that it has obtained from the function.
+		WatchFile(path string)
+
+		// Invalidate notifies the host that values that it has obtained from the function may have changed. It
+		// may be called after the function has returned, e.g. from a goroutine that listens to a backend.
+		Invalidate(reason string)
+	}
+
+	// Notifier receives the change notifications that a function emits using its ProviderContext
+	Notifier interface {
+		// WatchFile starts watching the given file
+		WatchFile(path string)
+
+		// Invalidate publishes a change notification with the given reason
+		Invalidate(reason string)
 	}
 
+	// ContextOption configures the ProviderContext created by NewProviderContext
+	ContextOption func(*providerContext)
+
 	providerContext struct {
-		options dgo.Map
+		options    dgo.Map
+		host       HostInfo
+		version    string
+		hasVersion func(version string) bool
+		notifier   Notifier
 	}
 )
 
-// NewProviderContext creates a context containing the values of the the "options" key in the given url.Values.
-func NewProviderContext(q url.Values) ProviderContext {
-	var opts dgo.Map
+// WithVersionCheck makes the SetVersion method of the ProviderContext use the given function to determine if the
+// host already has the value of a given version.
+func WithVersionCheck(hasVersion func(version string) bool) ContextOption {
+	return func(c *providerContext) {
+		c.hasVersion = hasVersion
+	}
+}
+
+// WithNotifier makes the ProviderContext send the change notifications of the function to the given Notifier.
+// Without a Notifier, the notifications are ignored.
+func WithNotifier(n Notifier) ContextOption {
+	return func(c *providerContext) {
+		c.notifier = n
+	}
+}
+
+// NewProviderContext creates a context containing the values of the the "options" key in the given url.Values and
+// the HostInfo that the url.Values contain.
+func NewProviderContext(q url.Values, opts ...ContextOption) ProviderContext {
+	c := &providerContext{}
 	if jo := q.Get(`options`); jo != `` {
 		v, err := vf.UnmarshalJSON([]byte(jo))
 		if err != nil {
 			panic(err)
 		}
 		if om, ok := v.(dgo.Map); ok {
-			opts = om
+			c.options = om
 		}
 	}
-	return &providerContext{options: opts}
+	c.host = HostInfoFromQuery(q)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *providerContext) Option(name string) (d dgo.Value) {
@@ -96,6 +187,66 @@ func (c *providerContext) BoolOption(name string) (b bool, ok bool) {
 	return
 }
 
+func (c *providerContext) Options() OptionReader {
+	return NewOptionReader(c)
+}
+
+func (c *providerContext) AllOptions() dgo.Map {
+	if c.options == nil {
+		return vf.Map()
+	}
+	return c.options
+}
+
+func (c *providerContext) ConfigPath() string {
+	return c.host.ConfigPath
+}
+
+func (c *providerContext) DataDir() string {
+	dd := c.host.DataDir
+	if dd != `` && !filepath.IsAbs(dd) && c.host.ConfigPath != `` {
+		dd = filepath.Join(filepath.Dir(c.host.ConfigPath), dd)
+	}
+	return dd
+}
+
+func (c *providerContext) Level() string {
+	return c.host.Level
+}
+
+func (c *providerContext) Environment() string {
+	return c.host.Environment
+}
+
+func (c *providerContext) InvocationID() string {
+	return c.host.InvocationID
+}
+
+func (c *providerContext) Lookup(key string) (dgo.Value, error) {
+	return c.host.lookup(key)
+}
+
 func (c *providerContext) ToData(value interface{}) dgo.Value {
-	return vf.Value(value)
+	return ToData(value)
+}
+
+func (c *providerContext) SetVersion(version string) bool {
+	c.version = version
+	return version != `` && c.hasVersion != nil && c.hasVersion(version)
+}
+
+func (c *providerContext) Version() string {
+	return c.version
+}
+
+func (c *providerContext) WatchFile(path string) {
+	if c.notifier != nil {
+		c.notifier.WatchFile(path)
+	}
+}
+
+func (c *providerContext) Invalidate(reason string) {
+	if c.notifier != nil {
+		c.notifier.Invalidate(reason)
+	}
 }
@@ -1,7 +1,10 @@
 package hiera
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	require "github.com/lyraproj/dgo/dgo_test"
 	"github.com/lyraproj/dgo/vf"
@@ -42,3 +45,68 @@ func TestProviderContext_BoolOption(t *testing.T) {
 	_, ok = c.BoolOption(`s`)
 	require.False(t, ok)
 }
+
+func TestProviderContext_AllOptions(t *testing.T) {
+	c := &providerContext{options: vf.Map(`s`, `a`, `b`, false)}
+	require.Equal(t, vf.Map(`s`, `a`, `b`, false), c.AllOptions())
+	require.Equal(t, vf.Map(), (&providerContext{}).AllOptions())
+}
+
+func TestProviderContext_SetVersion(t *testing.T) {
+	c := NewProviderContext(nil)
+	require.False(t, c.SetVersion(`1`))
+	require.Equal(t, `1`, c.Version())
+
+	c = NewProviderContext(nil, WithVersionCheck(func(v string) bool { return v == `2` }))
+	require.Equal(t, ``, c.Version())
+	require.False(t, c.SetVersion(`1`))
+	require.True(t, c.SetVersion(`2`))
+	require.Equal(t, `2`, c.Version())
+	require.False(t, c.SetVersion(``))
+}
+
+type testNotifier struct {
+	files   []string
+	reasons []string
+}
+
+func (n *testNotifier) WatchFile(path string) {
+	n.files = append(n.files, path)
+}
+
+func (n *testNotifier) Invalidate(reason string) {
+	n.reasons = append(n.reasons, reason)
+}
+
+func TestProviderContext_notifications(t *testing.T) {
+	// Without a notifier, notifications are ignored
+	c := NewProviderContext(nil)
+	c.WatchFile(`/a`)
+	c.Invalidate(`changed`)
+
+	n := &testNotifier{}
+	c = NewProviderContext(nil, WithNotifier(n))
+	c.WatchFile(`/a`)
+	c.Invalidate(`changed`)
+	require.Equal(t, []string{`/a`}, n.files)
+	require.Equal(t, []string{`changed`}, n.reasons)
+}
+
+func TestProviderContext_Lookup_timeout(t *testing.T) {
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer s.Close()
+	defer close(release)
+
+	require.Equal(t, LookupTimeout, lookupClient.Timeout)
+	lookupClient.Timeout = 50 * time.Millisecond
+	defer func() { lookupClient.Timeout = LookupTimeout }()
+	c := &providerContext{host: HostInfo{Callback: s.URL}}
+	_, err := c.Lookup(`stalled`)
+	if err == nil {
+		t.Fatal(`expected a timeout`)
+	}
+	require.Match(t, `Client.Timeout exceeded`, err.Error())
+}
@@ -0,0 +1,212 @@
+package hiera
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+)
+
+var (
+	valueType    = reflect.TypeOf((*dgo.Value)(nil)).Elem()
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// ToData converts the given Go value into a dgo.Value that can be sent to the host. Values that already are a
+// dgo.Value are returned unchanged. Pointers and interfaces are dereferenced, nil becomes vf.Nil, []byte becomes a
+// binary value, time.Time becomes a time value that a plain JSON response encodes as an RFC 3339 string,
+// time.Duration becomes a string such as "1m30s", slices and arrays become arrays, and maps become maps.
+//
+// A struct becomes a map with one entry per exported field. The key of the entry is the name in the field's "hiera"
+// tag, or in its "json" tag when it has no "hiera" tag, or else the field's name. A field is skipped when that name
+// is "-", and when the tag has the "omitempty" flag and the field holds false, 0, an empty string, a nil pointer or
+// interface, or an empty slice, array, or map. A field with the "sensitive" flag in its "hiera" tag is wrapped using
+// vf.Sensitive. The fields of an embedded struct without a name in its tag are added to the map of the embedding
+// struct.
+//
+// Unlike register.DecodeOptions, which lowercases the name of a field that has no "hiera" tag, ToData uses the name
+// verbatim so that the result matches what encoding/json produces for the same struct. A struct that is used both
+// for options and for results should therefore tag every field.
+//
+// ToData panics if the value contains channels, functions, or other values that have no data representation, and if
+// it contains an unsigned integer that overflows int64.
+func ToData(value interface{}) dgo.Value {
+	if v, ok := value.(dgo.Value); ok {
+		return v
+	}
+	return toData(reflect.ValueOf(value))
+}
+
+func toData(rv reflect.Value) dgo.Value {
+	if !rv.IsValid() {
+		return vf.Nil
+	}
+	t := rv.Type()
+	if t.Implements(valueType) {
+		if v, ok := rv.Interface().(dgo.Value); ok && v != nil {
+			return v
+		}
+		return vf.Nil
+	}
+	switch t {
+	case timeType:
+		return vf.Time(rv.Interface().(time.Time))
+	case durationType:
+		return vf.String(time.Duration(rv.Int()).String())
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return vf.Nil
+		}
+		return toData(rv.Elem())
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		return compositeToData(rv)
+	}
+	return scalarToData(rv)
+}
+
+// scalarToData converts booleans, strings and numbers
+func scalarToData(rv reflect.Value) dgo.Value {
+	switch rv.Kind() {
+	case reflect.Bool:
+		return vf.Boolean(rv.Bool())
+	case reflect.String:
+		return vf.String(rv.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return vf.Integer(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			panic(fmt.Errorf(`value %d overflows int64`, u))
+		}
+		return vf.Integer(int64(u))
+	case reflect.Float32, reflect.Float64:
+		return vf.Float(rv.Float())
+	}
+	panic(fmt.Errorf(`value of type %s cannot be converted to data`, rv.Type()))
+}
+
+// compositeToData converts slices, arrays, maps and structs
+func compositeToData(rv reflect.Value) dgo.Value {
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			return vf.Nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return vf.Binary(rv.Bytes(), true)
+		}
+		return arrayToData(rv)
+	case reflect.Array:
+		return arrayToData(rv)
+	case reflect.Map:
+		if rv.IsNil() {
+			return vf.Nil
+		}
+		m := vf.MutableMap(nil)
+		for _, k := range rv.MapKeys() {
+			m.Put(toData(k), toData(rv.MapIndex(k)))
+		}
+		m.Freeze()
+		return m
+	default:
+		m := vf.MutableMap(nil)
+		structToData(rv, m)
+		m.Freeze()
+		return m
+	}
+}
+
+func arrayToData(rv reflect.Value) dgo.Value {
+	vs := make([]dgo.Value, rv.Len())
+	for i := range vs {
+		vs[i] = toData(rv.Index(i))
+	}
+	return vf.Array(vs)
+}
+
+func structToData(rv reflect.Value, m dgo.Map) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != `` && !sf.Anonymous {
+			continue
+		}
+		tag, ok := sf.Tag.Lookup(`hiera`)
+		if !ok {
+			tag = sf.Tag.Get(`json`)
+		}
+		parts := strings.Split(tag, `,`)
+		name := parts[0]
+		if name == `-` {
+			continue
+		}
+		fv := rv.Field(i)
+		if sf.Anonymous && name == `` && embeddedToData(sf, fv, m) {
+			continue
+		}
+		if name == `` {
+			name = sf.Name
+		}
+		fieldToData(name, parts[1:], fv, m)
+	}
+}
+
+// embeddedToData adds the fields of an embedded struct to the given map. It returns true when the field was consumed
+// and should not be added under its own name.
+func embeddedToData(sf reflect.StructField, fv reflect.Value, m dgo.Map) bool {
+	for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+		fv = fv.Elem()
+	}
+	if fv.Kind() == reflect.Struct {
+		structToData(fv, m)
+		return true
+	}
+	return sf.PkgPath != ``
+}
+
+// fieldToData adds the value of a struct field to the given map under the given name unless the flags of the field
+// tell it to be omitted
+func fieldToData(name string, flags []string, fv reflect.Value, m dgo.Map) {
+	sensitive := false
+	for _, flag := range flags {
+		switch flag {
+		case `omitempty`:
+			if isEmpty(fv) {
+				return
+			}
+		case `sensitive`:
+			sensitive = true
+		}
+	}
+	v := toData(fv)
+	if sensitive {
+		v = vf.Sensitive(v)
+	}
+	m.Put(name, v)
+}
+
+// isEmpty returns true for the values that the "omitempty" flag omits
+func isEmpty(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return rv.IsNil()
+	}
+	return false
+}
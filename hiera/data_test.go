@@ -0,0 +1,115 @@
+package hiera_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+)
+
+type Base struct {
+	ID int `json:"id"`
+}
+
+type record struct {
+	Base
+	Name     string            `json:"name"`
+	Alias    string            `hiera:"alias" json:"ignored"`
+	Secret   string            `hiera:"secret,sensitive"`
+	Count    int               `json:"count,omitempty"`
+	Ratio    float32           `json:"ratio,omitempty"`
+	Enabled  bool              `json:"enabled,omitempty"`
+	Ptr      *string           `json:"ptr,omitempty"`
+	List     []int             `json:"list,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Skipped  string            `json:"-"`
+	Raw      []byte
+	Timeout  time.Duration
+	At       time.Time
+	Value    dgo.Value
+	Any      interface{}
+	internal string
+}
+
+type Name string
+
+type nested struct {
+	*Base
+	Name
+	Size  uint      `json:"size,omitempty"`
+	At    time.Time `json:"at,omitempty"`
+	Value dgo.Value
+	Ratio float64
+	List  []int
+	Map   map[string]int
+}
+
+func TestToData(t *testing.T) {
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := `p`
+	r := &record{
+		Base:     Base{ID: 7},
+		Name:     `n`,
+		Alias:    `a`,
+		Secret:   `s`,
+		Ptr:      &s,
+		Skipped:  `x`,
+		Raw:      []byte{1, 2},
+		Timeout:  90 * time.Second,
+		At:       at,
+		Value:    vf.Values(1),
+		Any:      []uint8{3},
+		internal: `i`,
+	}
+	require.Equal(t, vf.Map(
+		`id`, 7,
+		`name`, `n`,
+		`alias`, `a`,
+		`secret`, vf.Sensitive(`s`),
+		`ptr`, `p`,
+		`Raw`, vf.Binary([]byte{1, 2}, true),
+		`Timeout`, `1m30s`,
+		`At`, vf.Time(at),
+		`Value`, vf.Values(1),
+		`Any`, vf.Binary([]byte{3}, true),
+	), hiera.ToData(r))
+
+	require.Equal(t, vf.Nil, hiera.ToData(nil))
+	require.Equal(t, vf.Nil, hiera.ToData((*record)(nil)))
+	require.Equal(t, vf.Values(1, `a`, nil), hiera.ToData([]interface{}{1, `a`, nil}))
+	require.Equal(t, vf.Values(1, 2), hiera.ToData([2]uint{1, 2}))
+	require.Equal(t, vf.Map(1, true), hiera.ToData(map[int]bool{1: true}))
+	require.Equal(t, vf.String(`x`), hiera.ToData(vf.String(`x`)))
+	require.Panic(t, func() { hiera.ToData(make(chan int)) }, `cannot be converted to data`)
+	require.Equal(t, vf.Integer(math.MaxInt64), hiera.ToData(uint64(math.MaxInt64)))
+	require.Panic(t, func() { hiera.ToData(uint64(math.MaxInt64) + 1) }, `value 9223372036854775808 overflows int64`)
+	require.Panic(t, func() { hiera.ToData([]uint64{math.MaxUint64}) }, `overflows int64`)
+}
+
+func TestToData_nested(t *testing.T) {
+	require.Equal(t, vf.Map(
+		`id`, 3,
+		`Name`, `n`,
+		`size`, 2,
+		`at`, vf.Time(time.Time{}),
+		`Value`, nil,
+		`Ratio`, 0.5,
+		`List`, nil,
+		`Map`, nil,
+	), hiera.ToData(nested{Base: &Base{ID: 3}, Name: `n`, Size: 2, Ratio: 0.5}))
+
+	require.Equal(t, vf.Map(
+		`Base`, nil,
+		`Name`, ``,
+		`at`, vf.Time(time.Time{}),
+		`Value`, nil,
+		`Ratio`, 0.0,
+		`List`, nil,
+		`Map`, nil,
+	), hiera.ToData(nested{}))
+}
@@ -0,0 +1,23 @@
+package hiera
+
+import "fmt"
+
+// OptionError is the error that a function panics with when one of its options is missing or invalid. The plugin
+// responds to such an error with 400 Bad Request.
+type OptionError struct {
+	// Option is the name of the offending option. A nested value is denoted by a path such as "servers[1].port".
+	Option string
+
+	// Message describes what is wrong with the option
+	Message string
+}
+
+// NewOptionError returns an OptionError for the given option with a message formatted using fmt.Sprintf
+func NewOptionError(option, format string, args ...interface{}) *OptionError {
+	return &OptionError{Option: option, Message: fmt.Sprintf(format, args...)}
+}
+
+// Error returns the message prefixed with the name of the option, e.g. "option 'path': required option is missing"
+func (e *OptionError) Error() string {
+	return fmt.Sprintf(`option '%s': %s`, e.Option, e.Message)
+}
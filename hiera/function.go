@@ -13,6 +13,11 @@ type (
 	// lookups.
 	DataHash func(ic ProviderContext) dgo.Value
 
+	// StreamingDataHash is a Hiera 'data_hash' function that produces its Map one entry at a time by calling the
+	// given yield function. It is intended for very large data sets that should not be held in memory at once.
+	// The function is considered to not find a value if it doesn't yield any entries.
+	StreamingDataHash func(ic ProviderContext, yield func(key string, value dgo.Value))
+
 	// LookupKey is a Hiera 'lookup_key' function returns the value that corresponds to the given key.
 	LookupKey func(ic ProviderContext, key string) dgo.Value
 )
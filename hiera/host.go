@@ -0,0 +1,86 @@
+package hiera
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// The names of the query parameters that carry the HostInfo of a request
+const (
+	configPathParam   = `config_path`
+	dataDirParam      = `datadir`
+	levelParam        = `level`
+	environmentParam  = `environment`
+	invocationIDParam = `invocation_id`
+	callbackParam     = `callback`
+	tokenParam        = `callback_token`
+	depthParam        = `depth`
+)
+
+// HostInfo describes the context in which the host calls a function. All fields are optional. The host sends them
+// as query parameters of the request and the function reads them using its ProviderContext.
+type HostInfo struct {
+	// ConfigPath is the path of the hiera.yaml file that declares the hierarchy level. It is sent in the
+	// "config_path" query parameter.
+	ConfigPath string
+
+	// DataDir is the datadir of the hierarchy level. It is sent in the "datadir" query parameter.
+	DataDir string
+
+	// Level is the name of the hierarchy level. It is sent in the "level" query parameter.
+	Level string
+
+	// Environment is the name of the environment that the lookup is performed in. It is sent in the "environment"
+	// query parameter.
+	Environment string
+
+	// InvocationID identifies the lookup that the call is part of. All calls that the host makes on behalf of one
+	// lookup share the same id. It is sent in the "invocation_id" query parameter.
+	InvocationID string
+
+	// Callback is the URL that ProviderContext.Lookup sends its requests to. It is sent in the "callback" query
+	// parameter. Functions cannot perform lookups when it is empty.
+	Callback string
+
+	// CallbackToken is sent as a bearer token in the Authorization header of requests to the Callback. It is sent
+	// in the "callback_token" query parameter.
+	CallbackToken string
+
+	// Depth is the number of lookups made using ProviderContext.Lookup that the call is nested in. It is sent in the
+	// "depth" query parameter.
+	Depth int
+}
+
+// HostInfoFromQuery returns the HostInfo that the given query parameters contain
+func HostInfoFromQuery(q url.Values) HostInfo {
+	depth, _ := strconv.Atoi(q.Get(depthParam))
+	return HostInfo{
+		ConfigPath:    q.Get(configPathParam),
+		DataDir:       q.Get(dataDirParam),
+		Level:         q.Get(levelParam),
+		Environment:   q.Get(environmentParam),
+		InvocationID:  q.Get(invocationIDParam),
+		Callback:      q.Get(callbackParam),
+		CallbackToken: q.Get(tokenParam),
+		Depth:         depth,
+	}
+}
+
+// Encode adds the fields of the HostInfo that are not empty to the given query parameters
+func (h *HostInfo) Encode(q url.Values) {
+	set := func(name, value string) {
+		if value != `` {
+			q.Set(name, value)
+		}
+	}
+	set(configPathParam, h.ConfigPath)
+	set(dataDirParam, h.DataDir)
+	set(levelParam, h.Level)
+	set(environmentParam, h.Environment)
+	set(invocationIDParam, h.InvocationID)
+	set(callbackParam, h.Callback)
+	set(tokenParam, h.CallbackToken)
+	if h.Depth > 0 {
+		q.Set(depthParam, strconv.Itoa(h.Depth))
+	}
+}
@@ -0,0 +1,45 @@
+package hiera_test
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/hierasdk/hiera"
+)
+
+func TestHostInfo(t *testing.T) {
+	h := hiera.HostInfo{
+		ConfigPath:    `/etc/hiera/hiera.yaml`,
+		DataDir:       `data`,
+		Level:         `common`,
+		Environment:   `production`,
+		InvocationID:  `abc`,
+		Callback:      `http://127.0.0.1:8080/lookup`,
+		CallbackToken: `xyz`,
+		Depth:         2,
+	}
+	q := url.Values{}
+	h.Encode(q)
+	require.Equal(t, `callback=http%3A%2F%2F127.0.0.1%3A8080%2Flookup&callback_token=xyz&`+
+		`config_path=%2Fetc%2Fhiera%2Fhiera.yaml&datadir=data&depth=2&environment=production&`+
+		`invocation_id=abc&level=common`, q.Encode())
+	require.True(t, h == hiera.HostInfoFromQuery(q))
+
+	ctx := hiera.NewProviderContext(q)
+	require.Equal(t, `/etc/hiera/hiera.yaml`, ctx.ConfigPath())
+	require.Equal(t, filepath.FromSlash(`/etc/hiera/data`), ctx.DataDir())
+	require.Equal(t, `common`, ctx.Level())
+	require.Equal(t, `production`, ctx.Environment())
+	require.Equal(t, `abc`, ctx.InvocationID())
+
+	q = url.Values{}
+	(&hiera.HostInfo{DataDir: `/var/data`}).Encode(q)
+	require.Equal(t, `datadir=%2Fvar%2Fdata`, q.Encode())
+	ctx = hiera.NewProviderContext(q)
+	require.Equal(t, `/var/data`, ctx.DataDir())
+	require.Equal(t, ``, ctx.ConfigPath())
+	require.Equal(t, ``, ctx.InvocationID())
+}
@@ -0,0 +1,82 @@
+package hiera
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/richjson"
+)
+
+// MaxLookupDepth is the maximum number of nested lookups that functions can make using ProviderContext.Lookup,
+// e.g. when the value of a looked up key is produced by a function that in turn looks up the original key.
+const MaxLookupDepth = 16
+
+// ErrNoCallback is returned by ProviderContext.Lookup when the host didn't send a callback URL
+var ErrNoCallback = errors.New(`the host doesn't accept lookups from functions`)
+
+// LookupTimeout is the maximum time that ProviderContext.Lookup waits for the host to respond
+const LookupTimeout = 30 * time.Second
+
+// lookupClient doesn't use a proxy since the callback is served by the host that runs the plugin. The timeout keeps a
+// host that stalls on the callback from hanging the function, and thereby the host's own request, forever.
+var lookupClient = &http.Client{Transport: &http.Transport{}, Timeout: LookupTimeout}
+
+// lookup asks the host to look up the given key. The request is a GET to the callback URL with the key in the "key"
+// query parameter together with the invocation id and the depth of the nested lookup. The host responds with the
+// value encoded as rich JSON or JSON, or with 404 when the key isn't found.
+func (h *HostInfo) lookup(key string) (dgo.Value, error) {
+	if h.Callback == `` {
+		return nil, ErrNoCallback
+	}
+	if h.Depth >= MaxLookupDepth {
+		return nil, fmt.Errorf(`lookup of '%s' exceeds the maximum lookup depth %d`, key, MaxLookupDepth)
+	}
+	q := url.Values{}
+	q.Set(`key`, key)
+	nh := HostInfo{Environment: h.Environment, InvocationID: h.InvocationID, Depth: h.Depth + 1}
+	nh.Encode(q)
+	u := h.Callback
+	if strings.Contains(u, `?`) {
+		u += `&`
+	} else {
+		u += `?`
+	}
+	req, err := http.NewRequest(http.MethodGet, u+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if h.CallbackToken != `` {
+		req.Header.Set(`Authorization`, `Bearer `+h.CallbackToken)
+	}
+	req.Header.Set(`Accept`, richjson.ContentType+`, application/json;q=0.9`)
+	resp, err := lookupClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf(`lookup of '%s' failed with status %d: %s`, key, resp.StatusCode,
+			strings.TrimSpace(string(body)))
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get(`Content-Type`)); mt == richjson.ContentType {
+		return richjson.Unmarshal(body)
+	}
+	return vf.UnmarshalJSON(body)
+}
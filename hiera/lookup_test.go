@@ -0,0 +1,88 @@
+package hiera_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+)
+
+func lookupContext(h hiera.HostInfo) hiera.ProviderContext {
+	q := url.Values{}
+	h.Encode(q)
+	return hiera.NewProviderContext(q)
+}
+
+func TestProviderContext_Lookup(t *testing.T) {
+	var got url.Values
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		switch {
+		case r.Header.Get(`Authorization`) != `Bearer secret`:
+			http.Error(w, `401 unauthorized`, http.StatusUnauthorized)
+		case got.Get(`key`) == `found`:
+			w.Header().Set(`Content-Type`, `application/json`)
+			_, _ = w.Write([]byte(`{"a":[1,2]}`))
+		default:
+			http.Error(w, `404 value not found`, http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	ctx := lookupContext(hiera.HostInfo{
+		Callback: s.URL + `/lookup`, CallbackToken: `secret`, InvocationID: `abc`, Level: `common`, Depth: 2})
+	v, err := ctx.Lookup(`found`)
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`a`, vf.Values(1, 2)), v)
+	require.Equal(t, `found`, got.Get(`key`))
+	require.Equal(t, `abc`, got.Get(`invocation_id`))
+	require.Equal(t, `3`, got.Get(`depth`))
+	require.Equal(t, ``, got.Get(`level`))
+
+	v, err = ctx.Lookup(`missing`)
+	require.Nil(t, err)
+	require.True(t, v == nil)
+
+	_, err = lookupContext(hiera.HostInfo{Callback: s.URL}).Lookup(`found`)
+	require.Match(t, `lookup of 'found' failed with status 401: 401 unauthorized`, err.Error())
+
+	_, err = lookupContext(hiera.HostInfo{Callback: s.URL, Depth: hiera.MaxLookupDepth}).Lookup(`found`)
+	require.Match(t, `exceeds the maximum lookup depth 16`, err.Error())
+
+	_, err = lookupContext(hiera.HostInfo{}).Lookup(`found`)
+	require.Equal(t, hiera.ErrNoCallback, err)
+
+	_, err = lookupContext(hiera.HostInfo{Callback: `://x`}).Lookup(`found`)
+	require.Match(t, `missing protocol scheme`, err.Error())
+}
+
+func TestProviderContext_Lookup_callbackQuery(t *testing.T) {
+	var got url.Values
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		if got.Get(`key`) == `truncated` {
+			w.Header().Set(`Content-Length`, `10`)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		w.Header().Set(`Content-Type`, `application/json`)
+		_, _ = w.Write([]byte(`1`))
+	}))
+	defer s.Close()
+
+	// The parameters of the lookup are appended to a callback URL that has a query
+	ctx := lookupContext(hiera.HostInfo{Callback: s.URL + `/lookup?host=h1`})
+	v, err := ctx.Lookup(`found`)
+	require.Nil(t, err)
+	require.Equal(t, vf.Integer(1), v)
+	require.Equal(t, `h1`, got.Get(`host`))
+	require.Equal(t, `found`, got.Get(`key`))
+
+	_, err = ctx.Lookup(`truncated`)
+	require.Match(t, `unexpected EOF`, err.Error())
+}
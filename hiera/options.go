@@ -0,0 +1,285 @@
+package hiera
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/typ"
+	"github.com/lyraproj/dgo/vf"
+)
+
+// OptionReader reads the options of a ProviderContext. Each accessor returns the given default when the option is
+// missing or null, and an *OptionError that names the option when the option cannot be converted to the requested
+// type. Sensitive values are unwrapped.
+//
+// An OptionReader only accepts values of the requested type, with the exception that an integer is accepted where a
+// float is requested. A reader returned by Coerce also converts values of other types, e.g. "8080" or 8080.0 to an
+// int.
+type OptionReader struct {
+	ctx     ProviderContext
+	options dgo.Map
+	coerce  bool
+}
+
+// NewOptionReader returns an OptionReader for the options of the given ProviderContext
+func NewOptionReader(ctx ProviderContext) OptionReader {
+	return OptionReader{ctx: ctx}
+}
+
+// NewMapOptionReader returns an OptionReader for the options in the given map. The ResolvePath method of the
+// reader doesn't resolve relative paths since the reader has no ProviderContext.
+func NewMapOptionReader(options dgo.Map) OptionReader {
+	return OptionReader{options: options}
+}
+
+// Coerce returns a copy of the reader that converts values of other types to the requested type when possible
+func (r OptionReader) Coerce() OptionReader {
+	r.coerce = true
+	return r
+}
+
+// Require returns an *OptionError for the first of the given options that is missing or null
+func (r OptionReader) Require(options ...string) error {
+	for _, o := range options {
+		if r.get(o) == nil {
+			return NewOptionError(o, `required option is missing`)
+		}
+	}
+	return nil
+}
+
+// String returns the option with the given name as a string. Coercion converts numbers and booleans.
+func (r OptionReader) String(option, dflt string) (string, error) {
+	v := r.get(option)
+	if v == nil {
+		return dflt, nil
+	}
+	if s, ok := v.(dgo.String); ok {
+		return s.GoString(), nil
+	}
+	if r.coerce {
+		switch v.(type) {
+		case dgo.Integer, dgo.Float, dgo.Boolean:
+			return v.String(), nil
+		}
+	}
+	return ``, mismatch(option, `string`, v)
+}
+
+// Int returns the option with the given name as an int. Coercion converts floats without a fraction and strings
+// that contain an integer.
+func (r OptionReader) Int(option string, dflt int) (int, error) {
+	v := r.get(option)
+	if v == nil {
+		return dflt, nil
+	}
+	var i int64
+	switch n := v.(type) {
+	case dgo.Integer:
+		i = n.GoInt()
+	case dgo.Float:
+		f := n.GoFloat()
+		if !r.coerce {
+			return 0, mismatch(option, `int`, v)
+		}
+		// float64(math.MaxInt64) is 2^63, which is out of range
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, NewOptionError(option, `cannot convert %g to int`, f)
+		}
+		i = int64(f)
+	case dgo.String:
+		if !r.coerce {
+			return 0, mismatch(option, `int`, v)
+		}
+		var err error
+		if i, err = strconv.ParseInt(strings.TrimSpace(n.GoString()), 10, 64); err != nil {
+			return 0, NewOptionError(option, `cannot convert %q to int`, n.GoString())
+		}
+	default:
+		return 0, mismatch(option, `int`, v)
+	}
+	// An int has 64 bits on all platforms that dgo builds on
+	return int(i), nil
+}
+
+// Float returns the option with the given name as a float64. Integers are always accepted. Coercion converts
+// strings that contain a number.
+func (r OptionReader) Float(option string, dflt float64) (float64, error) {
+	v := r.get(option)
+	if v == nil {
+		return dflt, nil
+	}
+	switch n := v.(type) {
+	case dgo.Float:
+		return n.GoFloat(), nil
+	case dgo.Integer:
+		return float64(n.GoInt()), nil
+	case dgo.String:
+		if r.coerce {
+			f, err := strconv.ParseFloat(strings.TrimSpace(n.GoString()), 64)
+			if err != nil {
+				return 0, NewOptionError(option, `cannot convert %q to float`, n.GoString())
+			}
+			return f, nil
+		}
+	}
+	return 0, mismatch(option, `float`, v)
+}
+
+// Bool returns the option with the given name as a bool. Coercion converts the strings that strconv.ParseBool
+// accepts, e.g. "true" and "false".
+func (r OptionReader) Bool(option string, dflt bool) (bool, error) {
+	v := r.get(option)
+	if v == nil {
+		return dflt, nil
+	}
+	switch b := v.(type) {
+	case dgo.Boolean:
+		return b.GoBool(), nil
+	case dgo.String:
+		if r.coerce {
+			bv, err := strconv.ParseBool(strings.TrimSpace(b.GoString()))
+			if err != nil {
+				return false, NewOptionError(option, `cannot convert %q to bool`, b.GoString())
+			}
+			return bv, nil
+		}
+	}
+	return false, mismatch(option, `bool`, v)
+}
+
+// Duration returns the option with the given name as a time.Duration. The option must be a string that
+// time.ParseDuration accepts, e.g. "1m30s". Coercion converts numbers to a number of seconds.
+func (r OptionReader) Duration(option string, dflt time.Duration) (time.Duration, error) {
+	v := r.get(option)
+	if v == nil {
+		return dflt, nil
+	}
+	switch d := v.(type) {
+	case dgo.String:
+		dv, err := time.ParseDuration(strings.TrimSpace(d.GoString()))
+		if err != nil {
+			return 0, NewOptionError(option, `invalid duration %q`, d.GoString())
+		}
+		return dv, nil
+	case dgo.Integer:
+		if r.coerce {
+			return time.Duration(d.GoInt()) * time.Second, nil
+		}
+	case dgo.Float:
+		if r.coerce {
+			return time.Duration(d.GoFloat() * float64(time.Second)), nil
+		}
+	}
+	return 0, mismatch(option, `duration string`, v)
+}
+
+// Strings returns the option with the given name as a slice of strings. The option must be an array of strings.
+// Coercion converts a single value to a slice with one element and converts numbers and booleans to strings.
+func (r OptionReader) Strings(option string, dflt []string) ([]string, error) {
+	v := r.get(option)
+	if v == nil {
+		return dflt, nil
+	}
+	a, ok := v.(dgo.Array)
+	if !ok {
+		if !r.coerce {
+			return nil, mismatch(option, `[]string`, v)
+		}
+		a = vf.Values(v)
+	}
+	ss := make([]string, a.Len())
+	for i := range ss {
+		e := a.Get(i)
+		if s, ok := e.(dgo.Sensitive); ok {
+			e = s.Unwrap()
+		}
+		switch ev := e.(type) {
+		case dgo.String:
+			ss[i] = ev.GoString()
+			continue
+		case dgo.Integer, dgo.Float, dgo.Boolean:
+			if r.coerce {
+				ss[i] = e.String()
+				continue
+			}
+		}
+		return nil, mismatch(fmt.Sprintf(`%s[%d]`, option, i), `string`, e)
+	}
+	return ss, nil
+}
+
+// Map returns the option with the given name as a dgo.Map
+func (r OptionReader) Map(option string, dflt dgo.Map) (dgo.Map, error) {
+	v := r.get(option)
+	if v == nil {
+		return dflt, nil
+	}
+	if m, ok := v.(dgo.Map); ok {
+		return m, nil
+	}
+	return nil, mismatch(option, `map`, v)
+}
+
+// URL returns the option with the given name as an absolute URL. The default is parsed in the same way as the
+// option. A nil URL is returned when the option is missing and the default is empty.
+func (r OptionReader) URL(option, dflt string) (*url.URL, error) {
+	s, err := r.String(option, dflt)
+	if err != nil || s == `` {
+		return nil, err
+	}
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() || u.Host == `` && u.Opaque == `` && u.Path == `` {
+		return nil, NewOptionError(option, `invalid absolute URL %q`, s)
+	}
+	return u, nil
+}
+
+// Path returns the option with the given name as a file path that is resolved using ResolvePath. An empty string
+// is returned when the option is missing and the default is empty.
+func (r OptionReader) Path(option, dflt string) (string, error) {
+	s, err := r.String(option, dflt)
+	if err != nil || s == `` {
+		return ``, err
+	}
+	return r.ResolvePath(s), nil
+}
+
+// ResolvePath returns the given path resolved relative to the directory of the hiera.yaml file that the host sent
+// in the request, see ProviderContext.ConfigPath. The path is returned cleaned but otherwise unchanged when it is
+// absolute or when the host didn't send the location of its hiera.yaml file.
+func (r OptionReader) ResolvePath(path string) string {
+	if !filepath.IsAbs(path) && r.ctx != nil {
+		if cp := r.ctx.ConfigPath(); cp != `` {
+			return filepath.Join(filepath.Dir(cp), path)
+		}
+	}
+	return filepath.Clean(path)
+}
+
+// get returns the given option with sensitive values unwrapped, or nil if the option is missing or null
+func (r OptionReader) get(option string) dgo.Value {
+	var v dgo.Value
+	if r.ctx != nil {
+		v = r.ctx.Option(option)
+	} else if r.options != nil {
+		v = r.options.Get(option)
+	}
+	if s, ok := v.(dgo.Sensitive); ok {
+		v = s.Unwrap()
+	}
+	if v == vf.Nil {
+		v = nil
+	}
+	return v
+}
+
+func mismatch(option, expected string, v dgo.Value) error {
+	return NewOptionError(option, `expected %s, got %s`, expected, typ.Generic(v.Type()))
+}
@@ -0,0 +1,193 @@
+package hiera_test
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+)
+
+func newContext(options string) hiera.ProviderContext {
+	return hiera.NewProviderContext(url.Values{`options`: {options}, `config_path`: {`/etc/hiera/hiera.yaml`}})
+}
+
+func TestOptionReader_defaults(t *testing.T) {
+	r := newContext(`{"null": null}`).Options()
+	for _, o := range []string{`missing`, `null`} {
+		s, err := r.String(o, `d`)
+		require.Nil(t, err)
+		require.Equal(t, `d`, s)
+		i, err := r.Int(o, 3)
+		require.Nil(t, err)
+		require.Equal(t, 3, i)
+		f, err := r.Float(o, 1.5)
+		require.Nil(t, err)
+		require.Equal(t, 1.5, f)
+		b, err := r.Bool(o, true)
+		require.Nil(t, err)
+		require.True(t, b)
+		d, err := r.Duration(o, time.Second)
+		require.Nil(t, err)
+		require.Equal(t, time.Second, d)
+		ss, err := r.Strings(o, []string{`a`})
+		require.Nil(t, err)
+		require.Equal(t, []string{`a`}, ss)
+		m, err := r.Map(o, vf.Map(`a`, 1))
+		require.Nil(t, err)
+		require.Equal(t, vf.Map(`a`, 1), m)
+		u, err := r.URL(o, `https://example.com/x`)
+		require.Nil(t, err)
+		require.Equal(t, `https://example.com/x`, u.String())
+		u, err = r.URL(o, ``)
+		require.Nil(t, err)
+		require.True(t, u == nil)
+		p, err := r.Path(o, `data`)
+		require.Nil(t, err)
+		require.Equal(t, filepath.FromSlash(`/etc/hiera/data`), p)
+	}
+	require.Nil(t, r.Require())
+	require.Equal(t, `option 'missing': required option is missing`, r.Require(`missing`, `null`).Error())
+}
+
+func TestOptionReader(t *testing.T) {
+	r := newContext(`{
+		"s": "text", "i": 8080, "f": 2.5, "b": true, "d": "1m30s", "l": ["a", "b"], "m": {"a": 1},
+		"u": "http://example.com:8080/api", "p": "/var/data", "rp": "data/common.yaml"}`).Options()
+	s, err := r.String(`s`, ``)
+	require.Nil(t, err)
+	require.Equal(t, `text`, s)
+	i, err := r.Int(`i`, 0)
+	require.Nil(t, err)
+	require.Equal(t, 8080, i)
+	f, err := r.Float(`f`, 0)
+	require.Nil(t, err)
+	require.Equal(t, 2.5, f)
+	f, err = r.Float(`i`, 0)
+	require.Nil(t, err)
+	require.Equal(t, 8080.0, f)
+	b, err := r.Bool(`b`, false)
+	require.Nil(t, err)
+	require.True(t, b)
+	d, err := r.Duration(`d`, 0)
+	require.Nil(t, err)
+	require.Equal(t, 90*time.Second, d)
+	ss, err := r.Strings(`l`, nil)
+	require.Nil(t, err)
+	require.Equal(t, []string{`a`, `b`}, ss)
+	m, err := r.Map(`m`, nil)
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`a`, 1), m)
+	u, err := r.URL(`u`, ``)
+	require.Nil(t, err)
+	require.Equal(t, `example.com:8080`, u.Host)
+	p, err := r.Path(`p`, ``)
+	require.Nil(t, err)
+	require.Equal(t, filepath.FromSlash(`/var/data`), p)
+	p, err = r.Path(`rp`, ``)
+	require.Nil(t, err)
+	require.Equal(t, filepath.FromSlash(`/etc/hiera/data/common.yaml`), p)
+
+	// Without a config path, relative paths are not resolved
+	p, err = hiera.NewProviderContext(url.Values{`options`: {`{"p": "data/./common.yaml"}`}}).Options().Path(`p`, ``)
+	require.Nil(t, err)
+	require.Equal(t, filepath.FromSlash(`data/common.yaml`), p)
+}
+
+func TestOptionReader_coerce(t *testing.T) {
+	r := newContext(`{"si": " 8080", "fi": 8080.0, "sf": "2.5", "sb": "false", "i": 90, "f": 1.5, "b": true,
+		"l": ["a", 1, true], "s": "a"}`).Options().Coerce()
+	i, err := r.Int(`si`, 0)
+	require.Nil(t, err)
+	require.Equal(t, 8080, i)
+	i, err = r.Int(`fi`, 0)
+	require.Nil(t, err)
+	require.Equal(t, 8080, i)
+	f, err := r.Float(`sf`, 0)
+	require.Nil(t, err)
+	require.Equal(t, 2.5, f)
+	b, err := r.Bool(`sb`, true)
+	require.Nil(t, err)
+	require.False(t, b)
+	d, err := r.Duration(`i`, 0)
+	require.Nil(t, err)
+	require.Equal(t, 90*time.Second, d)
+	d, err = r.Duration(`f`, 0)
+	require.Nil(t, err)
+	require.Equal(t, 1500*time.Millisecond, d)
+	s, err := r.String(`b`, ``)
+	require.Nil(t, err)
+	require.Equal(t, `true`, s)
+	ss, err := r.Strings(`l`, nil)
+	require.Nil(t, err)
+	require.Equal(t, []string{`a`, `1`, `true`}, ss)
+	ss, err = r.Strings(`s`, nil)
+	require.Nil(t, err)
+	require.Equal(t, []string{`a`}, ss)
+}
+
+func TestOptionReader_errors(t *testing.T) {
+	ctx := newContext(`{"s": "text", "i": 8080, "f": 2.5, "fi": 8080.0, "l": ["a", 1], "u": "/relative",
+		"big": 1e30, "edge": 9.223372036854775808e18}`)
+	r := ctx.Options()
+	c := r.Coerce()
+	for _, tc := range []struct {
+		f   func() error
+		msg string
+	}{
+		{func() error { _, err := r.String(`i`, ``); return err }, `option 'i': expected string, got int`},
+		{func() error { _, err := r.Int(`s`, 0); return err }, `option 's': expected int, got string`},
+		{func() error { _, err := r.Int(`fi`, 0); return err }, `option 'fi': expected int, got float`},
+		{func() error { _, err := c.Int(`l`, 0); return err }, `option 'l': expected int, got []any`},
+		{func() error { _, err := c.Int(`f`, 0); return err }, `option 'f': cannot convert 2.5 to int`},
+		{func() error { _, err := c.Int(`big`, 0); return err }, `option 'big': cannot convert 1e+30 to int`},
+		{func() error { _, err := c.Int(`edge`, 0); return err },
+			`option 'edge': cannot convert 9.223372036854776e+18 to int`},
+		{func() error { _, err := c.Int(`s`, 0); return err }, `option 's': cannot convert "text" to int`},
+		{func() error { _, err := r.Float(`s`, 0); return err }, `option 's': expected float, got string`},
+		{func() error { _, err := c.Float(`s`, 0); return err }, `option 's': cannot convert "text" to float`},
+		{func() error { _, err := r.Bool(`s`, false); return err }, `option 's': expected bool, got string`},
+		{func() error { _, err := c.Bool(`s`, false); return err }, `option 's': cannot convert "text" to bool`},
+		{func() error { _, err := r.Duration(`s`, 0); return err }, `option 's': invalid duration "text"`},
+		{func() error { _, err := r.Duration(`i`, 0); return err }, `option 'i': expected duration string, got int`},
+		{func() error { _, err := r.Strings(`s`, nil); return err }, `option 's': expected []string, got string`},
+		{func() error { _, err := r.Strings(`l`, nil); return err }, `option 'l[1]': expected string, got int`},
+		{func() error { _, err := r.Map(`l`, nil); return err }, `option 'l': expected map, got []any`},
+		{func() error { _, err := r.URL(`u`, ``); return err }, `option 'u': invalid absolute URL "/relative"`},
+		{func() error { _, err := r.Path(`i`, ``); return err }, `option 'i': expected string, got int`},
+	} {
+		err := tc.f()
+		require.True(t, err != nil, tc.msg)
+		require.Equal(t, tc.msg, err.Error())
+		_, ok := err.(*hiera.OptionError)
+		require.True(t, ok)
+	}
+}
+
+func TestNewMapOptionReader(t *testing.T) {
+	r := hiera.NewMapOptionReader(vf.Map(`i`, 3, `p`, `data`))
+	i, err := r.Int(`i`, 0)
+	require.Nil(t, err)
+	require.Equal(t, 3, i)
+	i, err = r.Int(`missing`, 7)
+	require.Nil(t, err)
+	require.Equal(t, 7, i)
+	p, err := r.Path(`p`, ``)
+	require.Nil(t, err)
+	require.Equal(t, `data`, p)
+	_, err = hiera.NewMapOptionReader(nil).Coerce().Int(`i`, 0)
+	require.Nil(t, err)
+
+	// Sensitive values are unwrapped, also in arrays
+	r = hiera.NewMapOptionReader(vf.Map(`s`, vf.Sensitive(`x`), `l`, vf.Values(vf.Sensitive(`y`))))
+	s, err := r.String(`s`, ``)
+	require.Nil(t, err)
+	require.Equal(t, `x`, s)
+	l, err := r.Strings(`l`, nil)
+	require.Nil(t, err)
+	require.Equal(t, []string{`y`}, l)
+}
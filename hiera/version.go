@@ -7,3 +7,8 @@ const ProtoVersion = 1
 // plugin. If it is not set, the plugin will terminate with a message informing the user that it isn't intended for
 // normal execution.
 const MagicCookie = 0xBEBAC0DE
+
+// SensitiveHeader is the name of the response header that flags sensitive values in the response body. Its value
+// is a JSON array of JSON pointers (RFC 6901) to the values that the function wrapped using vf.Sensitive. The
+// pointer to a sensitive response value is the empty string.
+const SensitiveHeader = `X-Hiera-Sensitive`
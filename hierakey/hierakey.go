@@ -0,0 +1,124 @@
+// Package hierakey parses Hiera keys into the segments that a data_dig function receives. A key is a dotted string
+// such as
+//
+//	config.servers.0."host.name"
+//
+// where each segment is separated by a dot. A segment that consists of decimal digits only is an integer index into
+// an array. A segment can be enclosed in single or double quotes to include dots or to make digits a string. Quotes
+// cannot be escaped, but a segment in double quotes may contain single quotes and vice versa.
+package hierakey
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+)
+
+// SyntaxError is the error that Parse returns when a key cannot be parsed
+type SyntaxError struct {
+	// Key is the key that could not be parsed
+	Key string
+
+	// Message describes what is wrong with the key
+	Message string
+}
+
+// Error returns the message together with the key that could not be parsed
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf(`invalid key %q: %s`, e.Key, e.Message)
+}
+
+// Parse returns the segments of the given key as an array of strings and integers. An unquoted segment that
+// consists of decimal digits is an integer unless it is the first segment, which is always a string. A key that
+// starts with a '[' is parsed as a JSON array of such segments, which is how the host sends keys that it has already
+// split.
+//
+// A *SyntaxError is returned when the key is empty, when it has an empty or unterminated segment, when a quoted
+// segment is followed by something else than a dot, and when a JSON array cannot be parsed, has elements that are
+// neither strings nor integers, or starts with an integer.
+func Parse(key string) (dgo.Array, error) {
+	if strings.HasPrefix(key, `[`) {
+		return parseJSON(key)
+	}
+	if key == `` {
+		return nil, &SyntaxError{Key: key, Message: `key is empty`}
+	}
+	var segments []dgo.Value
+	for pos := 0; ; pos++ {
+		var seg dgo.Value
+		switch c := key[pos]; c {
+		case '"', '\'':
+			end := strings.IndexByte(key[pos+1:], c)
+			if end < 0 {
+				return nil, &SyntaxError{Key: key, Message: fmt.Sprintf(`unterminated quote at offset %d`, pos)}
+			}
+			seg = vf.String(key[pos+1 : pos+1+end])
+			pos += end + 2
+			if pos < len(key) && key[pos] != '.' {
+				return nil, &SyntaxError{Key: key,
+					Message: fmt.Sprintf(`expected a dot after quoted segment at offset %d`, pos)}
+			}
+		case '.':
+			return nil, &SyntaxError{Key: key, Message: fmt.Sprintf(`empty segment at offset %d`, pos)}
+		default:
+			end := strings.IndexByte(key[pos:], '.')
+			if end < 0 {
+				end = len(key) - pos
+			}
+			if segments == nil {
+				// The root segment is always a string
+				seg = vf.String(key[pos : pos+end])
+			} else {
+				seg = segment(key[pos : pos+end])
+			}
+			pos += end
+		}
+		segments = append(segments, seg)
+		if pos >= len(key) {
+			return vf.Array(segments), nil
+		}
+		if pos == len(key)-1 {
+			return nil, &SyntaxError{Key: key, Message: fmt.Sprintf(`empty segment at offset %d`, len(key))}
+		}
+	}
+}
+
+// segment returns the given unquoted segment as an integer if it consists of decimal digits only, and as a string
+// otherwise
+func segment(s string) dgo.Value {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return vf.String(s)
+		}
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return vf.Integer(i)
+	}
+	return vf.String(s)
+}
+
+func parseJSON(key string) (dgo.Array, error) {
+	v, err := vf.UnmarshalJSON([]byte(key))
+	if err != nil {
+		return nil, &SyntaxError{Key: key, Message: err.Error()}
+	}
+	// The key starts with a '[' so the value is an array
+	a := v.(dgo.Array)
+	if a.Len() == 0 {
+		return nil, &SyntaxError{Key: key, Message: `key is empty`}
+	}
+	if _, ok := a.Get(0).(dgo.String); !ok {
+		return nil, &SyntaxError{Key: key, Message: `the first segment must be a string`}
+	}
+	for i := 1; i < a.Len(); i++ {
+		switch a.Get(i).(type) {
+		case dgo.String, dgo.Integer:
+		default:
+			return nil, &SyntaxError{Key: key, Message: fmt.Sprintf(`segment %d is neither a string nor an integer`, i)}
+		}
+	}
+	return a, nil
+}
@@ -0,0 +1,57 @@
+package hierakey_test
+
+import (
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hierakey"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string][]interface{}{
+		`config`:                 {`config`},
+		`config.servers.0.host`:  {`config`, `servers`, 0, `host`},
+		`a."b.c".'d"e'`:          {`a`, `b.c`, `d"e`},
+		`a."0"`:                  {`a`, `0`},
+		`a.0x`:                   {`a`, `0x`},
+		`a.99999999999999999999`: {`a`, `99999999999999999999`},
+		`["a", 1]`:               {`a`, 1},
+		`'quoted only'`:          {`quoted only`},
+		`a.""`:                   {`a`, ``},
+		`["a", "b.c"]`:           {`a`, `b.c`},
+		`a.["b"]`:                {`a`, `["b"]`},
+		`  spaced . segments  `:  {`  spaced `, ` segments  `},
+		`"a".b."c"`:              {`a`, `b`, `c`},
+		`0.a`:                    {`0`, `a`},
+		`0.1`:                    {`0`, 1},
+	}
+	for k, expected := range tests {
+		key, err := hierakey.Parse(k)
+		require.Nil(t, err)
+		require.Equal(t, vf.Values(expected...), key)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	tests := map[string]string{
+		``:            `invalid key "": key is empty`,
+		`.a`:          `empty segment at offset 0`,
+		`a.`:          `empty segment at offset 2`,
+		`a..b`:        `empty segment at offset 2`,
+		`a."b`:        `unterminated quote at offset 2`,
+		`a."b"c`:      `expected a dot after quoted segment at offset 5`,
+		`["a"`:        `: EOF$`,
+		`[]`:          `key is empty`,
+		`["a", true]`: `segment 1 is neither a string nor an integer`,
+		`[0, "a"]`:    `the first segment must be a string`,
+	}
+	for k, expected := range tests {
+		_, err := hierakey.Parse(k)
+		require.NotNil(t, err)
+		require.Match(t, expected, err.Error())
+		_, ok := err.(*hierakey.SyntaxError)
+		require.True(t, ok)
+	}
+}
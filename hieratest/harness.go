@@ -0,0 +1,222 @@
+// Package hieratest provides an in-process test harness for plugin authors. The harness registers functions in
+// an isolated registry and invokes them through the same HTTP layer that serves the Hiera host.
+package hieratest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
+	"github.com/lyraproj/hierasdk/routes"
+)
+
+// UpdateGoldenEnv is the name of the environment variable that, when set to a non empty value, causes
+// AssertGolden to write the actual value to the golden file instead of comparing with it.
+const UpdateGoldenEnv = `HIERATEST_UPDATE_GOLDEN`
+
+type (
+	// T is the subset of testing.TB that the harness uses to report failures
+	T interface {
+		Helper()
+		Errorf(format string, args ...interface{})
+		Fatalf(format string, args ...interface{})
+	}
+
+	// Harness registers functions in an isolated registry and calls them through the real HTTP layer
+	Harness struct {
+		t    T
+		reg  *register.Registry
+		host hiera.HostInfo
+	}
+
+	// Result is the outcome of a function call made by the Harness
+	Result struct {
+		t T
+
+		// Status is the HTTP status code of the response
+		Status int
+
+		// Body is the unparsed body of the response
+		Body string
+
+		// Value is the decoded value. It is only set when Status is http.StatusOK
+		Value dgo.Value
+
+		// Sensitive contains the JSON pointers to the values that the function flagged as sensitive
+		Sensitive []string
+	}
+)
+
+// New returns a new Harness that uses an empty isolated registry
+func New(t T) *Harness {
+	return &Harness{t: t, reg: register.NewRegistry()}
+}
+
+// Registry returns the isolated registry of the harness. Functions registered with this registry are callable
+// using the harness.
+func (h *Harness) Registry() *register.Registry {
+	return h.reg
+}
+
+// SetHost makes the harness send the given HostInfo with each call
+func (h *Harness) SetHost(hi hiera.HostInfo) {
+	h.host = hi
+}
+
+// CallDataDig calls the data_dig function registered under the given name. The key segments must be strings or
+// integers.
+func (h *Harness) CallDataDig(name string, key []interface{}, options map[string]interface{}) *Result {
+	h.t.Helper()
+	js, err := json.Marshal(key)
+	if err != nil {
+		h.t.Fatalf(`unable to encode key: %v`, err)
+	}
+	return h.Call(`data_dig`, name, string(js), options)
+}
+
+// CallDataHash calls the data_hash function registered under the given name.
+func (h *Harness) CallDataHash(name string, options map[string]interface{}) *Result {
+	h.t.Helper()
+	return h.Call(`data_hash`, name, ``, options)
+}
+
+// CallLookupKey calls the lookup_key function registered under the given name.
+func (h *Harness) CallLookupKey(name, key string, options map[string]interface{}) *Result {
+	h.t.Helper()
+	return h.Call(`lookup_key`, name, key, options)
+}
+
+// Call calls the function of the given kind registered under the given name. The key is sent verbatim and should
+// be the empty string for data_hash functions. The options are converted to data and sent as JSON.
+func (h *Harness) Call(kind, name, key string, options map[string]interface{}) *Result {
+	h.t.Helper()
+	q := url.Values{}
+	if key != `` {
+		q.Set(`key`, key)
+	}
+	if len(options) > 0 {
+		js, err := json.Marshal(vf.Map(options))
+		if err != nil {
+			h.t.Fatalf(`unable to encode options: %v`, err)
+		}
+		q.Set(`options`, string(js))
+	}
+	h.host.Encode(q)
+	handler, _ := routes.RegisterWith(h.reg)
+	rr := httptest.NewRecorder()
+	aborted := serve(handler, rr, httptest.NewRequest(http.MethodGet, `/`+kind+`/`+name+`?`+q.Encode(), nil))
+
+	r := &Result{t: h.t, Status: rr.Code, Body: rr.Body.String()}
+	if aborted {
+		r.Status = http.StatusInternalServerError
+		r.Body = `response aborted after a partial body: ` + r.Body
+		return r
+	}
+	if r.Status == http.StatusOK {
+		r.decode(rr.Body.Bytes(), rr.Header().Get(hiera.SensitiveHeader))
+	}
+	return r
+}
+
+// decode sets the Value of the result from the given response body and its Sensitive pointers from the given
+// value of the sensitive header
+func (r *Result) decode(body []byte, sensitive string) {
+	r.t.Helper()
+	v, err := vf.UnmarshalJSON(body)
+	if err != nil {
+		r.t.Fatalf(`unable to decode response: %v`, err)
+	}
+	r.Value = v
+	if sensitive != `` {
+		if err = json.Unmarshal([]byte(sensitive), &r.Sensitive); err != nil {
+			r.t.Fatalf(`unable to decode %s header: %v`, hiera.SensitiveHeader, err)
+		}
+	}
+}
+
+// serve serves the given request and returns true if the handler aborted the response, which a streaming data_hash
+// function does when it fails after its first entry has been sent
+func serve(handler http.Handler, w http.ResponseWriter, r *http.Request) (aborted bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			if e != http.ErrAbortHandler {
+				panic(e)
+			}
+			aborted = true
+		}
+	}()
+	handler.ServeHTTP(w, r)
+	return false
+}
+
+// AssertFound asserts that a value was found and that it is equal to the given expected value after it has
+// been converted to data.
+func (r *Result) AssertFound(expected interface{}) {
+	r.t.Helper()
+	if r.Status != http.StatusOK {
+		r.t.Errorf(`expected a value, got status %d: %s`, r.Status, strings.TrimSpace(r.Body))
+		return
+	}
+	if ev := vf.Value(expected); !ev.Equals(r.Value) {
+		r.t.Errorf(`expected %s, got %s`, ev, r.Value)
+	}
+}
+
+// AssertNotFound asserts that the function didn't find a value
+func (r *Result) AssertNotFound() {
+	r.t.Helper()
+	if r.Status != http.StatusNotFound {
+		r.t.Errorf(`expected value not found, got status %d: %s`, r.Status, strings.TrimSpace(r.Body))
+	}
+}
+
+// AssertError asserts that the function call resulted in an error with a message that contains the given string
+func (r *Result) AssertError(contains string) {
+	r.t.Helper()
+	switch {
+	case r.Status < http.StatusBadRequest || r.Status == http.StatusNotFound:
+		r.t.Errorf(`expected an error, got status %d: %s`, r.Status, strings.TrimSpace(r.Body))
+	case !strings.Contains(r.Body, contains):
+		r.t.Errorf(`expected error containing %q, got %q`, contains, strings.TrimSpace(r.Body))
+	}
+}
+
+// AssertGolden asserts that a value was found and that its indented JSON representation is equal to the contents
+// of the given golden file. The file is written instead of read when the environment variable HIERATEST_UPDATE_GOLDEN
+// is set.
+func (r *Result) AssertGolden(path string) {
+	r.t.Helper()
+	if r.Status != http.StatusOK {
+		r.t.Errorf(`expected a value, got status %d: %s`, r.Status, strings.TrimSpace(r.Body))
+		return
+	}
+	var actual bytes.Buffer
+	if err := json.Indent(&actual, []byte(strings.TrimSpace(r.Body)), ``, `  `); err != nil {
+		r.t.Fatalf(`unable to indent response: %v`, err)
+	}
+	actual.WriteByte('\n')
+	if os.Getenv(UpdateGoldenEnv) != `` {
+		/* #nosec */
+		if err := ioutil.WriteFile(path, actual.Bytes(), 0600); err != nil {
+			r.t.Fatalf(`unable to write golden file: %v`, err)
+		}
+		return
+	}
+	/* #nosec */
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		r.t.Fatalf(`unable to read golden file: %v`, err)
+	}
+	if !bytes.Equal(expected, actual.Bytes()) {
+		r.t.Errorf("value does not match golden file %s\nexpected:\n%s\ngot:\n%s", path, expected, actual.Bytes())
+	}
+}
@@ -0,0 +1,36 @@
+package hieratest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+)
+
+func TestServe_panic(t *testing.T) {
+	require.Panic(t, func() {
+		serve(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic(`boom`) }),
+			httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, `/`, nil))
+	}, `boom`)
+}
+
+type fatalT struct{}
+
+func (fatalT) Helper() {}
+
+func (fatalT) Errorf(format string, args ...interface{}) {
+	panic(fmt.Sprintf(format, args...))
+}
+
+func (fatalT) Fatalf(format string, args ...interface{}) {
+	panic(fmt.Sprintf(format, args...))
+}
+
+func TestResult_invalidResponses(t *testing.T) {
+	r := &Result{t: fatalT{}, Status: http.StatusOK, Body: `{`}
+	require.Panic(t, func() { r.decode([]byte(r.Body), ``) }, `unable to decode response`)
+	require.Panic(t, func() { r.decode([]byte(`{}`), `[`) }, `unable to decode X-Hiera-Sensitive header`)
+	require.Panic(t, func() { r.AssertGolden(`testdata/my_dh.golden`) }, `unable to indent response`)
+}
@@ -0,0 +1,141 @@
+package hieratest_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/hieratest"
+)
+
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	panic(fmt.Sprintf(format, args...))
+}
+
+func newHarness(t hieratest.T) *hieratest.Harness {
+	h := hieratest.New(t)
+	reg := h.Registry()
+	reg.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		if p, ok := ctx.IntOption(`port`); ok {
+			return vf.Map(`host`, `example.com`, `port`, p)
+		}
+		return nil
+	})
+	reg.DataDig(`my_dd`, func(ctx hiera.ProviderContext, key dgo.Array) dgo.Value {
+		if key.Equals(vf.Values(`config`, 1)) {
+			return vf.String(`/a/b`)
+		}
+		return nil
+	})
+	reg.LookupKey(`my_lk`, func(ctx hiera.ProviderContext, key string) dgo.Value {
+		switch key {
+		case `fail`:
+			panic(errors.New(`goodbye`))
+		case `secret`:
+			return vf.Sensitive(`xyz`)
+		}
+		return ctx.Option(key)
+	})
+	return h
+}
+
+func TestHarness(t *testing.T) {
+	h := newHarness(t)
+	h.CallDataHash(`my_dh`, map[string]interface{}{`port`: 8080}).AssertFound(map[string]interface{}{
+		`host`: `example.com`, `port`: 8080})
+	h.CallDataHash(`my_dh`, nil).AssertNotFound()
+	h.CallDataDig(`my_dd`, []interface{}{`config`, 1}, nil).AssertFound(`/a/b`)
+	h.CallDataDig(`my_dd`, []interface{}{`config`, 2}, nil).AssertNotFound()
+	h.CallLookupKey(`my_lk`, `a`, map[string]interface{}{`a`: []int{1, 2}}).AssertFound([]int{1, 2})
+	h.CallLookupKey(`my_lk`, `fail`, nil).AssertError(`goodbye`)
+	r := h.CallLookupKey(`my_lk`, `secret`, nil)
+	r.AssertFound(`xyz`)
+	require.Equal(t, []string{``}, r.Sensitive)
+	h.CallDataHash(`my_dh`, map[string]interface{}{`port`: 8080}).AssertGolden(`testdata/my_dh.golden`)
+}
+
+func TestHarness_abortedStream(t *testing.T) {
+	h := hieratest.New(t)
+	h.Registry().StreamingDataHash(`my_sdh`, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) {
+		yield(`a`, vf.Integer(1))
+		panic(errors.New(`goodbye`))
+	})
+	r := h.CallDataHash(`my_sdh`, nil)
+	r.AssertError(`response aborted after a partial body: {"a":1`)
+	require.Equal(t, 500, r.Status)
+}
+
+func TestHarness_SetHost(t *testing.T) {
+	h := hieratest.New(t)
+	h.Registry().DataHash(`host`, func(ctx hiera.ProviderContext) dgo.Value {
+		return vf.Map(`level`, ctx.Level(), `environment`, ctx.Environment(), `invocation`, ctx.InvocationID())
+	})
+	h.SetHost(hiera.HostInfo{Level: `common`, Environment: `test`, InvocationID: `42`})
+	h.CallDataHash(`host`, nil).AssertFound(map[string]interface{}{
+		`level`: `common`, `environment`: `test`, `invocation`: `42`})
+}
+
+func TestHarness_failures(t *testing.T) {
+	r := &recorder{}
+	h := newHarness(r)
+	h.CallDataHash(`my_dh`, nil).AssertFound(`x`)
+	h.CallDataHash(`my_dh`, map[string]interface{}{`port`: 8080}).AssertFound(`x`)
+	h.CallDataHash(`my_dh`, map[string]interface{}{`port`: 8080}).AssertNotFound()
+	h.CallDataHash(`my_dh`, nil).AssertError(`x`)
+	h.CallLookupKey(`my_lk`, `fail`, nil).AssertError(`hello`)
+	h.CallDataHash(`my_dh`, nil).AssertGolden(`testdata/my_dh.golden`)
+	h.CallDataHash(`my_dh`, map[string]interface{}{`port`: 9090}).AssertGolden(`testdata/my_dh.golden`)
+	require.Equal(t, 7, len(r.errors))
+	require.Equal(t, `expected a value, got status 404: 404 value not found`, r.errors[0])
+	require.Equal(t, `expected error containing "hello", got "goodbye"`, r.errors[4])
+	require.Panic(t, func() {
+		h.CallDataHash(`my_dh`, map[string]interface{}{`port`: 8080}).AssertGolden(`testdata/missing.golden`)
+	}, `unable to read`)
+	require.Panic(t, func() { h.CallDataDig(`my_dd`, []interface{}{math.NaN()}, nil) }, `unable to encode key`)
+	require.Panic(t, func() { h.CallDataHash(`my_dh`, map[string]interface{}{`port`: math.NaN()}) },
+		`unable to encode options`)
+}
+
+func TestHarness_updateGolden(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `hieratest`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	golden := filepath.Join(dir, `my_dh.golden`)
+
+	_ = os.Setenv(hieratest.UpdateGoldenEnv, `true`)
+	h := newHarness(t)
+	h.CallDataHash(`my_dh`, map[string]interface{}{`port`: 8080}).AssertGolden(golden)
+	_ = os.Unsetenv(hieratest.UpdateGoldenEnv)
+
+	h.CallDataHash(`my_dh`, map[string]interface{}{`port`: 8080}).AssertGolden(golden)
+}
+
+func TestHarness_updateGolden_error(t *testing.T) {
+	_ = os.Setenv(hieratest.UpdateGoldenEnv, `true`)
+	defer func() { _ = os.Unsetenv(hieratest.UpdateGoldenEnv) }()
+	h := newHarness(&recorder{})
+	require.Panic(t, func() {
+		h.CallDataHash(`my_dh`, map[string]interface{}{`port`: 8080}).AssertGolden(`testdata/missing/my_dh.golden`)
+	}, `unable to write golden file`)
+}
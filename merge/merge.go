@@ -0,0 +1,383 @@
+// Package merge implements the merge strategies that Hiera uses to combine the values that a lookup finds in
+// several places. Plugins that aggregate several sources, e.g. multiple files or several API calls, can use them to
+// combine the values of the sources in the same way as Hiera would.
+//
+// The strategies are:
+//
+//	first   the value with the highest priority is used, nothing is merged
+//	unique  arrays and scalars are flattened into one array of unique values, values of higher priority first
+//	hash    the entries of maps are merged, an entry of higher priority replaces an entry with the same key
+//	deep    maps are merged recursively and arrays are merged into arrays of unique values
+//
+// The deep strategy accepts the options "knockout_prefix", "merge_hash_arrays", and "sort_merged_arrays", see
+// Options.
+package merge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/typ"
+	"github.com/lyraproj/dgo/vf"
+)
+
+type (
+	// Strategy merges two values
+	Strategy interface {
+		// Name returns the name of the strategy, i.e. "first", "unique", "hash", or "deep"
+		Name() string
+
+		// Merge returns the result of merging the given values where higher takes precedence over lower. Either
+		// value may be nil. An error is returned when the strategy cannot merge values of the given types.
+		Merge(higher, lower dgo.Value) (dgo.Value, error)
+	}
+
+	// Options are the options of the deep strategy
+	Options struct {
+		// KnockoutPrefix, when not empty, is a prefix that removes values of lower priority. An array element such
+		// as "--x" removes the element "x" from the merged array and a map key such as "--x" removes the entry with
+		// the key "x" from the merged map, given that the prefix is "--". The knockout values are not included
+		// in the result.
+		KnockoutPrefix string
+
+		// MergeHashArrays makes the deep strategy merge two arrays that only contain maps by merging the maps at
+		// the same index, rather than by concatenating the arrays.
+		MergeHashArrays bool
+
+		// SortMergedArrays makes the deep strategy sort the arrays that it merges
+		SortMergedArrays bool
+	}
+
+	first  struct{}
+	unique struct{}
+	hash   struct{}
+	deep   struct{ o Options }
+)
+
+// First returns the strategy that uses the value of the highest priority
+func First() Strategy {
+	return first{}
+}
+
+// Unique returns the strategy that flattens arrays and scalars into an array of unique values
+func Unique() Strategy {
+	return unique{}
+}
+
+// Hash returns the strategy that merges the entries of maps without recursing into their values
+func Hash() Strategy {
+	return hash{}
+}
+
+// Deep returns the strategy that merges maps recursively using the given options
+func Deep(o Options) Strategy {
+	return deep{o: o}
+}
+
+// FromValue returns the strategy that the given value describes. The value is either the name of a strategy or a
+// map in the form used in Hiera's lookup_options, e.g.
+//
+//	{"strategy": "deep", "knockout_prefix": "--", "sort_merged_arrays": true}
+//
+// The first strategy is returned when the value is nil.
+func FromValue(v dgo.Value) (Strategy, error) {
+	switch v := v.(type) {
+	case nil:
+		return First(), nil
+	case dgo.String:
+		return byName(v.GoString(), nil)
+	case dgo.Map:
+		name, ok := v.Get(`strategy`).(dgo.String)
+		if !ok {
+			return nil, fmt.Errorf(`merge strategy map must have a string "strategy" entry`)
+		}
+		return byName(name.GoString(), v)
+	}
+	if v == vf.Nil {
+		return First(), nil
+	}
+	return nil, fmt.Errorf(`merge strategy must be a string or a map, got %s`, describe(v))
+}
+
+func byName(name string, options dgo.Map) (Strategy, error) {
+	var s Strategy
+	switch name {
+	case `first`:
+		s = First()
+	case `unique`:
+		s = Unique()
+	case `hash`:
+		s = Hash()
+	case `deep`:
+		o, err := deepOptions(options)
+		if err != nil {
+			return nil, err
+		}
+		return Deep(o), nil
+	default:
+		return nil, fmt.Errorf(`unknown merge strategy %q`, name)
+	}
+	if options != nil && options.Len() > 1 {
+		return nil, fmt.Errorf(`merge strategy %q has no options`, name)
+	}
+	return s, nil
+}
+
+// deepOptions returns the Options found in the given map, which may be nil
+func deepOptions(options dgo.Map) (o Options, err error) {
+	if options == nil {
+		return
+	}
+	options.EachEntry(func(e dgo.MapEntry) {
+		if err != nil {
+			return
+		}
+		switch e.Key().String() {
+		case `strategy`:
+		case `knockout_prefix`:
+			if p, ok := e.Value().(dgo.String); ok {
+				o.KnockoutPrefix = p.GoString()
+			} else {
+				err = fmt.Errorf(`merge option "knockout_prefix" must be a string, got %s`, describe(e.Value()))
+			}
+		case `merge_hash_arrays`:
+			o.MergeHashArrays, err = boolOption(e)
+		case `sort_merged_arrays`:
+			o.SortMergedArrays, err = boolOption(e)
+		default:
+			err = fmt.Errorf(`unknown option %q for merge strategy "deep"`, e.Key().String())
+		}
+	})
+	return
+}
+
+// describe returns the generic type of the given value
+func describe(v dgo.Value) string {
+	return typ.Generic(v.Type()).String()
+}
+
+func boolOption(e dgo.MapEntry) (bool, error) {
+	if b, ok := e.Value().(dgo.Boolean); ok {
+		return b.GoBool(), nil
+	}
+	return false, fmt.Errorf(`merge option %q must be a boolean, got %s`, e.Key().String(), describe(e.Value()))
+}
+
+// Values merges the given values using the given strategy. The values are given in order of priority, highest
+// first, and nil values are skipped. The returned value is nil when all values are nil.
+func Values(s Strategy, values ...dgo.Value) (dgo.Value, error) {
+	// The values are merged starting with the lowest priority so that a knockout value removes values from all
+	// values of lower priority
+	var result dgo.Value
+	for i := len(values) - 1; i >= 0; i-- {
+		v := values[i]
+		if v == nil {
+			continue
+		}
+		var err error
+		if result, err = s.Merge(v, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (first) Name() string {
+	return `first`
+}
+
+func (first) Merge(higher, lower dgo.Value) (dgo.Value, error) {
+	if higher == nil {
+		return lower, nil
+	}
+	return higher, nil
+}
+
+func (unique) Name() string {
+	return `unique`
+}
+
+func (unique) Merge(higher, lower dgo.Value) (dgo.Value, error) {
+	var vs []dgo.Value
+	for _, v := range []dgo.Value{higher, lower} {
+		var err error
+		if vs, err = flatten(v, vs); err != nil {
+			return nil, err
+		}
+	}
+	return vf.Array(vs).Unique(), nil
+}
+
+// flatten appends the given value to the given slice, or its elements when it is an array
+func flatten(v dgo.Value, vs []dgo.Value) ([]dgo.Value, error) {
+	switch v := v.(type) {
+	case nil:
+	case dgo.Array:
+		for i := 0; i < v.Len(); i++ {
+			var err error
+			if vs, err = flatten(v.Get(i), vs); err != nil {
+				return nil, err
+			}
+		}
+	case dgo.Map:
+		return nil, fmt.Errorf(`merge strategy "unique" cannot merge a map`)
+	default:
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+func (hash) Name() string {
+	return `hash`
+}
+
+func (hash) Merge(higher, lower dgo.Value) (dgo.Value, error) {
+	hm, err := hashArg(higher)
+	if err != nil {
+		return nil, err
+	}
+	lm, err := hashArg(lower)
+	if err != nil {
+		return nil, err
+	}
+	if lm == nil {
+		return hm, nil
+	}
+	if hm == nil {
+		return lm, nil
+	}
+	r := hm.Copy(false)
+	lm.EachEntry(func(e dgo.MapEntry) {
+		if r.Get(e.Key()) == nil {
+			r.Put(e.Key(), e.Value())
+		}
+	})
+	r.Freeze()
+	return r, nil
+}
+
+func hashArg(v dgo.Value) (dgo.Map, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case dgo.Map:
+		return v, nil
+	}
+	return nil, fmt.Errorf(`merge strategy "hash" can only merge maps, got %s`, describe(v))
+}
+
+func (deep) Name() string {
+	return `deep`
+}
+
+func (d deep) Merge(higher, lower dgo.Value) (dgo.Value, error) {
+	if higher == nil {
+		higher, lower = lower, nil
+	}
+	return d.merge(higher, lower), nil
+}
+
+// merge merges the given values. The lower value may be nil, in which case the knockout values are removed from
+// the higher value.
+func (d deep) merge(higher, lower dgo.Value) dgo.Value {
+	switch h := higher.(type) {
+	case dgo.Map:
+		l, _ := lower.(dgo.Map)
+		return d.mergeMaps(h, l)
+	case dgo.Array:
+		l, _ := lower.(dgo.Array)
+		return d.mergeArrays(h, l)
+	}
+	return higher
+}
+
+func (d deep) mergeMaps(h, l dgo.Map) dgo.Value {
+	r := vf.MutableMap(nil)
+	var knockouts []dgo.Value
+	h.EachEntry(func(e dgo.MapEntry) {
+		if k, ok := d.knockout(e.Key()); ok {
+			knockouts = append(knockouts, k)
+			return
+		}
+		var lv dgo.Value
+		if l != nil {
+			lv = l.Get(e.Key())
+		}
+		r.Put(e.Key(), d.merge(e.Value(), lv))
+	})
+	if l != nil {
+		l.EachEntry(func(e dgo.MapEntry) {
+			if r.Get(e.Key()) == nil && !contains(knockouts, e.Key()) {
+				r.Put(e.Key(), e.Value())
+			}
+		})
+	}
+	r.Freeze()
+	return r
+}
+
+func (d deep) mergeArrays(h, l dgo.Array) dgo.Value {
+	var vs []dgo.Value
+	if d.o.MergeHashArrays && l != nil && allMaps(h) && allMaps(l) {
+		for i := 0; i < h.Len() || i < l.Len(); i++ {
+			switch {
+			case i >= l.Len():
+				vs = append(vs, d.merge(h.Get(i), nil))
+			case i >= h.Len():
+				vs = append(vs, l.Get(i))
+			default:
+				vs = append(vs, d.merge(h.Get(i), l.Get(i)))
+			}
+		}
+	} else {
+		var knockouts []dgo.Value
+		add := func(v dgo.Value) {
+			if !contains(vs, v) && !contains(knockouts, v) {
+				vs = append(vs, v)
+			}
+		}
+		h.Each(func(v dgo.Value) {
+			if k, ok := d.knockout(v); ok {
+				knockouts = append(knockouts, k)
+				return
+			}
+			add(d.merge(v, nil))
+		})
+		if l != nil {
+			l.Each(add)
+		}
+	}
+	r := vf.Array(vs)
+	if d.o.SortMergedArrays {
+		r = r.Sort()
+	}
+	return r
+}
+
+// knockout returns the value that the given value knocks out and true, or nil and false if the given value isn't
+// a knockout value
+func (d deep) knockout(v dgo.Value) (dgo.Value, bool) {
+	if d.o.KnockoutPrefix != `` {
+		if s, ok := v.(dgo.String); ok && strings.HasPrefix(s.GoString(), d.o.KnockoutPrefix) {
+			return vf.String(s.GoString()[len(d.o.KnockoutPrefix):]), true
+		}
+	}
+	return nil, false
+}
+
+func allMaps(a dgo.Array) bool {
+	return a.All(func(v dgo.Value) bool {
+		_, ok := v.(dgo.Map)
+		return ok
+	})
+}
+
+func contains(vs []dgo.Value, v dgo.Value) bool {
+	for _, e := range vs {
+		if e.Equals(v) {
+			return true
+		}
+	}
+	return false
+}
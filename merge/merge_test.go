@@ -0,0 +1,126 @@
+package merge_test
+
+import (
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/merge"
+)
+
+func mergeValues(t *testing.T, s merge.Strategy, values ...dgo.Value) dgo.Value {
+	t.Helper()
+	v, err := merge.Values(s, values...)
+	require.Nil(t, err)
+	return v
+}
+
+func TestFirst(t *testing.T) {
+	s := merge.First()
+	require.Equal(t, `first`, s.Name())
+	require.Equal(t, vf.Map(`a`, 1), mergeValues(t, s, nil, vf.Map(`a`, 1), vf.Map(`a`, 2, `b`, 2)))
+	require.True(t, mergeValues(t, s) == nil)
+	v, err := s.Merge(nil, vf.Integer(1))
+	require.Nil(t, err)
+	require.Equal(t, 1, v)
+}
+
+func TestUnique(t *testing.T) {
+	s := merge.Unique()
+	require.Equal(t, `unique`, s.Name())
+	require.Equal(t, vf.Values(`a`, `b`, `c`, `d`),
+		mergeValues(t, s, vf.Values(`a`, vf.Values(`b`)), vf.String(`c`), vf.Values(`b`, `d`, `a`)))
+	require.Equal(t, vf.Values(1), mergeValues(t, s, vf.Integer(1)))
+	_, err := merge.Values(s, vf.Values(1), vf.Map(`a`, 1))
+	require.Match(t, `cannot merge a map`, err.Error())
+	_, err = merge.Values(s, vf.Values(1, vf.Values(vf.Map(`a`, 1))))
+	require.Match(t, `cannot merge a map`, err.Error())
+}
+
+func TestHash(t *testing.T) {
+	s := merge.Hash()
+	require.Equal(t, `hash`, s.Name())
+	require.Equal(t, vf.Map(`a`, 1, `b`, vf.Map(`x`, 1), `c`, 3),
+		mergeValues(t, s, vf.Map(`a`, 1, `b`, vf.Map(`x`, 1)), vf.Map(`a`, 2, `b`, vf.Map(`y`, 2), `c`, 3)))
+	_, err := merge.Values(s, vf.Map(`a`, 1), vf.Values(1))
+	require.Match(t, `can only merge maps, got \[\]int`, err.Error())
+	_, err = s.Merge(vf.Map(`a`, 1), vf.Values(1))
+	require.Match(t, `can only merge maps, got \[\]int`, err.Error())
+	v, err := s.Merge(nil, vf.Map(`a`, 1))
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`a`, 1), v)
+}
+
+func TestDeep(t *testing.T) {
+	s := merge.Deep(merge.Options{})
+	require.Equal(t, `deep`, s.Name())
+	require.Equal(t,
+		vf.Map(`a`, 1, `b`, vf.Map(`x`, 1, `y`, 2, `z`, vf.Values(1, 2, 3)), `c`, 3),
+		mergeValues(t, s,
+			vf.Map(`a`, 1, `b`, vf.Map(`x`, 1, `z`, vf.Values(1, 2))),
+			vf.Map(`a`, 2, `b`, vf.Map(`y`, 2, `z`, vf.Values(3, 2)), `c`, 3)))
+
+	// Scalars are not merged
+	require.Equal(t, `x`, mergeValues(t, s, vf.String(`x`), vf.Map(`a`, 1)))
+
+	v, err := s.Merge(nil, vf.Map(`a`, 1))
+	require.Nil(t, err)
+	require.Equal(t, vf.Map(`a`, 1), v)
+}
+
+func TestDeep_knockout(t *testing.T) {
+	s := merge.Deep(merge.Options{KnockoutPrefix: `--`})
+	require.Equal(t,
+		vf.Map(`a`, vf.Values(`x`, `z`), `c`, vf.Map(`d`, vf.Values(`e`))),
+		mergeValues(t, s,
+			vf.Map(`a`, vf.Values(`x`, `--y`), `--b`, nil, `c`, vf.Map(`d`, vf.Values(`--f`, `e`))),
+			vf.Map(`a`, vf.Values(`y`, `z`), `b`, 1)))
+}
+
+func TestDeep_hashArraysAndSort(t *testing.T) {
+	s := merge.Deep(merge.Options{MergeHashArrays: true})
+	require.Equal(t,
+		vf.Values(vf.Map(`a`, 1, `b`, 2), vf.Map(`c`, 3)),
+		mergeValues(t, s, vf.Values(vf.Map(`a`, 1)), vf.Values(vf.Map(`a`, 0, `b`, 2), vf.Map(`c`, 3))))
+	require.Equal(t,
+		vf.Values(vf.Map(`a`, 1, `b`, 2), vf.Map(`c`, 3)),
+		mergeValues(t, s, vf.Values(vf.Map(`a`, 1), vf.Map(`c`, 3)), vf.Values(vf.Map(`b`, 2))))
+
+	s = merge.Deep(merge.Options{SortMergedArrays: true})
+	require.Equal(t, vf.Values(1, 2, 3, 4), mergeValues(t, s, vf.Values(4, 2), vf.Values(3, 1, 2)))
+}
+
+func TestFromValue(t *testing.T) {
+	s, err := merge.FromValue(nil)
+	require.Nil(t, err)
+	require.Equal(t, `first`, s.Name())
+	s, err = merge.FromValue(vf.Nil)
+	require.Nil(t, err)
+	require.Equal(t, `first`, s.Name())
+
+	for _, n := range []string{`first`, `unique`, `hash`, `deep`} {
+		s, err = merge.FromValue(vf.String(n))
+		require.Nil(t, err)
+		require.Equal(t, n, s.Name())
+	}
+
+	s, err = merge.FromValue(vf.Map(`strategy`, `deep`, `knockout_prefix`, `--`, `sort_merged_arrays`, true))
+	require.Nil(t, err)
+	require.Equal(t, vf.Values(`a`, `b`), mergeValues(t, s, vf.Values(`b`, `--c`), vf.Values(`c`, `a`)))
+
+	for msg, v := range map[string]dgo.Value{
+		`unknown merge strategy "last"`:                     vf.String(`last`),
+		`must have a string "strategy" entry`:               vf.Map(`knockout_prefix`, `--`),
+		`unknown option "depth" for merge strategy "deep"`:  vf.Map(`strategy`, `deep`, `depth`, 2, `x`, 1),
+		`"merge_hash_arrays" must be a boolean, got string`: vf.Map(`strategy`, `deep`, `merge_hash_arrays`, `yes`),
+		`"knockout_prefix" must be a string, got int`:       vf.Map(`strategy`, `deep`, `knockout_prefix`, 1),
+		`merge strategy "hash" has no options`:              vf.Map(`strategy`, `hash`, `knockout_prefix`, `--`),
+		`merge strategy must be a string or a map, got int`: vf.Integer(1),
+	} {
+		_, err = merge.FromValue(v)
+		require.NotNil(t, err)
+		require.Match(t, msg, err.Error())
+	}
+}
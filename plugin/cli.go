@@ -0,0 +1,346 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/decrypt"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
+	"github.com/lyraproj/hierasdk/routes"
+)
+
+// serveFunc is used by the "serve" command to start the server on the given port range. It is assigned by the
+// server when it is included in the build.
+var serveFunc func(name string, minPort, maxPort int, stdout, stderr io.Writer) int
+
+// supervised makes serveFunc serve the functions from a worker process that can be replaced, see SuperviseAndExit
+var supervised bool
+
+type optionFlags map[string]interface{}
+
+func (o optionFlags) String() string {
+	return ``
+}
+
+func (o optionFlags) Set(s string) error {
+	eqi := strings.IndexByte(s, '=')
+	if eqi <= 0 {
+		return fmt.Errorf(`option %q is not in the form name=value`, s)
+	}
+	o[s[:eqi]] = parseValue(s[eqi+1:])
+	return nil
+}
+
+// parseValue returns the JSON value represented by the given string, or the string itself if it isn't valid JSON
+func parseValue(s string) dgo.Value {
+	if v, err := vf.UnmarshalJSON([]byte(s)); err == nil {
+		return v
+	}
+	return vf.String(s)
+}
+
+// RunCLI runs the plugin as a command line tool so that its registered functions can be exercised from a shell
+// without a Hiera host. The given args must not include the program name. The recognized commands are:
+//
+//	list                                          list the registered functions
+//	call <kind> <name> [--key K] [--option N=V]   call a function and print its result
+//	serve [--port P] [--supervise]                serve the functions without the magic cookie
+//	encrypt --scheme S --key F [value]            encrypt a value (read from stdin if not given)
+//	keygen --scheme S --out F [--force]           generate the key file(s) for a scheme
+//
+// The call command also accepts --config, --datadir, --level, and --environment to send the corresponding
+// hiera.HostInfo. The schemes understood by encrypt and keygen are "secretbox" and "x25519".
+//
+// The return value is the exit code of the command.
+func RunCLI(name string, args []string, stdout, stderr io.Writer) int {
+	return runCLIWithInput(name, args, os.Stdin, stdout, stderr)
+}
+
+func runCLIWithInput(name string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return usage(name, stderr)
+	}
+	switch args[0] {
+	case `list`:
+		return list(stdout)
+	case `call`:
+		return call(name, args[1:], stdout, stderr)
+	case `serve`:
+		return serveCmd(name, args[1:], stdout, stderr)
+	case `encrypt`:
+		return encrypt(args[1:], stdin, stdout, stderr)
+	case `keygen`:
+		return keygen(args[1:], stdout, stderr)
+	case `help`, `-h`, `--help`:
+		_ = usage(name, stdout)
+		return 0
+	default:
+		_, _ = fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		return usage(name, stderr)
+	}
+}
+
+func usage(name string, w io.Writer) int {
+	_, _ = fmt.Fprintf(w, `Usage:
+  %[1]s list
+  %[1]s call <data_dig|data_hash|lookup_key> <function name> [--key <key>] [--option <name>=<value>]...
+  %[1]s serve [--port <port>] [--supervise]
+  %[1]s encrypt --scheme <secretbox|x25519> --key <key file> [<value>]
+  %[1]s keygen --scheme <secretbox|x25519> --out <key file> [--force]
+
+Option values and data_dig keys are parsed as JSON. Values that aren't valid JSON are used as strings. The call
+command also accepts --config <hiera.yaml path>, --datadir <dir>, --level <name>, and --environment <name>.
+
+The encrypt command reads the value from stdin when it isn't given as an argument. For x25519, the key file is the
+public key. The keygen command writes the x25519 public key to the key file name with the extension ".pub". It
+doesn't overwrite existing key files unless --force is given.
+`, name)
+	return 1
+}
+
+func list(stdout io.Writer) int {
+	md := register.Metadata()
+	each := func(tp string, n string) {
+		desc := ``
+		if fm, ok := md.Get(tp).(dgo.Map); ok {
+			if m, ok := fm.Get(n).(dgo.Map); ok {
+				if d := m.Get(`description`); d != nil {
+					desc = d.String()
+				}
+			}
+		}
+		if desc == `` {
+			_, _ = fmt.Fprintf(stdout, "%s %s\n", tp, n)
+		} else {
+			_, _ = fmt.Fprintf(stdout, "%s %s: %s\n", tp, n, desc)
+		}
+	}
+	_, functions := routes.Register()
+	functions.EachEntry(func(e dgo.MapEntry) {
+		tp := e.Key().String()
+		e.Value().(dgo.Array).Each(func(n dgo.Value) { each(tp, n.String()) })
+	})
+	return 0
+}
+
+func call(name string, args []string, stdout, stderr io.Writer) int {
+	if len(args) < 2 {
+		return usage(name, stderr)
+	}
+	kind, fn := args[0], args[1]
+	opts := optionFlags{}
+	fs := flag.NewFlagSet(`call`, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	key := fs.String(`key`, ``, `the key to look up`)
+	fs.Var(opts, `option`, `an option in the form name=value`)
+	var host hiera.HostInfo
+	fs.StringVar(&host.ConfigPath, `config`, ``, `the path of the hiera.yaml file`)
+	fs.StringVar(&host.DataDir, `datadir`, ``, `the datadir of the hierarchy level`)
+	fs.StringVar(&host.Level, `level`, ``, `the name of the hierarchy level`)
+	fs.StringVar(&host.Environment, `environment`, ``, `the name of the environment`)
+	if err := fs.Parse(args[2:]); err != nil {
+		return 1
+	}
+
+	q := url.Values{}
+	if *key != `` {
+		q.Set(`key`, *key)
+	}
+	if len(opts) > 0 {
+		// The options are parsed from JSON or are strings, so they can always be encoded
+		js, _ := json.Marshal(vf.Map(map[string]interface{}(opts)))
+		q.Set(`options`, string(js))
+	}
+	host.Encode(q)
+	handler, _ := routes.Register()
+	r := httptest.NewRequest(http.MethodGet, `/`+kind+`/`+fn+`?`+q.Encode(), nil)
+	rr := httptest.NewRecorder()
+	if serveRecorded(handler, rr, r) {
+		_, _ = fmt.Fprintf(stderr, "%s %s: response aborted after a partial body: %s\n", kind, fn, rr.Body.String())
+		return 1
+	}
+	if rr.Code != http.StatusOK {
+		_, _ = fmt.Fprintf(stderr, "%s %s: %s", kind, fn, rr.Body.String())
+		return 1
+	}
+	// The body of a successful response is always JSON since the request doesn't ask for another encoding
+	var out bytes.Buffer
+	_ = json.Indent(&out, rr.Body.Bytes(), ``, `  `)
+	_, _ = out.WriteTo(stdout)
+	return 0
+}
+
+// serveRecorded serves the given request and returns true if the handler aborted the response, which a streaming
+// data_hash function does when it fails after its first entry has been sent
+func serveRecorded(handler http.Handler, w http.ResponseWriter, r *http.Request) (aborted bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			if e != http.ErrAbortHandler {
+				panic(e)
+			}
+			aborted = true
+		}
+	}()
+	handler.ServeHTTP(w, r)
+	return false
+}
+
+func serveCmd(name string, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet(`serve`, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	port := fs.Int(`port`, 0, `the port to listen on. Default is the first free port in the range given by the `+
+		`HIERA_MIN_PORT and HIERA_MAX_PORT environment variables`)
+	supervise := fs.Bool(`supervise`, false, `serve from a worker process that is replaced on SIGHUP or when the `+
+		`executable changes`)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if *supervise {
+		supervised = true
+	}
+	minPort := getEnvInt(`HIERA_MIN_PORT`, defaultMinPort)
+	maxPort := getEnvInt(`HIERA_MAX_PORT`, defaultMaxPort)
+	if *port != 0 {
+		minPort = *port
+		maxPort = *port
+	}
+	if serveFunc == nil {
+		_, _ = fmt.Fprintln(stderr, `serve is not available in this build`)
+		return 1
+	}
+	return serveFunc(name, minPort, maxPort, stdout, stderr)
+}
+
+func encrypt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet(`encrypt`, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	scheme := fs.String(`scheme`, `secretbox`, `the encryption scheme, "secretbox" or "x25519"`)
+	keyFile := fs.String(`key`, ``, `the file containing the secretbox key or the x25519 public key`)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	var value []byte
+	var err error
+	switch fs.NArg() {
+	case 0:
+		value, err = ioutil.ReadAll(stdin)
+	case 1:
+		value = []byte(fs.Arg(0))
+	default:
+		err = errors.New(`encrypt takes at most one value`)
+	}
+	var key *[32]byte
+	if err == nil {
+		key, err = decrypt.ReadKeyFile(*keyFile)
+	}
+	var enc string
+	if err == nil {
+		switch *scheme {
+		case `secretbox`:
+			enc, err = decrypt.EncryptSecretbox(key, value)
+		case `x25519`:
+			enc, err = decrypt.EncryptX25519(key, value)
+		default:
+			err = fmt.Errorf(`unknown scheme %q`, *scheme)
+		}
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+	_, _ = fmt.Fprintln(stdout, enc)
+	return 0
+}
+
+func keygen(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet(`keygen`, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	scheme := fs.String(`scheme`, `secretbox`, `the encryption scheme, "secretbox" or "x25519"`)
+	out := fs.String(`out`, ``, `the file to write the key to`)
+	force := fs.Bool(`force`, false, `overwrite existing key files`)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	var err error
+	if *out == `` {
+		err = errors.New(`keygen requires --out`)
+	}
+	if err == nil {
+		switch *scheme {
+		case `secretbox`:
+			var key *[32]byte
+			if key, err = decrypt.GenerateSecretboxKey(); err == nil {
+				err = writeKey(*out, key, *force)
+			}
+		case `x25519`:
+			var pub, priv *[32]byte
+			// Check both files up front so that a new private key is never written next to an old public key
+			if err = checkOverwrite(*force, *out, *out+`.pub`); err == nil {
+				if pub, priv, err = decrypt.GenerateX25519Key(); err == nil {
+					if err = writeKey(*out, priv, *force); err == nil {
+						err = writeKey(*out+`.pub`, pub, *force)
+					}
+				}
+			}
+		default:
+			err = fmt.Errorf(`unknown scheme %q`, *scheme)
+		}
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+	_, _ = fmt.Fprintf(stdout, "%s key written to %s\n", *scheme, *out)
+	return 0
+}
+
+// writeKey writes the given key to a new file at the given path. An existing file is overwritten only when force
+// is true since the values that were encrypted using the key it holds could no longer be decrypted.
+func writeKey(path string, key *[32]byte, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	/* #nosec */
+	f, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			err = existsError(path)
+		}
+		return err
+	}
+	_, err = f.WriteString(decrypt.EncodeKey(key) + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// checkOverwrite returns an error for the first of the given paths that exists unless force is true
+func checkOverwrite(force bool, paths ...string) error {
+	if !force {
+		for _, path := range paths {
+			if _, err := os.Stat(path); err == nil {
+				return existsError(path)
+			}
+		}
+	}
+	return nil
+}
+
+func existsError(path string) error {
+	return fmt.Errorf(`%s already exists, use --force to overwrite it`, path)
+}
@@ -0,0 +1,238 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/decrypt"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
+)
+
+func runCLI(args ...string) (int, string, string) {
+	var out, err bytes.Buffer
+	ec := RunCLI(`myplugin`, args, &out, &err)
+	return ec, out.String(), err.String()
+}
+
+func TestRunCLI_list(t *testing.T) {
+	register.Clean()
+	register.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value { return nil },
+		register.WithDescription(`my data hash`))
+	register.LookupKey(`my_lk`, func(ctx hiera.ProviderContext, key string) dgo.Value { return nil })
+	ec, out, _ := runCLI(`list`)
+	require.Equal(t, 0, ec)
+	require.Equal(t, "data_hash my_dh: my data hash\nlookup_key my_lk\n", out)
+}
+
+func TestRunCLI_call(t *testing.T) {
+	register.Clean()
+	register.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		return vf.Map(`path`, ctx.Option(`path`), `port`, ctx.Option(`port`))
+	})
+	register.DataDig(`my_dd`, func(ctx hiera.ProviderContext, key dgo.Array) dgo.Value {
+		return key
+	})
+	register.LookupKey(`my_lk`, func(ctx hiera.ProviderContext, key string) dgo.Value { return nil })
+
+	ec, out, _ := runCLI(`call`, `data_hash`, `my_dh`, `--option`, `path=/x`, `--option`, `port=8080`)
+	require.Equal(t, 0, ec)
+	require.Equal(t, "{\n  \"path\": \"/x\",\n  \"port\": 8080\n}\n", out)
+
+	ec, out, _ = runCLI(`call`, `data_dig`, `my_dd`, `--key`, `["a",1]`)
+	require.Equal(t, 0, ec)
+	require.Equal(t, "[\n  \"a\",\n  1\n]\n", out)
+
+	ec, _, errOut := runCLI(`call`, `lookup_key`, `my_lk`, `--key`, `x`)
+	require.Equal(t, 1, ec)
+	require.Equal(t, "lookup_key my_lk: 404 value not found\n", errOut)
+
+	ec, _, errOut = runCLI(`call`, `data_hash`, `my_dh`, `--option`, `path`)
+	require.Equal(t, 1, ec)
+	require.True(t, bytes.Contains([]byte(errOut), []byte(`not in the form name=value`)))
+
+	register.LookupKey(`my_host`, func(ctx hiera.ProviderContext, key string) dgo.Value {
+		return vf.Values(ctx.ConfigPath(), ctx.DataDir(), ctx.Level(), ctx.Environment())
+	})
+	ec, out, _ = runCLI(`call`, `lookup_key`, `my_host`, `--key`, `x`, `--config`, `/etc/hiera.yaml`, `--datadir`, `data`,
+		`--level`, `common`, `--environment`, `production`)
+	require.Equal(t, 0, ec)
+	require.Equal(t, "[\n  \"/etc/hiera.yaml\",\n  \"/etc/data\",\n  \"common\",\n  \"production\"\n]\n", out)
+
+	ec, _, errOut = runCLI(`call`, `data_hash`)
+	require.Equal(t, 1, ec)
+	require.True(t, bytes.HasPrefix([]byte(errOut), []byte(`Usage:`)))
+}
+
+func TestRunCLI_callAbortedStream(t *testing.T) {
+	register.Clean()
+	register.StreamingDataHash(`my_sdh`, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) {
+		yield(`a`, vf.Integer(1))
+		panic(`goodbye`)
+	})
+	ec, _, errOut := runCLI(`call`, `data_hash`, `my_sdh`)
+	require.Equal(t, 1, ec)
+	require.Equal(t, "data_hash my_sdh: response aborted after a partial body: {\"a\":1\n", errOut)
+
+	// Other panics are not recovered
+	require.Panic(t, func() {
+		serveRecorded(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic(`boom`) }),
+			httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, `/`, nil))
+	}, `boom`)
+}
+
+func TestRunCLI_serve(t *testing.T) {
+	saved, savedSupervised := serveFunc, supervised
+	defer func() { serveFunc, supervised = saved, savedSupervised }()
+	defer func() {
+		_ = os.Unsetenv(`HIERA_MIN_PORT`)
+		_ = os.Unsetenv(`HIERA_MAX_PORT`)
+	}()
+
+	serveFunc = nil
+	ec, _, errOut := runCLI(`serve`)
+	require.Equal(t, 1, ec)
+	require.Equal(t, "serve is not available in this build\n", errOut)
+
+	var ports []int
+	serveFunc = func(name string, minPort, maxPort int, stdout, stderr io.Writer) int {
+		ports = []int{minPort, maxPort}
+		return 0
+	}
+	ec, _, _ = runCLI(`serve`)
+	require.Equal(t, 0, ec)
+	require.Equal(t, []int{defaultMinPort, defaultMaxPort}, ports)
+
+	require.Nil(t, os.Setenv(`HIERA_MIN_PORT`, `12000`))
+	require.Nil(t, os.Setenv(`HIERA_MAX_PORT`, `twelve`))
+	ec, _, _ = runCLI(`serve`)
+	require.Equal(t, 0, ec)
+	require.Equal(t, []int{12000, defaultMaxPort}, ports)
+
+	supervised = false
+	ec, _, _ = runCLI(`serve`, `--port`, `13000`, `--supervise`)
+	require.Equal(t, 0, ec)
+	require.Equal(t, []int{13000, 13000}, ports)
+	require.True(t, supervised)
+
+	ec, _, errOut = runCLI(`serve`, `--bogus`)
+	require.Equal(t, 1, ec)
+	require.True(t, strings.Contains(errOut, `flag provided but not defined`))
+}
+
+func TestRunCLI_usage(t *testing.T) {
+	ec, _, errOut := runCLI()
+	require.Equal(t, 1, ec)
+	require.True(t, bytes.HasPrefix([]byte(errOut), []byte(`Usage:`)))
+
+	ec, out, _ := runCLI(`help`)
+	require.Equal(t, 0, ec)
+	require.True(t, bytes.HasPrefix([]byte(out), []byte(`Usage:`)))
+
+	ec, _, errOut = runCLI(`bogus`)
+	require.Equal(t, 1, ec)
+	require.True(t, bytes.HasPrefix([]byte(errOut), []byte(`unknown command "bogus"`)))
+
+	ec, _, _ = runCLI(`serve`, `--port`, `x`)
+	require.Equal(t, 1, ec)
+}
+
+func TestRunCLI_encrypt(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `plugin`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	sbKey := filepath.Join(dir, `secretbox.key`)
+	xKey := filepath.Join(dir, `x25519.key`)
+
+	ec, out, _ := runCLI(`keygen`, `--out`, sbKey)
+	require.Equal(t, 0, ec)
+	require.Equal(t, "secretbox key written to "+sbKey+"\n", out)
+	ec, _, _ = runCLI(`keygen`, `--scheme`, `x25519`, `--out`, xKey)
+	require.Equal(t, 0, ec)
+
+	// Existing keys are only overwritten when --force is given
+	sbContent, err := ioutil.ReadFile(sbKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec, _, errOut := runCLI(`keygen`, `--out`, sbKey)
+	require.Equal(t, 1, ec)
+	require.Equal(t, sbKey+" already exists, use --force to overwrite it\n", errOut)
+	content, err := ioutil.ReadFile(sbKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, string(sbContent), string(content))
+	ec, _, _ = runCLI(`keygen`, `--scheme`, `x25519`, `--out`, filepath.Join(dir, `other.key`))
+	require.Equal(t, 0, ec)
+	if err = os.Remove(filepath.Join(dir, `other.key`)); err != nil {
+		t.Fatal(err)
+	}
+	ec, _, errOut = runCLI(`keygen`, `--scheme`, `x25519`, `--out`, filepath.Join(dir, `other.key`))
+	require.Equal(t, 1, ec)
+	require.True(t, strings.Contains(errOut, `other.key.pub already exists`))
+	_, err = os.Stat(filepath.Join(dir, `other.key`))
+	require.True(t, os.IsNotExist(err))
+	ec, _, _ = runCLI(`keygen`, `--out`, sbKey, `--force`)
+	require.Equal(t, 0, ec)
+	if content, err = ioutil.ReadFile(sbKey); err != nil {
+		t.Fatal(err)
+	}
+	require.NotEqual(t, string(sbContent), string(content))
+
+	opts, _ := json.Marshal(map[string]string{`secretbox_key`: sbKey, `x25519_private_key`: xKey})
+	ctx := hiera.NewProviderContext(url.Values{`options`: {string(opts)}})
+
+	ec, out, _ = runCLI(`encrypt`, `--key`, sbKey, `secret`)
+	require.Equal(t, 0, ec)
+	require.True(t, strings.HasPrefix(out, `ENC[SECRETBOX,`))
+	require.Equal(t, `secret`, decrypt.String(ctx, strings.TrimSpace(out)))
+
+	var so, se bytes.Buffer
+	ec = runCLIWithInput(`myplugin`, []string{`encrypt`, `--scheme`, `x25519`, `--key`, xKey + `.pub`},
+		strings.NewReader(`from stdin`), &so, &se)
+	require.Equal(t, 0, ec)
+	require.True(t, strings.HasPrefix(so.String(), `ENC[X25519,`))
+	require.Equal(t, `from stdin`, decrypt.String(ctx, strings.TrimSpace(so.String())))
+}
+
+func TestRunCLI_encryptErrors(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `plugin`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	key := filepath.Join(dir, `secretbox.key`)
+	ec, _, _ := runCLI(`keygen`, `--out`, key)
+	require.Equal(t, 0, ec)
+
+	for args, msg := range map[string]string{
+		`encrypt --key ` + key + ` a b`:                   "encrypt takes at most one value\n",
+		`encrypt --key ` + key + ` --scheme rot13 a`:      "unknown scheme \"rot13\"\n",
+		`encrypt --key ` + filepath.Join(dir, `x`) + ` a`: `no such file or directory`,
+		`encrypt --key ` + dir + `/../` + ` a`:            `is a directory`,
+		`keygen --scheme rot13 --out ` + key:              "unknown scheme \"rot13\"\n",
+		`keygen`:                                          "keygen requires --out\n",
+		`keygen --bogus`:                                  `flag provided but not defined`,
+		`encrypt --bogus`:                                 `flag provided but not defined`,
+	} {
+		ec, _, errOut := runCLI(strings.Fields(args)...)
+		require.Equal(t, 1, ec)
+		require.True(t, strings.Contains(errOut, msg), args)
+	}
+}
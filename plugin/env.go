@@ -0,0 +1,25 @@
+package plugin
+
+import (
+	"os"
+	"strconv"
+)
+
+const defaultMinPort = 10000
+const defaultMaxPort = 25000
+
+// The environment variables that tell a worker which inherited file descriptors hold the listening socket and the
+// pipe that it uses to tell the supervisor that it is ready
+const (
+	listenerFDEnv = `HIERA_LISTENER_FD`
+	readyFDEnv    = `HIERA_READY_FD`
+)
+
+func getEnvInt(n string, defaultValue int) int {
+	if v := os.Getenv(n); len(v) > 0 {
+		if i, err := strconv.Atoi(v); err == nil {
+			return i
+		}
+	}
+	return defaultValue
+}
@@ -13,31 +13,57 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/lyraproj/dgo/dgo"
 	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/events"
 	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
 	"github.com/lyraproj/hierasdk/routes"
 )
 
-const defaultMinPort = 10000
-const defaultMaxPort = 25000
+func init() {
+	serveFunc = serve
+}
 
-// ServeAndExit starts serving the plug-in
+// ServeAndExit starts serving the plug-in. When the plug-in is started without the magic cookie and with
+// command line arguments, it runs in CLI mode instead. See RunCLI for details.
 func ServeAndExit() {
+	if len(os.Args) > 1 && getEnvInt(`HIERA_MAGIC_COOKIE`, 0) != hiera.MagicCookie {
+		os.Exit(RunCLI(os.Args[0], os.Args[1:], os.Stdout, os.Stderr))
+	}
 	minPort := getEnvInt(`HIERA_MIN_PORT`, defaultMinPort)
 	maxPort := getEnvInt(`HIERA_MAX_PORT`, defaultMaxPort)
 	os.Exit(Serve(os.Args[0], minPort, maxPort, os.Stdout, os.Stderr))
 }
 
+// SuperviseAndExit is like ServeAndExit but the plug-in is served from a worker process that can be replaced
+// while the plug-in keeps running. The process that the host started becomes a supervisor that owns the listening
+// socket and sends the handshake. It starts a new worker from the plug-in executable when it receives SIGHUP or
+// when the executable changes, hands the socket over to it, and lets the old worker drain its in-flight requests.
+// The address in the handshake therefore stays valid across reloads. Supervision isn't supported on Windows.
+func SuperviseAndExit() {
+	supervised = true
+	ServeAndExit()
+}
+
 // Serve starts serving the plug-in using the given name, port range, stderr, and stdout
 func Serve(name string, minPort, maxPort int, stdout, stderr io.Writer) int {
 	if getEnvInt(`HIERA_MAGIC_COOKIE`, 0) != hiera.MagicCookie {
 		_, _ = fmt.Fprintf(stderr,
-			"%s is meant to be used as a Hiera RESTful plugin. It should not be started from a command shell\n", name)
+			"%[1]s is meant to be used as a Hiera RESTful plugin. It should not be started from a command shell\n"+
+				"Use '%[1]s help' to learn how to call its functions from a command shell\n", name)
 		return 1
 	}
+	return serve(name, minPort, maxPort, stdout, stderr)
+}
+
+func serve(name string, minPort, maxPort int, stdout, stderr io.Writer) int {
+	if fd := getEnvInt(listenerFDEnv, 0); fd > 0 {
+		return serveWorker(fd, stderr)
+	}
 	if minPort > maxPort {
 		_, _ = fmt.Fprintf(os.Stderr, "min port %d is greater than max port %d\n", minPort, maxPort)
 		return 1
@@ -48,6 +74,9 @@ func Serve(name string, minPort, maxPort int, stdout, stderr io.Writer) int {
 		return 1
 	}
 	handler, functions := routes.Register()
+	if supervised {
+		return supervise(listener, functions, stdout, stderr)
+	}
 	return startServer(listener, handler, functions, stdout, stderr)
 }
 
@@ -61,23 +90,34 @@ func getTCPListener(minPort, maxPort int) (net.Listener, error) {
 	return nil, fmt.Errorf(`no available port in the range %d to %d`, minPort, maxPort)
 }
 
-func getEnvInt(n string, defaultValue int) int {
-	if v := os.Getenv(n); len(v) > 0 {
-		if i, err := strconv.Atoi(v); err == nil {
-			return i
-		}
-	}
-	return defaultValue
-}
-
 func startServer(listener net.Listener, router http.Handler, functions dgo.Map, ow, ew io.Writer) int {
-	err := json.NewEncoder(ow).Encode(vf.Map(`version`, hiera.ProtoVersion, `address`, listener.Addr().String(), `functions`, functions))
-	if err != nil {
+	if err := writeHandshake(listener, functions, ow); err != nil {
 		_, _ = fmt.Fprintln(ew, err)
 		return 1
 	}
+	return runServer(listener, router, ew)
+}
 
-	server := http.Server{Handler: router}
+// writeHandshake writes the handshake that tells the host the address of the plug-in and the functions it serves
+func writeHandshake(listener net.Listener, functions dgo.Map, ow io.Writer) error {
+	hs := vf.MutableMap(nil)
+	hs.Put(`version`, hiera.ProtoVersion)
+	hs.Put(`address`, listener.Addr().String())
+	hs.Put(`functions`, functions)
+	if md := register.Metadata(); md.Len() > 0 {
+		hs.Put(`meta`, md)
+	}
+	return json.NewEncoder(ow).Encode(hs)
+}
+
+// runServer serves requests from the given listener until the process is interrupted
+func runServer(listener net.Listener, router http.Handler, ew io.Writer) int {
+	nc := &newConns{conns: make(map[net.Conn]bool)}
+	server := http.Server{Handler: router, ConnState: nc.track}
+	// End the event streams since Shutdown doesn't wait for active connections to become idle otherwise
+	server.RegisterOnShutdown(events.Global().Close)
+	stopping := make(chan bool)
+	served := make(chan bool)
 	done := make(chan bool, 1)
 	// Allow graceful shutdown of server
 	quit := make(chan os.Signal, 1)
@@ -87,17 +127,65 @@ func startServer(listener net.Listener, router http.Handler, functions dgo.Map,
 		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 		defer cancel()
 
+		// Shutdown drops the connections that haven't sent a request yet, so stop accepting connections and let
+		// the accepted ones read their request first. Connections that are not accepted remain queued for other
+		// processes that serve the same socket, see SuperviseAndExit.
 		server.SetKeepAlivesEnabled(false)
+		close(stopping)
+		_ = listener.Close()
+		<-served
+		nc.wait(ctx)
 		if err := server.Shutdown(ctx); err != nil {
 			_, _ = fmt.Fprintf(ew, "Could not gracefully shutdown the server: %v\n", err)
 		}
 		close(done)
 	}()
 
-	if err = server.Serve(listener); err != nil && err != http.ErrServerClosed {
-		_, _ = fmt.Fprintf(ew, "Could not listen on %s: %v\n", listener.Addr(), err)
-		return 1
+	err := server.Serve(listener)
+	close(served)
+	select {
+	case <-stopping:
+	default:
+		if err != http.ErrServerClosed {
+			_, _ = fmt.Fprintf(ew, "Could not listen on %s: %v\n", listener.Addr(), err)
+			return 1
+		}
 	}
 	<-done
 	return 0
 }
+
+// newConns keeps track of the connections that the server has accepted but not yet read a request from
+type newConns struct {
+	lock  sync.Mutex
+	conns map[net.Conn]bool
+}
+
+func (nc *newConns) track(c net.Conn, state http.ConnState) {
+	nc.lock.Lock()
+	if state == http.StateNew {
+		nc.conns[c] = true
+	} else {
+		delete(nc.conns, c)
+	}
+	nc.lock.Unlock()
+}
+
+// wait waits until there are no new connections or until the given context is done
+func (nc *newConns) wait(ctx context.Context) {
+	t := time.NewTicker(10 * time.Millisecond)
+	defer t.Stop()
+	for {
+		nc.lock.Lock()
+		n := len(nc.conns)
+		nc.lock.Unlock()
+		if n == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
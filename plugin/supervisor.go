@@ -0,0 +1,219 @@
+//+build !test,!windows
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/hierasdk/events"
+	"github.com/lyraproj/hierasdk/routes"
+)
+
+// workerStartTimeout is the time that a new worker has to become ready before the supervisor gives up on it
+const workerStartTimeout = 10 * time.Second
+
+// workerStopTimeout is the time that an interrupted worker has to drain its requests before it is killed
+const workerStopTimeout = 30 * time.Second
+
+// worker is a process that serves the functions using the listening socket of the supervisor
+type worker struct {
+	cmd    *exec.Cmd
+	exited chan struct{}
+	err    error
+}
+
+// supervise writes the handshake and serves the functions from a worker process. A new worker replaces the current
+// one when the process receives SIGHUP or when its executable changes. The supervisor ends when it is interrupted
+// or when the current worker exits without being replaced.
+func supervise(listener net.Listener, functions dgo.Map, ow, ew io.Writer) int {
+	lf, err := listenerFile(listener)
+	if err != nil {
+		_, _ = fmt.Fprintln(ew, err)
+		return 1
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		_, _ = fmt.Fprintln(ew, err)
+		return 1
+	}
+	if err = writeHandshake(listener, functions, ow); err != nil {
+		_, _ = fmt.Fprintln(ew, err)
+		return 1
+	}
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	return runSupervisor(exe, lf, ew, reloads(exe), quit)
+}
+
+// listenerFile returns a file that holds a duplicate of the descriptor of the given listener. Unlike the file that
+// the File method of a net.TCPListener returns, its Fd method, which os/exec calls when it passes the file to a
+// worker, doesn't switch the socket to blocking mode. The mode is shared by all processes that use the socket and
+// a worker that is blocked in accept would never notice that it has been asked to stop.
+func listenerFile(listener net.Listener) (*os.File, error) {
+	sc, ok := listener.(syscall.Conn)
+	if !ok {
+		return nil, fmt.Errorf(`cannot hand over a listener of type %T`, listener)
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	fd := -1
+	err = rc.Control(func(s uintptr) {
+		fd, err = syscall.Dup(int(s))
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The descriptor is non-blocking so os.NewFile leaves its mode alone
+	return os.NewFile(uintptr(fd), `listener`), nil
+}
+
+// reloads returns a channel that receives the reason for a reload when the process receives SIGHUP and when the
+// given executable changes
+func reloads(exe string) <-chan string {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	b := events.NewBroker()
+	changes, _ := b.Subscribe()
+	events.NewFileWatcher(b, events.DefaultPollInterval).Watch(exe, events.Event{})
+	rc := make(chan string)
+	go func() {
+		for {
+			select {
+			case <-hup:
+				rc <- `SIGHUP received`
+			case e := <-changes:
+				rc <- e.Reason
+			}
+		}
+	}()
+	return rc
+}
+
+// runSupervisor starts a worker from the given executable that serves the functions using the given listening
+// socket and replaces it with a new worker each time the reload channel receives a reason. The old worker is
+// interrupted once the new worker is ready, which makes it stop accepting connections and drain its in-flight
+// requests. The current worker is kept when a new worker fails to start.
+func runSupervisor(exe string, lf *os.File, ew io.Writer, reload <-chan string, quit <-chan os.Signal) int {
+	w, err := startWorker(exe, lf, ew)
+	if err != nil {
+		_, _ = fmt.Fprintf(ew, "Could not start worker: %v\n", err)
+		return 1
+	}
+	var draining sync.WaitGroup
+	for {
+		select {
+		case reason := <-reload:
+			nw, err := startWorker(exe, lf, ew)
+			if err != nil {
+				_, _ = fmt.Fprintf(ew, "Could not reload (%s), keeping the current worker: %v\n", reason, err)
+				continue
+			}
+			draining.Add(1)
+			go func(old *worker) {
+				old.stop()
+				draining.Done()
+			}(w)
+			w = nw
+		case <-w.exited:
+			_, _ = fmt.Fprintf(ew, "Worker exited unexpectedly: %v\n", w.err)
+			draining.Wait()
+			return 1
+		case <-quit:
+			w.stop()
+			draining.Wait()
+			return 0
+		}
+	}
+}
+
+// startWorker starts the given executable with the arguments of the current process and waits until it is ready
+// to serve requests using the given listening socket
+func startWorker(exe string, lf *os.File, ew io.Writer) (*worker, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	/* #nosec */
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), listenerFDEnv+`=3`, readyFDEnv+`=4`)
+	cmd.ExtraFiles = []*os.File{lf, pw}
+	// Only the supervisor writes to stdout since the host reads the handshake from it
+	cmd.Stdout = ew
+	cmd.Stderr = ew
+	err = cmd.Start()
+	_ = pw.Close()
+	if err != nil {
+		_ = pr.Close()
+		return nil, err
+	}
+	w := &worker{cmd: cmd, exited: make(chan struct{})}
+	go func() {
+		w.err = cmd.Wait()
+		close(w.exited)
+	}()
+
+	ready := make(chan error, 1)
+	go func() {
+		// The read fails with io.EOF when the worker exits before it is ready
+		_, err := pr.Read(make([]byte, 1))
+		_ = pr.Close()
+		ready <- err
+	}()
+	select {
+	case err = <-ready:
+		if err == nil {
+			return w, nil
+		}
+		err = errors.New(`worker exited before it was ready`)
+	case <-time.After(workerStartTimeout):
+		err = fmt.Errorf(`worker was not ready within %s`, workerStartTimeout)
+	}
+	_ = cmd.Process.Kill()
+	<-w.exited
+	return nil, err
+}
+
+// stop interrupts the worker and waits for it to exit. The worker is killed if it hasn't exited within the
+// workerStopTimeout.
+func (w *worker) stop() {
+	_ = w.cmd.Process.Signal(os.Interrupt)
+	select {
+	case <-w.exited:
+	case <-time.After(workerStopTimeout):
+		_ = w.cmd.Process.Kill()
+		<-w.exited
+	}
+}
+
+// serveWorker serves the functions using the listening socket that the worker inherited from the supervisor in the
+// given file descriptor. It tells the supervisor that it is ready before it starts serving.
+func serveWorker(fd int, ew io.Writer) int {
+	// The supervisor handles SIGHUP, which the worker receives too when it is sent to the process group
+	signal.Ignore(syscall.SIGHUP)
+	lf := os.NewFile(uintptr(fd), `listener`)
+	listener, err := net.FileListener(lf)
+	_ = lf.Close()
+	if err != nil {
+		_, _ = fmt.Fprintf(ew, "Could not use inherited listener: %v\n", err)
+		return 1
+	}
+	handler, _ := routes.Register()
+	if rfd := getEnvInt(readyFDEnv, 0); rfd > 0 {
+		rf := os.NewFile(uintptr(rfd), `ready`)
+		_, _ = rf.Write([]byte{1})
+		_ = rf.Close()
+	}
+	return runServer(listener, handler, ew)
+}
@@ -0,0 +1,99 @@
+//+build !test,!windows
+
+// The supervisor, like the server that it starts, is excluded from builds with the "test" tag, which is what the
+// coverage run uses, so these tests can only run without that tag. The CI workflow therefore runs them in a
+// separate "go test ./plugin" step.
+
+package plugin
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
+)
+
+func registerPid() {
+	register.Clean()
+	register.DataHash(`pid`, func(ctx hiera.ProviderContext) dgo.Value {
+		return vf.Integer(int64(os.Getpid()))
+	})
+}
+
+// TestMain makes the test binary act as a worker when it is started by the supervisor in TestSupervisor
+func TestMain(m *testing.M) {
+	if fd := getEnvInt(listenerFDEnv, 0); fd > 0 {
+		registerPid()
+		os.Exit(serveWorker(fd, os.Stderr))
+	}
+	os.Exit(m.Run())
+}
+
+// noKeepAlive makes each request use a new connection so that requests reach the new worker after a reload
+var noKeepAlive = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+func getPid(t *testing.T, address string) int {
+	t.Helper()
+	resp, err := noKeepAlive.Get(`http://` + address + `/data_hash/pid`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf(`unexpected response %d %q: %v`, resp.StatusCode, bs, err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(bs)))
+	require.Nil(t, err)
+	return pid
+}
+
+func TestSupervisor(t *testing.T) {
+	registerPid()
+	listener, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	require.Nil(t, err)
+	defer func() { _ = listener.Close() }()
+	lf, err := listenerFile(listener)
+	require.Nil(t, err)
+	defer func() { _ = lf.Close() }()
+	exe, err := os.Executable()
+	require.Nil(t, err)
+
+	reload := make(chan string)
+	quit := make(chan os.Signal)
+	result := make(chan int)
+	go func() { result <- runSupervisor(exe, lf, os.Stderr, reload, quit) }()
+	// Stop the workers also when the test fails
+	defer func() {
+		quit <- os.Interrupt
+		require.Equal(t, 0, <-result)
+	}()
+
+	// Connections are queued by the listening socket until the worker accepts them
+	address := listener.Addr().String()
+	first := getPid(t, address)
+	require.NotEqual(t, os.Getpid(), first)
+
+	// The new worker serves all requests once the old one is gone
+	reload <- `test`
+	var second int
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+		if second = getPid(t, address); second != first {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NotEqual(t, first, second)
+	require.NotEqual(t, os.Getpid(), second)
+}
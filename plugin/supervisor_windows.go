@@ -0,0 +1,23 @@
+//+build !test
+
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/lyraproj/dgo/dgo"
+)
+
+// supervise fails since a listening socket cannot be handed over to a worker process on Windows
+func supervise(_ net.Listener, _ dgo.Map, _, ew io.Writer) int {
+	_, _ = fmt.Fprintln(ew, `Hot reload is not supported on Windows`)
+	return 1
+}
+
+// serveWorker fails since a listening socket cannot be handed over to a worker process on Windows
+func serveWorker(_ int, ew io.Writer) int {
+	_, _ = fmt.Fprintln(ew, `Hot reload is not supported on Windows`)
+	return 1
+}
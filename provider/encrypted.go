@@ -0,0 +1,25 @@
+package provider
+
+import (
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/hierasdk/decrypt"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
+)
+
+// EncryptedYAMLData is like YAMLData but decrypts all ENC[<scheme>,...] blocks found in the values of the files.
+// The built in schemes are PKCS7 (eyaml), SECRETBOX, and X25519. See the decrypt package for the options that
+// appoint the key files of each scheme.
+func EncryptedYAMLData(ctx hiera.ProviderContext) dgo.Value {
+	return decrypt.Value(ctx, YAMLData(ctx))
+}
+
+// RegisterEncryptedYAMLData registers the EncryptedYAMLData function under the given name with the global registry
+func RegisterEncryptedYAMLData(name string) {
+	register.DataHash(name, EncryptedYAMLData, append(
+		fileMeta(`reads a data hash with encrypted values from one or more YAML files`),
+		register.WithOption(`secretbox_key`, `string`, `path to the file containing the secretbox key`),
+		register.WithOption(`x25519_private_key`, `string`, `path to the file containing the X25519 private key`),
+		register.WithOption(`pkcs7_private_key`, `string`, `path to the eyaml PKCS7 private key`),
+		register.WithOption(`pkcs7_public_key`, `string`, `path to the eyaml PKCS7 public key`))...)
+}
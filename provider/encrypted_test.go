@@ -0,0 +1,76 @@
+package provider_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/hierasdk/decrypt"
+	"github.com/lyraproj/hierasdk/hieratest"
+	"github.com/lyraproj/hierasdk/provider"
+	"github.com/lyraproj/hierasdk/register"
+)
+
+func TestEncryptedYAMLData(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `provider`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	sbKey, err := decrypt.GenerateSecretboxKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := decrypt.GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbPath := filepath.Join(dir, `secretbox.key`)
+	xPath := filepath.Join(dir, `x25519.key`)
+	if err = ioutil.WriteFile(sbPath, []byte(decrypt.EncodeKey(sbKey)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(xPath, []byte(decrypt.EncodeKey(priv)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e1, err := decrypt.EncryptSecretbox(sbKey, []byte(`secret one`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e2, err := decrypt.EncryptX25519(pub, []byte(`secret two`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataPath := filepath.Join(dir, `secrets.yaml`)
+	if err = ioutil.WriteFile(dataPath, []byte("one: "+e1+"\ntwo: "+e2+"\nplain: text\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := hieratest.New(t)
+	h.Registry().DataHash(`secrets`, provider.EncryptedYAMLData)
+	opts := map[string]interface{}{`path`: dataPath, `secretbox_key`: sbPath, `x25519_private_key`: xPath}
+	h.CallDataHash(`secrets`, opts).AssertFound(
+		map[string]interface{}{`one`: `secret one`, `two`: `secret two`, `plain`: `text`})
+	h.CallDataHash(`secrets`, map[string]interface{}{`path`: dataPath, `secretbox_key`: sbPath}).
+		AssertError(`option 'x25519_private_key': required option is missing`)
+	h.CallDataHash(`secrets`, map[string]interface{}{`path`: dataPath, `secretbox_key`: xPath}).
+		AssertError(`unable to decrypt ENC[SECRETBOX] block: message authentication failed`)
+	h.CallDataHash(`secrets`, map[string]interface{}{`path`: dataPath, `secretbox_key`: dataPath}).
+		AssertError(`expected a base64 encoded 32 byte key`)
+	h.CallDataHash(`secrets`, map[string]interface{}{`path`: filepath.Join(dir, `missing.yaml`)}).AssertNotFound()
+}
+
+func TestRegisterEncryptedYAMLData(t *testing.T) {
+	register.Clean()
+	provider.RegisterEncryptedYAMLData(`eyaml`)
+	md := register.Metadata().Get(`data_hash`).(dgo.Map).Get(`eyaml`).(dgo.Map)
+	require.Equal(t, `reads a data hash with encrypted values from one or more YAML files`, md.Get(`description`))
+	require.NotNil(t, md.Get(`options`).(dgo.Map).Get(`path`))
+	require.NotNil(t, md.Get(`options`).(dgo.Map).Get(`pkcs7_private_key`))
+}
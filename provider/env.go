@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
+)
+
+// EnvLookupKey is a lookup_key function that resolves keys from the environment of the plugin process. The
+// Hiera key is mangled into the name of an environment variable by replacing each "::" with the "separator"
+// option (default "_"), replacing all other characters that are not letters, digits, or underscores with
+// underscores, changing the case according to the "case" option ("upper" (default), "lower", or "preserve"), and
+// finally adding the "prefix" option. The key "app::db::host" will thus be found in the variable APP_DB_HOST.
+//
+// The value is returned as a string unless the "json" option is true, in which case values that are valid JSON
+// are decoded. The options "allow" and "deny" are lists of glob patterns matched against the Hiera key. A key
+// that matches a pattern in "deny" or, when "allow" is given, doesn't match any pattern in "allow", is not found.
+func EnvLookupKey(ctx hiera.ProviderContext, key string) dgo.Value {
+	if !envKeyAllowed(ctx, key) {
+		return nil
+	}
+	v, ok := os.LookupEnv(envName(ctx, key))
+	if !ok {
+		return nil
+	}
+	decode, err := ctx.Options().Bool(`json`, false)
+	if err != nil {
+		panic(err)
+	}
+	if decode {
+		return jsonOrString(v)
+	}
+	return vf.String(v)
+}
+
+// RegisterEnvLookupKey registers the EnvLookupKey function under the given name with the global registry
+func RegisterEnvLookupKey(name string) {
+	register.LookupKey(name, EnvLookupKey,
+		register.WithDescription(`looks up keys in the environment of the plugin process`),
+		register.WithOption(`prefix`, `string`, `prefix added to the environment variable name`),
+		register.WithOption(`separator`, `string`, `replacement for "::" in the key. Default is "_"`),
+		register.WithOption(`case`, `"upper"|"lower"|"preserve"`,
+			`case of the environment variable name. Default is "upper"`),
+		register.WithOption(`json`, `bool`, `decode values that are valid JSON`),
+		register.WithOption(`allow`, `[]string`, `glob patterns for keys that may be looked up`),
+		register.WithOption(`deny`, `[]string`, `glob patterns for keys that must not be looked up`),
+		register.WithExample(
+			"- name: environment\n  lookup_key: env\n  options:\n    prefix: MYAPP_\n    allow: ['db::*']\n"))
+}
+
+func envName(ctx hiera.ProviderContext, key string) string {
+	r := ctx.Options()
+	sep, err := r.String(`separator`, `_`)
+	if err != nil {
+		panic(err)
+	}
+	segments := strings.Split(key, `::`)
+	for i, s := range segments {
+		segments[i] = strings.Map(envNameRune, s)
+	}
+	name := strings.Join(segments, sep)
+
+	cs, err := r.String(`case`, `upper`)
+	if err != nil {
+		panic(err)
+	}
+	switch cs {
+	case `upper`:
+		name = strings.ToUpper(name)
+	case `lower`:
+		name = strings.ToLower(name)
+	case `preserve`:
+	default:
+		panic(hiera.NewOptionError(`case`, `must be one of "upper", "lower", or "preserve", got %q`, cs))
+	}
+	prefix, err := r.String(`prefix`, ``)
+	if err != nil {
+		panic(err)
+	}
+	return prefix + name
+}
+
+// envNameRune replaces characters that are not letters, digits, or underscores with underscores
+func envNameRune(r rune) rune {
+	if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+		return r
+	}
+	return '_'
+}
+
+func envKeyAllowed(ctx hiera.ProviderContext, key string) bool {
+	r := ctx.Options()
+	if matchAny(r, `deny`, key) {
+		return false
+	}
+	return r.Require(`allow`) != nil || matchAny(r, `allow`, key)
+}
+
+// matchAny returns true if the given key matches any of the glob patterns in the given option
+func matchAny(r hiera.OptionReader, option, key string) bool {
+	ps, err := r.Strings(option, nil)
+	if err != nil {
+		panic(err)
+	}
+	for _, p := range ps {
+		m, err := path.Match(p, key)
+		if err != nil {
+			panic(hiera.NewOptionError(option, `invalid pattern %q: %s`, p, err.Error()))
+		}
+		if m {
+			return true
+		}
+	}
+	return false
+}
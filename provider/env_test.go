@@ -0,0 +1,85 @@
+package provider_test
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/hierasdk/hieratest"
+	"github.com/lyraproj/hierasdk/provider"
+	"github.com/lyraproj/hierasdk/register"
+)
+
+func TestEnvLookupKey(t *testing.T) {
+	_ = os.Setenv(`APP_DB_HOST`, `db.example.com`)
+	_ = os.Setenv(`APP_DB_PORT`, `5432`)
+	_ = os.Setenv(`MYCO_app__db__host`, `prefixed.example.com`)
+	_ = os.Setenv(`APP_DB_OPTIONS`, `{"ssl":true`)
+	defer func() {
+		_ = os.Unsetenv(`APP_DB_HOST`)
+		_ = os.Unsetenv(`APP_DB_PORT`)
+		_ = os.Unsetenv(`MYCO_app__db__host`)
+		_ = os.Unsetenv(`APP_DB_OPTIONS`)
+	}()
+
+	h := hieratest.New(t)
+	h.Registry().LookupKey(`env`, provider.EnvLookupKey)
+	h.CallLookupKey(`env`, `app::db::host`, nil).AssertFound(`db.example.com`)
+	h.CallLookupKey(`env`, `app::db::port`, nil).AssertFound(`5432`)
+	h.CallLookupKey(`env`, `app::db::port`, map[string]interface{}{`json`: true}).AssertFound(5432)
+	h.CallLookupKey(`env`, `app::db::options`, map[string]interface{}{`json`: true}).AssertFound(`{"ssl":true`)
+	h.CallLookupKey(`env`, `app::db::user`, nil).AssertNotFound()
+	h.CallLookupKey(`env`, `app::db-host`, nil).AssertFound(`db.example.com`)
+	h.CallLookupKey(`env`, `app::db::host`, map[string]interface{}{
+		`prefix`: `MYCO_`, `separator`: `__`, `case`: `preserve`}).AssertFound(`prefixed.example.com`)
+	h.CallLookupKey(`env`, `APP::DB::HOST`, map[string]interface{}{`case`: `lower`}).AssertNotFound()
+	r := h.CallLookupKey(`env`, `app::db::host`, map[string]interface{}{`case`: `title`})
+	r.AssertError(`option 'case': must be one of "upper", "lower", or "preserve", got "title"`)
+	require.Equal(t, http.StatusBadRequest, r.Status)
+	h.CallLookupKey(`env`, `app::db::host`, map[string]interface{}{`json`: `yes`}).AssertError(
+		`option 'json': expected bool, got string`)
+	for _, option := range []string{`separator`, `case`, `prefix`} {
+		h.CallLookupKey(`env`, `app::db::host`, map[string]interface{}{option: 1}).AssertError(
+			`option '` + option + `': expected string, got int`)
+	}
+}
+
+func TestEnvLookupKey_allowDeny(t *testing.T) {
+	_ = os.Setenv(`APP_DB_HOST`, `db.example.com`)
+	_ = os.Setenv(`APP_DB_PASSWORD`, `secret`)
+	defer func() {
+		_ = os.Unsetenv(`APP_DB_HOST`)
+		_ = os.Unsetenv(`APP_DB_PASSWORD`)
+	}()
+
+	h := hieratest.New(t)
+	h.Registry().LookupKey(`env`, provider.EnvLookupKey)
+	opts := map[string]interface{}{`allow`: []string{`app::db::*`}, `deny`: []string{`*::password`}}
+	h.CallLookupKey(`env`, `app::db::host`, opts).AssertFound(`db.example.com`)
+	h.CallLookupKey(`env`, `app::db::password`, opts).AssertNotFound()
+	h.CallLookupKey(`env`, `app::db::host`, map[string]interface{}{`allow`: []string{`web::*`}}).AssertNotFound()
+	h.CallLookupKey(`env`, `app::db::host`, map[string]interface{}{`allow`: nil}).AssertFound(`db.example.com`)
+	r := h.CallLookupKey(`env`, `app::db::host`, map[string]interface{}{`allow`: `app::*`})
+	r.AssertError(`option 'allow': expected []string, got string`)
+	require.Equal(t, http.StatusBadRequest, r.Status)
+	h.CallLookupKey(`env`, `app::db::host`, map[string]interface{}{`deny`: []string{`[`}}).AssertError(
+		`option 'deny': invalid pattern "["`)
+}
+
+func TestRegisterEnvLookupKey(t *testing.T) {
+	_ = os.Setenv(`MYAPP_DB_HOST`, `db.example.com`)
+	defer func() { _ = os.Unsetenv(`MYAPP_DB_HOST`) }()
+
+	register.Clean()
+	provider.RegisterEnvLookupKey(`env`)
+	md := register.Metadata().Get(`lookup_key`).(dgo.Map).Get(`env`).(dgo.Map)
+	require.Equal(t, `looks up keys in the environment of the plugin process`, md.Get(`description`))
+	require.True(t, md.Get(`options`).(dgo.Map).Get(`allow`) != nil)
+
+	v := callGlobal(t, `/lookup_key/env`, url.Values{`key`: {`db::host`}, `options`: {`{"prefix":"MYAPP_"}`}})
+	require.Equal(t, `db.example.com`, v)
+}
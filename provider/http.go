@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
+)
+
+const defaultHTTPTimeout = 10 * time.Second
+
+// HTTPData is a data_hash function that fetches JSON from the URL given by the "url" option. See HTTPLookupKey for
+// a description of the other options.
+func HTTPData(ctx hiera.ProviderContext) dgo.Value {
+	v := fetchJSON(ctx, ``)
+	if v == nil {
+		return nil
+	}
+	if _, ok := v.(dgo.Map); !ok {
+		panic(fmt.Errorf(`expected %s to produce a map, got %s`, requestURL(ctx, ``), v.Type()))
+	}
+	return v
+}
+
+// HTTPLookupKey is a lookup_key function that fetches JSON from the URL given by the "url" option. Each occurrence
+// of "{key}" in the URL is replaced by the key, path escaped before the "?" and query escaped after it. The options
+// are:
+//
+//	url       the URL template
+//	headers   a map of HTTP headers to add to the request
+//	timeout   the request timeout as a Go duration string (e.g. "500ms") or a number of seconds. Default is 10s
+//	pointer   a JSON pointer (RFC 6901) that selects the value to return from the fetched JSON
+//
+// A 404 response, or a pointer that doesn't match anything, means that the value is not found. Any other response
+// with a status outside of the 2xx range is an error.
+func HTTPLookupKey(ctx hiera.ProviderContext, key string) dgo.Value {
+	return fetchJSON(ctx, key)
+}
+
+// RegisterHTTPData registers the HTTPData function under the given name with the global registry
+func RegisterHTTPData(name string) {
+	register.DataHash(name, HTTPData, httpMeta(`fetches a data hash from a JSON HTTP API`)...)
+}
+
+// RegisterHTTPLookupKey registers the HTTPLookupKey function under the given name with the global registry
+func RegisterHTTPLookupKey(name string) {
+	register.LookupKey(name, HTTPLookupKey, httpMeta(`fetches the value of a key from a JSON HTTP API`)...)
+}
+
+func httpMeta(description string) []register.MetaOption {
+	return []register.MetaOption{
+		register.WithDescription(description),
+		register.WithRequiredOption(`url`, `string`, `the URL. Each occurrence of "{key}" is replaced by the key`),
+		register.WithSensitiveOption(`headers`, `map[string]string`, `HTTP headers to add to the request`),
+		register.WithOption(`timeout`, `string|float`, `request timeout as a duration string or seconds`),
+		register.WithOption(`pointer`, `string`, `JSON pointer that selects the value to return`),
+	}
+}
+
+func requestURL(ctx hiera.ProviderContext, key string) string {
+	r := ctx.Options()
+	if err := r.Require(`url`); err != nil {
+		panic(err)
+	}
+	u, err := r.String(`url`, ``)
+	if err != nil {
+		panic(err)
+	}
+	// The key is path escaped in the path and query escaped in the query
+	i := strings.IndexByte(u, '?')
+	if i < 0 {
+		i = len(u)
+	}
+	return strings.Replace(u[:i], `{key}`, url.PathEscape(key), -1) +
+		strings.Replace(u[i:], `{key}`, url.QueryEscape(key), -1)
+}
+
+func fetchJSON(ctx hiera.ProviderContext, key string) dgo.Value {
+	r := ctx.Options()
+	u := requestURL(ctx, key)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		panic(hiera.NewOptionError(`url`, `%s`, err.Error()))
+	}
+	req.Header.Set(`Accept`, `application/json`)
+	hs, err := r.Map(`headers`, nil)
+	if err != nil {
+		panic(err)
+	}
+	if hs != nil {
+		hs.EachEntry(func(e dgo.MapEntry) { req.Header.Set(e.Key().String(), e.Value().String()) })
+	}
+	timeout, err := r.Coerce().Duration(`timeout`, defaultHTTPTimeout)
+	if err != nil {
+		panic(err)
+	}
+	pointer, err := r.String(`pointer`, ``)
+	if err != nil {
+		panic(err)
+	}
+
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		panic(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		panic(fmt.Errorf(`GET %s: %s: %s`, u, resp.Status, strings.TrimSpace(string(body))))
+	}
+	return jsonPointer(parseJSONValue(`GET `+u, body), pointer)
+}
+
+// jsonPointer returns the value that the given RFC 6901 JSON pointer selects in the given value, or nil if the
+// pointer doesn't select anything.
+func jsonPointer(v dgo.Value, pointer string) dgo.Value {
+	if pointer == `` {
+		return v
+	}
+	if !strings.HasPrefix(pointer, `/`) {
+		panic(hiera.NewOptionError(`pointer`, `%q is not a valid JSON pointer`, pointer))
+	}
+	for _, token := range strings.Split(pointer[1:], `/`) {
+		token = strings.Replace(strings.Replace(token, `~1`, `/`, -1), `~0`, `~`, -1)
+		switch c := v.(type) {
+		case dgo.Map:
+			v = c.Get(token)
+		case dgo.Array:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= c.Len() {
+				return nil
+			}
+			v = c.Get(i)
+		default:
+			return nil
+		}
+		if v == nil {
+			return nil
+		}
+	}
+	return v
+}
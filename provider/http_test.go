@@ -0,0 +1,148 @@
+package provider_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/hierasdk/hieratest"
+	"github.com/lyraproj/hierasdk/provider"
+	"github.com/lyraproj/hierasdk/register"
+)
+
+func newAPIServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(`/config`, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(`Authorization`) != `Bearer xyz` {
+			http.Error(w, `unauthorized`, http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"host":"example.com","ports":[80,443],"a/b":{"~c":1}}}`))
+	})
+	mux.HandleFunc(`/lookup`, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"value":"` + r.URL.Query().Get(`key`) + `"}`))
+	})
+	mux.HandleFunc(`/keys/`, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case `/keys/app::host`:
+			_, _ = w.Write([]byte(`{"value":"example.com"}`))
+		case `/keys/app name`:
+			_, _ = w.Write([]byte(`{"value":"` + r.URL.EscapedPath() + `"}`))
+		case `/keys/app::list`:
+			_, _ = w.Write([]byte(`[1, 2`))
+		case `/keys/truncated`:
+			w.Header().Set(`Content-Length`, `10`)
+			_, _ = w.Write([]byte(`{}`))
+		case `/keys/slow`:
+			time.Sleep(200 * time.Millisecond)
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestHTTPData(t *testing.T) {
+	s := newAPIServer()
+	defer s.Close()
+
+	h := hieratest.New(t)
+	h.Registry().DataHash(`http`, provider.HTTPData)
+	opts := map[string]interface{}{`url`: s.URL + `/config`, `headers`: map[string]string{`Authorization`: `Bearer xyz`}}
+	h.CallDataHash(`http`, opts).AssertFound(map[string]interface{}{`data`: map[string]interface{}{
+		`host`: `example.com`, `ports`: []int{80, 443}, `a/b`: map[string]interface{}{`~c`: 1}}})
+
+	opts[`pointer`] = `/data`
+	h.CallDataHash(`http`, opts).AssertFound(map[string]interface{}{
+		`host`: `example.com`, `ports`: []int{80, 443}, `a/b`: map[string]interface{}{`~c`: 1}})
+	opts[`pointer`] = `/data/ports`
+	h.CallDataHash(`http`, opts).AssertError(`to produce a map`)
+	opts[`pointer`] = `/data/missing`
+	h.CallDataHash(`http`, opts).AssertNotFound()
+
+	h.CallDataHash(`http`, map[string]interface{}{`url`: s.URL + `/config`}).AssertError(`401 Unauthorized: unauthorized`)
+	h.CallDataHash(`http`, map[string]interface{}{`url`: s.URL + `/missing`}).AssertNotFound()
+	h.CallDataHash(`http`, map[string]interface{}{`url`: s.URL + `/config`, `headers`: `x`}).AssertError(
+		`option 'headers': expected map, got string`)
+	r := h.CallDataHash(`http`, nil)
+	r.AssertError(`option 'url': required option is missing`)
+	require.Equal(t, http.StatusBadRequest, r.Status)
+	h.CallDataHash(`http`, map[string]interface{}{`url`: `://x`}).AssertError(
+		`option 'url': parse "://x": missing protocol scheme`)
+	h.CallDataHash(`http`, map[string]interface{}{`url`: 1}).AssertError(`option 'url': expected string, got int`)
+	h.CallDataHash(`http`, map[string]interface{}{`url`: s.URL + `/missing`, `pointer`: 1}).AssertError(
+		`option 'pointer': expected string, got int`)
+}
+
+func TestHTTPLookupKey(t *testing.T) {
+	s := newAPIServer()
+	defer s.Close()
+
+	h := hieratest.New(t)
+	h.Registry().LookupKey(`http`, provider.HTTPLookupKey)
+	opts := map[string]interface{}{`url`: s.URL + `/keys/{key}`, `pointer`: `/value`}
+	h.CallLookupKey(`http`, `app::host`, opts).AssertFound(`example.com`)
+	h.CallLookupKey(`http`, `app::port`, opts).AssertNotFound()
+	h.CallLookupKey(`http`, `app::list`, opts).AssertError(`/keys/app::list:1:6: unexpected EOF`)
+	h.CallLookupKey(`http`, `truncated`, opts).AssertError(`unexpected EOF`)
+	h.CallLookupKey(`http`, `app name`, opts).AssertFound(`/keys/app%20name`)
+	h.CallLookupKey(`http`, `app name`, map[string]interface{}{`url`: s.URL + `/lookup?key={key}`, `pointer`: `/value`}).
+		AssertFound(`app name`)
+	h.CallLookupKey(`http`, `app::host`, map[string]interface{}{`url`: s.URL + `/keys/{key}`, `pointer`: `value`}).
+		AssertError(`"value" is not a valid JSON pointer`)
+	h.CallLookupKey(`http`, `app::host`, map[string]interface{}{`url`: s.URL + `/keys/{key}`, `pointer`: `/value/0`}).
+		AssertNotFound()
+
+	opts = map[string]interface{}{`url`: s.URL + `/config`, `headers`: map[string]string{`Authorization`: `Bearer xyz`}}
+	for pointer, expected := range map[string]interface{}{`/data/ports/1`: 443, `/data/a~1b/~0c`: 1, ``: nil} {
+		opts[`pointer`] = pointer
+		if expected == nil {
+			h.CallLookupKey(`http`, `x`, opts).AssertFound(map[string]interface{}{`data`: map[string]interface{}{
+				`host`: `example.com`, `ports`: []int{80, 443}, `a/b`: map[string]interface{}{`~c`: 1}}})
+		} else {
+			h.CallLookupKey(`http`, `x`, opts).AssertFound(expected)
+		}
+	}
+	opts[`pointer`] = `/data/ports/2`
+	h.CallLookupKey(`http`, `x`, opts).AssertNotFound()
+
+	opts = map[string]interface{}{`url`: s.URL + `/keys/{key}`}
+	for _, timeout := range []interface{}{`50ms`, 0.05} {
+		opts[`timeout`] = timeout
+		h.CallLookupKey(`http`, `slow`, opts).AssertError(`Client.Timeout exceeded`)
+	}
+	opts[`timeout`] = 1
+	h.CallLookupKey(`http`, `slow`, opts).AssertFound(map[string]interface{}{})
+	opts[`timeout`] = `1x`
+	h.CallLookupKey(`http`, `slow`, opts).AssertError(`option 'timeout': invalid duration "1x"`)
+	opts[`timeout`] = true
+	h.CallLookupKey(`http`, `slow`, opts).AssertError(`option 'timeout': expected duration string`)
+}
+
+func TestRegisterHTTPData(t *testing.T) {
+	s := newAPIServer()
+	defer s.Close()
+
+	register.Clean()
+	provider.RegisterHTTPData(`http`)
+	provider.RegisterHTTPLookupKey(`http`)
+	md := register.Metadata()
+	dh := md.Get(`data_hash`).(dgo.Map).Get(`http`).(dgo.Map)
+	require.Equal(t, `fetches a data hash from a JSON HTTP API`, dh.Get(`description`))
+	lk := md.Get(`lookup_key`).(dgo.Map).Get(`http`).(dgo.Map)
+	require.Equal(t, `fetches the value of a key from a JSON HTTP API`, lk.Get(`description`))
+	require.Equal(t, []string{`headers`}, register.Global().FunctionMeta(`lookup_key`, `http`).SensitiveOptions())
+
+	v := callGlobal(t, `/data_hash/http`, url.Values{`options`: {
+		`{"url":"` + s.URL + `/config","headers":{"Authorization":"Bearer xyz"},"pointer":"/data"}`}})
+	require.Equal(t, `example.com`, v.(dgo.Map).Get(`host`))
+	v = callGlobal(t, `/lookup_key/http`, url.Values{`key`: {`app::host`}, `options`: {
+		`{"url":"` + s.URL + `/keys/{key}","pointer":"/value"}`}})
+	require.Equal(t, `example.com`, v)
+}
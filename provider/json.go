@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
+)
+
+// JSONData is a data_hash function that reads the JSON files given by the "path" and/or "paths" options and
+// returns their contents. Missing files are handled the same way as in YAMLData.
+func JSONData(ctx hiera.ProviderContext) dgo.Value {
+	return readDataFiles(ctx, parseJSON)
+}
+
+// JSON5Data is like JSONData but the files may also contain line comments, block comments, and trailing commas
+// in arrays and objects.
+func JSON5Data(ctx hiera.ProviderContext) dgo.Value {
+	return readDataFiles(ctx, func(path string, content []byte) dgo.Map {
+		return parseJSON(path, stripJSON5(content))
+	})
+}
+
+// RegisterJSONData registers the JSONData function under the given name with the global registry
+func RegisterJSONData(name string) {
+	register.DataHash(name, JSONData, fileMeta(`reads a data hash from one or more JSON files`)...)
+}
+
+// RegisterJSON5Data registers the JSON5Data function under the given name with the global registry
+func RegisterJSON5Data(name string) {
+	register.DataHash(name, JSON5Data, fileMeta(`reads a data hash from one or more JSON5 files`)...)
+}
+
+func parseJSON(path string, content []byte) dgo.Map {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return vf.MutableMap(nil)
+	}
+	return toMap(path, parseJSONValue(path, content))
+}
+
+// parseJSONValue parses the given content. A parse error will result in a panic with an error that contains the
+// given path and the line and column where the error was detected.
+func parseJSONValue(path string, content []byte) dgo.Value {
+	v, err := vf.UnmarshalJSON(content)
+	if err != nil {
+		// The decoder fails with a *json.SyntaxError, or with io.EOF or io.ErrUnexpectedEOF when the content ends
+		// prematurely
+		offset := len(content)
+		if se, ok := err.(*json.SyntaxError); ok {
+			// Offset is the number of bytes read when the error occurred
+			offset = int(se.Offset) - 1
+		} else {
+			err = io.ErrUnexpectedEOF
+		}
+		line, col := position(content, offset)
+		panic(fmt.Errorf(`%s:%d:%d: %s`, path, line, col, err.Error()))
+	}
+	return v
+}
+
+// position returns the one based line and column of the byte at the given offset in content
+func position(content []byte, offset int) (line, col int) {
+	line = 1 + bytes.Count(content[:offset], []byte{'\n'})
+	col = offset - bytes.LastIndexByte(content[:offset], '\n')
+	return
+}
+
+// stripJSON5 replaces comments and trailing commas in the given content with spaces. Newlines are retained so
+// that positions in the stripped content are the same as in the original content.
+func stripJSON5(content []byte) []byte {
+	s := &json5Stripper{out: append([]byte(nil), content...), comma: -1}
+	for i := 0; i < len(s.out); i++ {
+		i = s.strip(i)
+	}
+	return s.out
+}
+
+// json5Stripper holds the content that stripJSON5 modifies and the position of the last comma that may be trailing
+type json5Stripper struct {
+	out   []byte
+	comma int
+}
+
+// strip handles the byte at the given index and returns the index of the last byte that was handled
+func (s *json5Stripper) strip(i int) int {
+	switch c := s.out[i]; {
+	case c == '"':
+		s.comma = -1
+		return s.skipString(i)
+	case s.commentAt(i):
+		return s.blankComment(i)
+	case c == ',':
+		s.comma = i
+	case c == ']' || c == '}':
+		if s.comma >= 0 {
+			s.out[s.comma] = ' '
+		}
+		s.comma = -1
+	case !isJSONSpace(c):
+		s.comma = -1
+	}
+	return i
+}
+
+// skipString returns the index of the quote that ends the string that starts at the given index
+func (s *json5Stripper) skipString(i int) int {
+	for i++; i < len(s.out) && s.out[i] != '"'; i++ {
+		if s.out[i] == '\\' {
+			i++
+		}
+	}
+	return i
+}
+
+// commentAt returns true if a line comment or a block comment starts at the given index
+func (s *json5Stripper) commentAt(i int) bool {
+	return s.out[i] == '/' && i+1 < len(s.out) && (s.out[i+1] == '/' || s.out[i+1] == '*')
+}
+
+// blankComment replaces the comment that starts at the given index with spaces and returns the index of its last
+// byte. An unterminated block comment extends to the end of the content.
+func (s *json5Stripper) blankComment(i int) int {
+	end := len(s.out)
+	if s.out[i+1] == '/' {
+		if e := bytes.IndexByte(s.out[i:], '\n'); e >= 0 {
+			end = i + e
+		}
+	} else if e := bytes.Index(s.out[i+2:], []byte(`*/`)); e >= 0 {
+		end = i + e + 4
+	}
+	for j := i; j < end; j++ {
+		if s.out[j] != '\n' {
+			s.out[j] = ' '
+		}
+	}
+	return end - 1
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,85 @@
+package provider_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hieratest"
+	"github.com/lyraproj/hierasdk/provider"
+	"github.com/lyraproj/hierasdk/register"
+	"github.com/lyraproj/hierasdk/routes"
+)
+
+func TestJSONData(t *testing.T) {
+	h := hieratest.New(t)
+	h.Registry().DataHash(`json`, provider.JSONData)
+	h.CallDataHash(`json`, map[string]interface{}{`path`: `testdata/common.json`}).AssertFound(map[string]interface{}{
+		`host`:    `example.com`,
+		`port`:    8080,
+		`ratio`:   0.5,
+		`enabled`: true,
+		`list`:    []interface{}{`a`, 2}})
+	h.CallDataHash(`json`, map[string]interface{}{`paths`: []string{`testdata/missing.json`}}).AssertNotFound()
+	h.CallDataHash(`json`, map[string]interface{}{`path`: `testdata/empty.yaml`}).AssertFound(map[string]interface{}{})
+	h.CallDataHash(`json`, map[string]interface{}{`path`: `testdata/bad.json`}).AssertError(
+		`testdata/bad.json:3:13: invalid character ','`)
+	h.CallDataHash(`json`, map[string]interface{}{`path`: `testdata/truncated.json`}).AssertError(
+		`testdata/truncated.json:3:1: unexpected EOF`)
+	h.CallDataHash(`json`, map[string]interface{}{`path`: `testdata/common.json5`}).AssertError(
+		`testdata/common.json5:1:1: invalid character '/' looking for beginning of value`)
+}
+
+func TestJSON5Data(t *testing.T) {
+	h := hieratest.New(t)
+	h.Registry().DataHash(`json5`, provider.JSON5Data)
+	h.CallDataHash(`json5`, map[string]interface{}{`path`: `testdata/common.json5`}).AssertFound(map[string]interface{}{
+		`host`:    `example.com`,
+		`port`:    8080,
+		`ratio`:   0.5,
+		`enabled`: true,
+		`list`:    []interface{}{`a`, 2},
+		`url`:     `http://example.com/*x*/`,
+		`quote`:   `say "hi", // not a comment`})
+	h.CallDataHash(`json5`, map[string]interface{}{`path`: `testdata/bad.json`}).AssertFound(map[string]interface{}{
+		`host`: `example.com`,
+		`port`: 80})
+	h.CallDataHash(`json5`, map[string]interface{}{`path`: `testdata/bad.json5`}).AssertError(
+		`testdata/bad.json5:4:1: unexpected EOF`)
+}
+
+func TestRegisterJSONData(t *testing.T) {
+	register.Clean()
+	provider.RegisterJSONData(`json`)
+	provider.RegisterJSON5Data(`json5`)
+	md := register.Metadata().Get(`data_hash`).(dgo.Map)
+	require.Equal(t, `reads a data hash from one or more JSON files`, md.Get(`json`).(dgo.Map).Get(`description`))
+	require.Equal(t, `reads a data hash from one or more JSON5 files`, md.Get(`json5`).(dgo.Map).Get(`description`))
+
+	v := callGlobal(t, `/data_hash/json`, url.Values{`options`: {`{"path":"testdata/common.json"}`}})
+	require.Equal(t, `example.com`, v.(dgo.Map).Get(`host`))
+	v = callGlobal(t, `/data_hash/json5`, url.Values{`options`: {`{"path":"testdata/common.json5"}`}})
+	require.Equal(t, `http://example.com/*x*/`, v.(dgo.Map).Get(`url`))
+}
+
+// callGlobal calls the function at the given path using the handler for the functions of the global registry and
+// returns the value of the response
+func callGlobal(t *testing.T, path string, q url.Values) dgo.Value {
+	t.Helper()
+	handler, _ := routes.Register()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path+`?`+q.Encode(), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf(`expected a value, got status %d: %s`, rr.Code, rr.Body.String())
+	}
+	v, err := vf.UnmarshalJSON(rr.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
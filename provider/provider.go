@@ -0,0 +1,155 @@
+// Package provider contains ready made lookup functions that can be registered by a plugin.
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/merge"
+	"github.com/lyraproj/hierasdk/register"
+)
+
+// paths returns the paths given by the "path" and "paths" options. The "path" option, when given, is first. Like in
+// Hiera, relative paths are resolved relative to the datadir of the hierarchy level when the host sent it, or else
+// relative to the directory of the host's hiera.yaml file when the host sent its location.
+func paths(ctx hiera.ProviderContext) []string {
+	r := ctx.Options()
+	var ps []string
+	p, err := r.String(`path`, ``)
+	if err != nil {
+		panic(err)
+	}
+	if p != `` {
+		ps = append(ps, p)
+	}
+	more, err := r.Strings(`paths`, nil)
+	if err != nil {
+		panic(err)
+	}
+	ps = append(ps, more...)
+	if len(ps) == 0 {
+		panic(hiera.NewOptionError(`path`, `one of the options "path" or "paths" must be given`))
+	}
+	dd := ctx.DataDir()
+	for i, p := range ps {
+		if dd != `` && !filepath.IsAbs(p) {
+			ps[i] = filepath.Join(dd, p)
+		} else {
+			ps[i] = r.ResolvePath(p)
+		}
+	}
+	return ps
+}
+
+// readDataFiles reads each file found in the "path" and "paths" options and uses the given parse function
+// to produce a Map from its contents. Missing files are silently ignored. The resulting maps are combined using the
+// merge strategy given by the "merge" option, see mergeStrategy. The files found early have the highest priority.
+// The returned value is nil if no file was found.
+//
+// The version of the returned value is derived from the size and modification time of the files and from the merge
+// strategy. The files are not read when the host already has that version.
+func readDataFiles(ctx hiera.ProviderContext, parse func(path string, content []byte) dgo.Map) dgo.Value {
+	ps := paths(ctx)
+	s := mergeStrategy(ctx)
+	for _, path := range ps {
+		ctx.WatchFile(path)
+	}
+	if version := filesVersion(ps, s); version == `` || ctx.SetVersion(version) {
+		return nil
+	}
+	var maps []dgo.Value
+	for _, path := range ps {
+		/* #nosec */
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			panic(err)
+		}
+		maps = append(maps, parse(path, content))
+	}
+	// The strategy is never "unique" and all values are maps, so the merge cannot fail
+	result, _ := merge.Values(s, maps...)
+	return result
+}
+
+// mergeStrategy returns the merge strategy given by the "merge" option, which is either the name of a strategy or
+// a map with a "strategy" entry and the options of the strategy, see merge.FromValue. The default is the hash
+// strategy, i.e. a key in a file of higher priority replaces the same key in a file of lower priority.
+func mergeStrategy(ctx hiera.ProviderContext) merge.Strategy {
+	mv := ctx.Option(`merge`)
+	if mv == nil {
+		return merge.Hash()
+	}
+	s, err := merge.FromValue(mv)
+	if err != nil {
+		panic(hiera.NewOptionError(`merge`, `%s`, err.Error()))
+	}
+	if s.Name() == `unique` {
+		panic(hiera.NewOptionError(`merge`, `merge strategy "unique" cannot merge data hashes`))
+	}
+	return s
+}
+
+// filesVersion returns a version that changes when any of the given files is created, removed, or modified, or when
+// the merge strategy that combines them changes. An empty string is returned if none of the files exist.
+func filesVersion(paths []string, s merge.Strategy) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\x00%+v\x00", s.Name(), s)
+	found := false
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			panic(err)
+		}
+		found = true
+		_, _ = fmt.Fprintf(h, "%s\x00%d\x00%d\x00", path, fi.Size(), fi.ModTime().UnixNano())
+	}
+	if !found {
+		return ``
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// toMap asserts that the given value is a map and returns it as a mutable Map. An empty Map is returned if
+// the value is nil.
+func toMap(path string, v dgo.Value) dgo.Map {
+	// The parsers always produce a dgo value, so a nil is vf.Nil rather than a Go nil
+	if m, ok := v.(dgo.Map); ok {
+		return m.Copy(false)
+	}
+	if v == vf.Nil {
+		return vf.MutableMap(nil)
+	}
+	panic(fmt.Errorf(`%s: expected a map, got %s`, path, v.Type()))
+}
+
+// fileMeta returns the metadata for a data_hash function with the given description that reads files
+func fileMeta(description string) []register.MetaOption {
+	return []register.MetaOption{
+		register.WithDescription(description),
+		register.WithOption(`path`, `string`, `path to the file to read`),
+		register.WithOption(`paths`, `[]string`, `paths to the files to read. Keys in earlier files take precedence`),
+		register.WithOption(`merge`, `string|map[string]any`,
+			`merge strategy used to combine the files: "first", "hash" (the default), or "deep"`),
+	}
+}
+
+// jsonOrString returns the value represented by the given string if it is valid JSON, or the string itself
+func jsonOrString(s string) dgo.Value {
+	if v, err := vf.UnmarshalJSON([]byte(s)); err == nil {
+		return v
+	}
+	return vf.String(s)
+}
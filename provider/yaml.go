@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLData is a data_hash function that reads the YAML files given by the "path" and/or "paths" options and
+// returns their contents. Missing files are ignored and the function returns nil when no file is found. When
+// several files are found, a key in an earlier file takes precedence over the same key in a later file.
+func YAMLData(ctx hiera.ProviderContext) dgo.Value {
+	return readDataFiles(ctx, parseYAML)
+}
+
+// RegisterYAMLData registers the YAMLData function under the given name with the global registry
+func RegisterYAMLData(name string) {
+	register.DataHash(name, YAMLData, fileMeta(`reads a data hash from one or more YAML files`)...)
+}
+
+func parseYAML(path string, content []byte) dgo.Map {
+	var n yaml.Node
+	var v interface{}
+	err := yaml.Unmarshal(content, &n)
+	if err == nil {
+		retagScalars(&n)
+		err = n.Decode(&v)
+	}
+	if err != nil {
+		panic(fmt.Errorf(`%s: %s`, path, err.Error()))
+	}
+	return toMap(path, vf.Value(v))
+}
+
+// retagScalars makes timestamps and scalar map keys decode as the strings that they were written as, since data
+// must be JSON compatible. A date such as 2001-12-14 would otherwise become a time.Time and a key such as 1 an int.
+func retagScalars(n *yaml.Node) {
+	if n.Kind == yaml.ScalarNode && n.ShortTag() == `!!timestamp` {
+		n.Tag = `!!str`
+	}
+	for i, c := range n.Content {
+		if n.Kind == yaml.MappingNode && i%2 == 0 && c.Kind == yaml.ScalarNode && c.ShortTag() != `!!merge` {
+			c.Tag = `!!str`
+		}
+		retagScalars(c)
+	}
+}
@@ -0,0 +1,187 @@
+package provider_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/hieratest"
+	"github.com/lyraproj/hierasdk/provider"
+	"github.com/lyraproj/hierasdk/register"
+	"github.com/lyraproj/hierasdk/routes"
+)
+
+func TestYAMLData(t *testing.T) {
+	h := hieratest.New(t)
+	h.Registry().DataHash(`yaml`, provider.YAMLData)
+	h.CallDataHash(`yaml`, map[string]interface{}{`path`: `testdata/common.yaml`}).AssertFound(map[string]interface{}{
+		`host`:    `example.com`,
+		`port`:    8080,
+		`ratio`:   0.5,
+		`enabled`: true,
+		`nothing`: nil,
+		`list`:    []interface{}{`a`, 2},
+		`nested`:  map[string]interface{}{`x`: 1}})
+	h.CallDataHash(`yaml`, map[string]interface{}{`path`: `testdata/missing.yaml`}).AssertNotFound()
+	h.CallDataHash(`yaml`, map[string]interface{}{`path`: `testdata/empty.yaml`}).AssertFound(map[string]interface{}{})
+}
+
+func TestYAMLData_scalarKeysAndTimestamps(t *testing.T) {
+	h := hieratest.New(t)
+	h.Registry().DataHash(`yaml`, provider.YAMLData)
+	h.CallDataHash(`yaml`, map[string]interface{}{`path`: `testdata/scalars.yaml`}).AssertFound(map[string]interface{}{
+		`when`:    `2001-12-14`,
+		`stamp`:   `2001-12-14T21:59:43.10-05:00`,
+		`1`:       `one`,
+		`true`:    `yes`,
+		`dates`:   []interface{}{`2002-01-01`},
+		`base`:    map[string]interface{}{`a`: 1},
+		`derived`: map[string]interface{}{`a`: 1, `b`: 2}})
+}
+
+func TestYAMLData_paths(t *testing.T) {
+	h := hieratest.New(t)
+	h.Registry().DataHash(`yaml`, provider.YAMLData)
+	r := h.CallDataHash(`yaml`, map[string]interface{}{
+		`path`: `testdata/override.yaml`, `paths`: []string{`testdata/missing.yaml`, `testdata/common.yaml`}})
+	r.AssertFound(map[string]interface{}{
+		`host`:    `override.example.com`,
+		`extra`:   `value`,
+		`port`:    8080,
+		`ratio`:   0.5,
+		`enabled`: true,
+		`nothing`: nil,
+		`list`:    []interface{}{`a`, 2},
+		`nested`:  map[string]interface{}{`x`: 1}})
+	h.CallDataHash(`yaml`, map[string]interface{}{`paths`: []string{`testdata/missing.yaml`}}).AssertNotFound()
+}
+
+func TestYAMLData_dataDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hieratest.New(t)
+	h.Registry().DataHash(`yaml`, provider.YAMLData)
+
+	// Relative paths are resolved against the datadir, which is relative to the directory of hiera.yaml
+	h.SetHost(hiera.HostInfo{ConfigPath: filepath.Join(wd, `..`, `hiera.yaml`), DataDir: `provider/testdata`})
+	h.CallDataHash(`yaml`, map[string]interface{}{`path`: `override.yaml`}).AssertFound(
+		map[string]interface{}{`host`: `override.example.com`, `extra`: `value`})
+
+	// Without a datadir, relative paths are resolved against the directory of hiera.yaml
+	h.SetHost(hiera.HostInfo{ConfigPath: filepath.Join(wd, `testdata`, `hiera.yaml`)})
+	h.CallDataHash(`yaml`, map[string]interface{}{`path`: `override.yaml`}).AssertFound(
+		map[string]interface{}{`host`: `override.example.com`, `extra`: `value`})
+}
+
+func TestYAMLData_merge(t *testing.T) {
+	h := hieratest.New(t)
+	h.Registry().DataHash(`yaml`, provider.YAMLData)
+	r := h.CallDataHash(`yaml`, map[string]interface{}{
+		`paths`: []string{`testdata/deep.yaml`, `testdata/common.yaml`},
+		`merge`: map[string]interface{}{`strategy`: `deep`, `knockout_prefix`: `--`}})
+	r.AssertFound(map[string]interface{}{
+		`host`:    `example.com`,
+		`port`:    8080,
+		`ratio`:   0.5,
+		`enabled`: true,
+		`nothing`: nil,
+		`list`:    []interface{}{`b`, 2},
+		`nested`:  map[string]interface{}{`x`: 1, `y`: 2}})
+	r = h.CallDataHash(`yaml`, map[string]interface{}{
+		`paths`: []string{`testdata/deep.yaml`, `testdata/common.yaml`}, `merge`: `first`})
+	r.AssertFound(map[string]interface{}{`list`: []interface{}{`b`, `--a`}, `nested`: map[string]interface{}{`y`: 2}})
+	h.CallDataHash(`yaml`, map[string]interface{}{`path`: `testdata/deep.yaml`, `merge`: `unique`}).AssertError(
+		`option 'merge': merge strategy "unique" cannot merge data hashes`)
+	h.CallDataHash(`yaml`, map[string]interface{}{`path`: `testdata/deep.yaml`, `merge`: `last`}).AssertError(
+		`option 'merge': unknown merge strategy "last"`)
+}
+
+func TestYAMLData_errors(t *testing.T) {
+	h := hieratest.New(t)
+	h.Registry().DataHash(`yaml`, provider.YAMLData)
+	r := h.CallDataHash(`yaml`, nil)
+	r.AssertError(`option 'path': one of the options "path" or "paths" must be given`)
+	require.Equal(t, http.StatusBadRequest, r.Status)
+	h.CallDataHash(`yaml`, map[string]interface{}{`path`: 1}).AssertError(`option 'path': expected string, got int`)
+	h.CallDataHash(`yaml`, map[string]interface{}{`paths`: `x`}).AssertError(
+		`option 'paths': expected []string, got string`)
+	h.CallDataHash(`yaml`, map[string]interface{}{`paths`: []int{1}}).AssertError(
+		`option 'paths[0]': expected string, got int`)
+	h.CallDataHash(`yaml`, map[string]interface{}{`path`: `testdata/array.yaml`}).AssertError(
+		`testdata/array.yaml: expected a map`)
+	h.CallDataHash(`yaml`, map[string]interface{}{`path`: `testdata/bad.yaml`}).AssertError(`testdata/bad.yaml: yaml:`)
+	h.CallDataHash(`yaml`, map[string]interface{}{`path`: `testdata`}).AssertError(`testdata`)
+	h.CallDataHash(`yaml`, map[string]interface{}{`path`: `testdata/common.yaml/x`}).AssertError(`not a directory`)
+}
+
+func TestRegisterYAMLData(t *testing.T) {
+	register.Clean()
+	provider.RegisterYAMLData(`yaml`)
+	require.Equal(t, `reads a data hash from one or more YAML files`,
+		register.Metadata().Get(`data_hash`).(dgo.Map).Get(`yaml`).(dgo.Map).Get(`description`))
+}
+
+func TestYAMLData_conditional(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `provider`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, `data.yaml`)
+	if err = ioutil.WriteFile(path, []byte("a: 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reg := register.NewRegistry()
+	reg.DataHash(`yaml`, provider.YAMLData)
+	handler, _ := routes.RegisterWith(reg)
+	options := `{"path":"` + path + `"}`
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(`GET`, `/data_hash/yaml`, nil)
+		r.URL.RawQuery = url.Values{`options`: {options}}.Encode()
+		if ifNoneMatch != `` {
+			r.Header.Set(`If-None-Match`, ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := get(``)
+	require.Equal(t, http.StatusOK, rr.Code)
+	et := rr.Header().Get(`ETag`)
+	require.NotEqual(t, ``, et)
+	require.Equal(t, http.StatusNotModified, get(et).Code)
+
+	// A different merge strategy produces a different version
+	options = `{"path":"` + path + `","merge":{"strategy":"deep","sort_merged_arrays":true}}`
+	rr = get(et)
+	require.Equal(t, http.StatusOK, rr.Code)
+	det := rr.Header().Get(`ETag`)
+	require.NotEqual(t, et, det)
+	options = `{"path":"` + path + `","merge":{"strategy":"deep"}}`
+	require.Equal(t, http.StatusOK, get(det).Code)
+	options = `{"path":"` + path + `"}`
+
+	if err = ioutil.WriteFile(path, []byte("a: 22\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rr = get(et)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "{\"a\":22}\n", rr.Body.String())
+
+	if err = os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, http.StatusNotFound, get(et).Code)
+}
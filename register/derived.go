@@ -0,0 +1,214 @@
+package register
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+)
+
+// maxCachedHashes is the number of hashes that a derived function keeps before it discards them all
+const maxCachedHashes = 64
+
+// UnversionedHashTTL is the time that a derived function keeps a hash for which the data_hash function declared no
+// version. The data_hash function isn't called while such a hash is kept.
+const UnversionedHashTTL = 10 * time.Second
+
+type (
+	// hashCache holds the hashes that a data_hash function produced for different options and host contexts
+	hashCache struct {
+		lock    sync.Mutex
+		f       hiera.DataHash
+		ttl     time.Duration
+		entries map[string]*cachedHash
+	}
+
+	// cachedHash is a hash and its version. A hash without a version expires at the given time.
+	cachedHash struct {
+		version string
+		value   dgo.Value
+		expires time.Time
+	}
+
+	// hashContext is the ProviderContext that a data_hash function receives when it is called by a derived
+	// function. It answers SetVersion using the cached hash.
+	hashContext struct {
+		hiera.ProviderContext
+		cache   *hashCache
+		cached  *cachedHash
+		version string
+	}
+)
+
+func (c *hashContext) SetVersion(version string) bool {
+	c.version = version
+	return version != `` && c.cached != nil && c.cached.version == version
+}
+
+func (c *hashContext) Version() string {
+	return c.version
+}
+
+func (c *hashContext) Invalidate(reason string) {
+	c.cache.clear()
+	c.ProviderContext.Invalidate(reason)
+}
+
+// get returns the hash for the options and host context of the given ProviderContext. The data_hash function is
+// called each time but the cached hash is returned when the function declares the version of the cached hash. A
+// hash without a version is returned from the cache without calling the function until it expires.
+func (hc *hashCache) get(ctx hiera.ProviderContext) dgo.Value {
+	key := cacheKey(ctx)
+	hc.lock.Lock()
+	cached := hc.entries[key]
+	hc.lock.Unlock()
+
+	if cached != nil && cached.version == `` {
+		if time.Now().Before(cached.expires) {
+			return cached.value
+		}
+		cached = nil
+	}
+
+	fc := &hashContext{ProviderContext: ctx, cache: hc, cached: cached}
+	v := hc.f(fc)
+	entry := &cachedHash{version: fc.version, value: v}
+	if fc.version == `` {
+		entry.expires = time.Now().Add(hc.ttl)
+	} else {
+		// The version of the hash is also the version of every value derived from it
+		ctx.SetVersion(fc.version)
+		if cached != nil && cached.version == fc.version {
+			if v == nil {
+				v = cached.value
+			}
+			return v
+		}
+	}
+	hc.lock.Lock()
+	if hc.entries == nil || len(hc.entries) >= maxCachedHashes {
+		hc.entries = make(map[string]*cachedHash)
+	}
+	hc.entries[key] = entry
+	hc.lock.Unlock()
+	return v
+}
+
+// cacheKey returns the key of the hash for the options and host context of the given ProviderContext. The entries
+// of maps are sorted so that equal options produce the same key regardless of their order.
+func cacheKey(ctx hiera.ProviderContext) string {
+	b := &strings.Builder{}
+	writeKey(b, ctx.AllOptions())
+	for _, s := range []string{ctx.ConfigPath(), ctx.DataDir(), ctx.Level(), ctx.Environment()} {
+		b.WriteByte(0)
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+func writeKey(b *strings.Builder, v dgo.Value) {
+	switch c := v.(type) {
+	case dgo.Sensitive:
+		b.WriteString(`sensitive `)
+		writeKey(b, c.Unwrap())
+	case dgo.Map:
+		keys := make([]string, 0, c.Len())
+		values := make(map[string]dgo.Value, c.Len())
+		c.EachEntry(func(e dgo.MapEntry) {
+			kb := &strings.Builder{}
+			writeKey(kb, e.Key())
+			k := kb.String()
+			keys = append(keys, k)
+			values[k] = e.Value()
+		})
+		sort.Strings(keys)
+		b.WriteByte('{')
+		for _, k := range keys {
+			b.WriteString(k)
+			b.WriteByte(':')
+			writeKey(b, values[k])
+			b.WriteByte(',')
+		}
+		b.WriteByte('}')
+	case dgo.Array:
+		b.WriteByte('[')
+		c.Each(func(e dgo.Value) {
+			writeKey(b, e)
+			b.WriteByte(',')
+		})
+		b.WriteByte(']')
+	case dgo.String:
+		b.WriteString(strconv.Quote(c.GoString()))
+	default:
+		b.WriteString(v.String())
+	}
+}
+
+func (hc *hashCache) clear() {
+	hc.lock.Lock()
+	hc.entries = nil
+	hc.lock.Unlock()
+}
+
+// dig returns the value found by following the given segments from the given value, or nil if no value is found.
+// A string segment selects an entry of a map and an integer segment selects an entry of a map or an element of an
+// array. A sensitive value is unwrapped to dig into it and the value found in it is returned as sensitive.
+func dig(v dgo.Value, key dgo.Array) dgo.Value {
+	sensitive := false
+	for i := 0; i < key.Len() && v != nil; i++ {
+		if s, ok := v.(dgo.Sensitive); ok {
+			v = s.Unwrap()
+			sensitive = true
+		}
+		seg := key.Get(i)
+		switch c := v.(type) {
+		case dgo.Map:
+			v = c.Get(seg)
+		case dgo.Array:
+			v = nil
+			if n, ok := seg.(dgo.Integer); ok && n.GoInt() >= 0 && n.GoInt() < int64(c.Len()) {
+				v = c.Get(int(n.GoInt()))
+			}
+		default:
+			v = nil
+		}
+	}
+	if v != nil && sensitive {
+		if _, ok := v.(dgo.Sensitive); !ok {
+			v = vf.Sensitive(v)
+		}
+	}
+	return v
+}
+
+// DataHashWithLookups registers the given data_hash function under the given name together with a lookup_key and a
+// data_dig function of the same name that find their values in the hash. A host can then use the lookup_key or the
+// data_dig function to obtain single values instead of transferring the whole hash. The given MetaOptions apply to
+// all three functions.
+//
+// The lookup_key and data_dig functions call the data_hash function for each lookup. The hash is cached for the
+// options and the hierarchy level of the call when the data_hash function declares its version using
+// ProviderContext.SetVersion, which allows the function to return nil instead of producing the hash again when
+// SetVersion returns true. A hash without a version is cached for UnversionedHashTTL, during which the data_hash
+// function isn't called. The cached hashes are discarded when the function calls ProviderContext.Invalidate.
+func (r *Registry) DataHashWithLookups(name string, f hiera.DataHash, mos ...MetaOption) {
+	hc := &hashCache{f: f, ttl: UnversionedHashTTL}
+	r.DataHash(name, f, mos...)
+	r.LookupKey(name, func(ctx hiera.ProviderContext, key string) dgo.Value {
+		return dig(hc.get(ctx), vf.Values(key))
+	}, mos...)
+	r.DataDig(name, func(ctx hiera.ProviderContext, key dgo.Array) dgo.Value {
+		return dig(hc.get(ctx), key)
+	}, mos...)
+}
+
+// DataHashWithLookups registers the given data_hash function together with a lookup_key and a data_dig function of
+// the same name with the global registry. See Registry.DataHashWithLookups for details.
+func DataHashWithLookups(name string, f hiera.DataHash, mos ...MetaOption) {
+	global.DataHashWithLookups(name, f, mos...)
+}
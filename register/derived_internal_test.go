@@ -0,0 +1,53 @@
+package register
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+)
+
+func TestHashCache_unversionedExpires(t *testing.T) {
+	produced := 0
+	hc := &hashCache{ttl: 50 * time.Millisecond, f: func(ctx hiera.ProviderContext) dgo.Value {
+		produced++
+		return vf.Map(`a`, produced)
+	}}
+	ctx := hiera.NewProviderContext(nil)
+	require.Equal(t, vf.Map(`a`, 1), hc.get(ctx))
+	require.Equal(t, vf.Map(`a`, 1), hc.get(ctx))
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, vf.Map(`a`, 2), hc.get(ctx))
+	require.Equal(t, 2, produced)
+}
+
+func TestCacheKey(t *testing.T) {
+	key := func(options string) string {
+		return cacheKey(hiera.NewProviderContext(url.Values{`options`: {options}}))
+	}
+	require.Equal(t, key(`{"a":[1,"2"],"b":{"c":true,"d":null}}`), key(`{"b":{"d":null,"c":true},"a":[1,"2"]}`))
+	require.NotEqual(t, key(`{"a":[1,"2"]}`), key(`{"a":["1",2]}`))
+	require.NotEqual(t, key(`{"a":[1,2]}`), key(`{"a":[12]}`))
+
+	ctx := func(v dgo.Value) hiera.ProviderContext {
+		return &optionsContext{ProviderContext: hiera.NewProviderContext(nil), options: vf.Map(`a`, v)}
+	}
+	require.Equal(t, cacheKey(ctx(vf.Sensitive(`x`))), cacheKey(ctx(vf.Sensitive(`x`))))
+	require.NotEqual(t, cacheKey(ctx(vf.Sensitive(`x`))), cacheKey(ctx(vf.Sensitive(`y`))))
+	require.NotEqual(t, cacheKey(ctx(vf.Sensitive(`x`))), cacheKey(ctx(vf.String(`x`))))
+}
+
+// optionsContext is a ProviderContext with the given options, which may contain sensitive values
+type optionsContext struct {
+	hiera.ProviderContext
+	options dgo.Map
+}
+
+func (c *optionsContext) AllOptions() dgo.Map {
+	return c.options
+}
@@ -0,0 +1,122 @@
+package register_test
+
+import (
+	"net/url"
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
+)
+
+func TestDataHashWithLookups(t *testing.T) {
+	produced := 0
+	r := register.NewRegistry()
+	r.DataHashWithLookups(`dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		v, _ := ctx.StringOption(`version`)
+		if ctx.SetVersion(v) {
+			return nil
+		}
+		produced++
+		return vf.Map(
+			`a`, vf.Map(`b`, vf.Values(1, vf.Map(`c`, `d`))),
+			`s`, vf.Sensitive(vf.Map(`x`, `y`)),
+			`v`, v)
+	}, register.WithDescription(`the hash`))
+
+	var lk hiera.LookupKey
+	var dd hiera.DataDig
+	r.EachLookupKey(func(_ string, f hiera.LookupKey) { lk = f })
+	r.EachDataDig(func(_ string, f hiera.DataDig) { dd = f })
+	require.Equal(t, `the hash`, r.FunctionMeta(`data_dig`, `dh`).Description)
+
+	v1 := context(`{"version": "1"}`)
+	require.Equal(t, vf.Values(1, vf.Map(`c`, `d`)), lk(v1, `a`).(dgo.Map).Get(`b`))
+	require.True(t, lk(v1, `missing`) == nil)
+	require.Equal(t, `d`, dd(v1, vf.Values(`a`, `b`, 1, `c`)))
+	require.Equal(t, vf.Sensitive(`y`), dd(v1, vf.Values(`s`, `x`)))
+	require.True(t, dd(v1, vf.Values(`a`, `b`, 2)) == nil)
+	require.True(t, dd(v1, vf.Values(`a`, `b`, `c`)) == nil)
+	require.True(t, dd(v1, vf.Values(`v`, `x`)) == nil)
+	require.Equal(t, 1, produced)
+	require.Equal(t, `1`, v1.Version())
+
+	// Another version produces the hash again, a hash without a version is kept until it expires
+	require.Equal(t, `2`, lk(context(`{"version": "2"}`), `v`))
+	require.Equal(t, 2, produced)
+	require.Equal(t, ``, lk(context(`{}`), `v`))
+	require.Equal(t, ``, lk(context(`{}`), `v`))
+	require.Equal(t, 3, produced)
+
+	// The host context is part of the cache key
+	q := url.Values{`options`: {`{"version": "1"}`}, `level`: {`other`}}
+	require.Equal(t, `1`, lk(hiera.NewProviderContext(q), `v`))
+	require.Equal(t, 4, produced)
+
+	// The order of the options is not
+	require.Equal(t, `1`, lk(context(`{"version": "1", "x": {"a": 1, "b": "2"}}`), `v`))
+	require.Equal(t, `1`, lk(context(`{"x": {"b": "2", "a": 1}, "version": "1"}`), `v`))
+	require.Equal(t, 5, produced)
+	require.Equal(t, `1`, lk(context(`{"x": {"b": 2, "a": 1}, "version": "1"}`), `v`))
+	require.Equal(t, 6, produced)
+}
+
+func TestDataHashWithLookups_invalidate(t *testing.T) {
+	produced := 0
+	var saved hiera.ProviderContext
+	r := register.NewRegistry()
+	r.DataHashWithLookups(`dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		saved = ctx
+		if ctx.SetVersion(`1`) {
+			return nil
+		}
+		produced++
+		return vf.Map(`a`, produced)
+	})
+	r.EachLookupKey(func(_ string, f hiera.LookupKey) {
+		require.Equal(t, 1, f(context(`{}`), `a`))
+		require.Equal(t, 1, f(context(`{}`), `a`))
+		saved.Invalidate(`changed`)
+		require.Equal(t, 2, f(context(`{}`), `a`))
+	})
+}
+
+func TestDataHashWithLookups_invalidateUnversioned(t *testing.T) {
+	produced := 0
+	var saved hiera.ProviderContext
+	r := register.NewRegistry()
+	r.DataHashWithLookups(`dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		saved = ctx
+		produced++
+		return vf.Map(`a`, produced)
+	})
+	r.EachLookupKey(func(_ string, f hiera.LookupKey) {
+		require.Equal(t, 1, f(context(`{}`), `a`))
+		require.Equal(t, 1, f(context(`{}`), `a`))
+		saved.Invalidate(`changed`)
+		require.Equal(t, 2, f(context(`{}`), `a`))
+	})
+}
+
+func TestDataHashWithLookups_global(t *testing.T) {
+	register.Clean()
+	register.DataHashWithLookups(`dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		ctx.SetVersion(`1`)
+		return vf.Map(`version`, ctx.Version())
+	}, register.WithDescription(`the hash`))
+	var kinds []string
+	register.EachDataHash(func(string, hiera.DataHash) { kinds = append(kinds, `data_hash`) })
+	register.EachDataDig(func(_ string, f hiera.DataDig) {
+		kinds = append(kinds, `data_dig`)
+		require.Equal(t, `1`, f(context(`{}`), vf.Values(`version`)))
+	})
+	register.EachLookupKey(func(_ string, f hiera.LookupKey) {
+		kinds = append(kinds, `lookup_key`)
+		require.Equal(t, `1`, f(context(`{}`), `version`))
+	})
+	require.Equal(t, []string{`data_hash`, `data_dig`, `lookup_key`}, kinds)
+	require.Equal(t, `the hash`, register.Global().FunctionMeta(`lookup_key`, `dh`).Description)
+}
@@ -6,59 +6,131 @@ import (
 	"sort"
 	"sync"
 
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
 	"github.com/lyraproj/hierasdk/hiera"
 )
 
 type (
-	funcReg struct {
+	// Registry holds registered lookup functions. The zero value is an empty Registry ready to use. Most plugins
+	// use the global registry through the package level functions but tests and harnesses may create isolated
+	// registries using NewRegistry.
+	Registry struct {
 		lock       sync.RWMutex
-		dataDigs   map[string]interface{}
-		dataHashes map[string]interface{}
-		lookupKeys map[string]interface{}
+		dataDigs   map[string]*entry
+		dataHashes map[string]*entry
+		hashStream map[string]*entry
+		lookupKeys map[string]*entry
+	}
+
+	entry struct {
+		f    interface{}
+		meta *Meta
 	}
 )
 
-var global = funcReg{}
+var global = &Registry{}
+
+// NewRegistry returns a new empty Registry that is isolated from the global registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Global returns the global registry
+func Global() *Registry {
+	return global
+}
 
 // EachDataDig calls the given actor once with each registered DataDig function
-func (r *funcReg) EachDataDig(actor func(name string, f hiera.DataDig)) {
-	r.sortedEach(r.dataDigs, func(n string, f interface{}) { actor(n, f.(hiera.DataDig)) })
+func (r *Registry) EachDataDig(actor func(name string, f hiera.DataDig)) {
+	r.sortedEach(r.dataDigs, func(n string, e *entry) { actor(n, e.f.(hiera.DataDig)) })
 }
 
 // EachDataHash calls the given actor once with each registered DataHash function
-func (r *funcReg) EachDataHash(actor func(name string, f hiera.DataHash)) {
-	r.sortedEach(r.dataHashes, func(n string, f interface{}) { actor(n, f.(hiera.DataHash)) })
+func (r *Registry) EachDataHash(actor func(name string, f hiera.DataHash)) {
+	r.sortedEach(r.dataHashes, func(n string, e *entry) { actor(n, e.f.(hiera.DataHash)) })
+}
+
+// EachStreamingDataHash calls the given actor once with each registered StreamingDataHash function
+func (r *Registry) EachStreamingDataHash(actor func(name string, f hiera.StreamingDataHash)) {
+	r.sortedEach(r.hashStream, func(n string, e *entry) { actor(n, e.f.(hiera.StreamingDataHash)) })
 }
 
 // EachLookupKey calls the given actor once with each registered LookupKey function
-func (r *funcReg) EachLookupKey(actor func(name string, f hiera.LookupKey)) {
-	r.sortedEach(r.lookupKeys, func(n string, f interface{}) { actor(n, f.(hiera.LookupKey)) })
+func (r *Registry) EachLookupKey(actor func(name string, f hiera.LookupKey)) {
+	r.sortedEach(r.lookupKeys, func(n string, e *entry) { actor(n, e.f.(hiera.LookupKey)) })
 }
 
 // Empty returns true if no functions have been registered
-func (r *funcReg) Empty() bool {
+func (r *Registry) Empty() bool {
 	r.lock.RLock()
-	empty := len(r.dataDigs)+len(r.dataHashes)+len(r.lookupKeys) == 0
+	empty := len(r.dataDigs)+len(r.dataHashes)+len(r.hashStream)+len(r.lookupKeys) == 0
 	r.lock.RUnlock()
 	return empty
 }
 
 // DataDig registers a DataDig function under the given name
-func (r *funcReg) DataDig(name string, f hiera.DataDig) {
-	r.register(&r.dataDigs, `data_dig`, name, f)
+func (r *Registry) DataDig(name string, f hiera.DataDig, mos ...MetaOption) {
+	r.register(&r.dataDigs, `data_dig`, name, f, mos)
 }
 
 // DataHash registers a DataHash function under the given name
-func (r *funcReg) DataHash(name string, f hiera.DataHash) {
-	r.register(&r.dataHashes, `data_hash`, name, f)
+func (r *Registry) DataHash(name string, f hiera.DataHash, mos ...MetaOption) {
+	r.register(&r.dataHashes, `data_hash`, name, f, mos)
+}
+
+// StreamingDataHash registers a StreamingDataHash function under the given name. The function is served as a
+// data_hash function and its name must be distinct from the names of all other data_hash functions.
+func (r *Registry) StreamingDataHash(name string, f hiera.StreamingDataHash, mos ...MetaOption) {
+	r.register(&r.hashStream, `data_hash`, name, f, mos)
 }
 
 // LookupKey registers a LookupKey function under the given name
-func (r *funcReg) LookupKey(name string, f hiera.LookupKey) {
-	r.register(&r.lookupKeys, `lookup_key`, name, f)
+func (r *Registry) LookupKey(name string, f hiera.LookupKey, mos ...MetaOption) {
+	r.register(&r.lookupKeys, `lookup_key`, name, f, mos)
 }
 
-func (r *funcReg) sortedEach(m map[string]interface{}, f func(string, interface{})) {
+// FunctionMeta returns the metadata of the function of the given type ("data_dig", "data_hash", or "lookup_key")
+// that is registered under the given name, or nil if no such function exists or if it has no metadata.
+func (r *Registry) FunctionMeta(tp, name string) *Meta {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if e := r.find(tp, name); e != nil {
+		return e.meta
+	}
+	return nil
+}
+
+// Metadata returns a Map keyed by function type where each value is a Map of function name to the metadata
+// of that function. Functions that were registered without metadata are not included.
+func (r *Registry) Metadata() dgo.Map {
+	m := vf.MutableMap(nil)
+	add := func(tp string, ems ...map[string]*entry) {
+		em := make(map[string]*entry)
+		r.lock.RLock()
+		for _, ce := range ems {
+			for n, e := range ce {
+				em[n] = e
+			}
+		}
+		r.lock.RUnlock()
+		fm := vf.MutableMap(nil)
+		r.sortedEach(em, func(n string, e *entry) {
+			if e.meta != nil {
+				fm.Put(n, e.meta.ToMap())
+			}
+		})
+		if fm.Len() > 0 {
+			m.Put(tp, fm)
+		}
+	}
+	add(`data_dig`, r.dataDigs)
+	add(`data_hash`, r.dataHashes, r.hashStream)
+	add(`lookup_key`, r.lookupKeys)
+	return m
+}
+
+func (r *Registry) sortedEach(m map[string]*entry, f func(string, *entry)) {
 	r.lock.RLock()
 	defer r.lock.RUnlock()
 	ks := make([]string, len(m))
@@ -73,39 +145,74 @@ func (r *funcReg) sortedEach(m map[string]interface{}, f func(string, interface{
 	}
 }
 
-func (r *funcReg) register(mp *map[string]interface{}, tp, name string, f interface{}) {
+func (r *Registry) register(mp *map[string]*entry, tp, name string, f interface{}, mos []MetaOption) {
+	var meta *Meta
+	if len(mos) > 0 {
+		meta = &Meta{}
+		for _, mo := range mos {
+			mo(meta)
+		}
+	}
 	r.lock.Lock()
 	m := *mp
 	if m == nil {
-		m = make(map[string]interface{})
+		m = make(map[string]*entry)
 		*mp = m
 	}
-	if _, ok := m[name]; ok {
+	if r.find(tp, name) != nil {
 		r.lock.Unlock()
 		panic(fmt.Errorf(`%s function '%s' is already registered`, tp, name))
 	}
-	m[name] = f
+	m[name] = &entry{f: f, meta: meta}
 	r.lock.Unlock()
 }
 
+// find returns the entry of the given type and name or nil if no such entry exists. The caller must hold the lock.
+func (r *Registry) find(tp, name string) *entry {
+	var ms []map[string]*entry
+	switch tp {
+	case `data_dig`:
+		ms = []map[string]*entry{r.dataDigs}
+	case `data_hash`:
+		ms = []map[string]*entry{r.dataHashes, r.hashStream}
+	case `lookup_key`:
+		ms = []map[string]*entry{r.lookupKeys}
+	}
+	for _, m := range ms {
+		if e, ok := m[name]; ok {
+			return e
+		}
+	}
+	return nil
+}
+
 // Clean removes any prior registrations. Should only be used in tests
 func Clean() {
-	global = funcReg{}
+	global = &Registry{}
 }
 
-// DataDig registers a DataDig function under the given name with the global registry
-func DataDig(name string, f hiera.DataDig) {
-	global.DataDig(name, f)
+// DataDig registers a DataDig function under the given name with the global registry. The optional MetaOptions
+// describe the function to the host.
+func DataDig(name string, f hiera.DataDig, mos ...MetaOption) {
+	global.DataDig(name, f, mos...)
 }
 
-// DataHash registers a DataHash function under the given name with the global registry
-func DataHash(name string, f hiera.DataHash) {
-	global.DataHash(name, f)
+// DataHash registers a DataHash function under the given name with the global registry. The optional MetaOptions
+// describe the function to the host.
+func DataHash(name string, f hiera.DataHash, mos ...MetaOption) {
+	global.DataHash(name, f, mos...)
 }
 
-// LookupKey registers a LookupKey function under the given name with the global registry
-func LookupKey(name string, f hiera.LookupKey) {
-	global.LookupKey(name, f)
+// StreamingDataHash registers a StreamingDataHash function under the given name with the global registry. The
+// optional MetaOptions describe the function to the host.
+func StreamingDataHash(name string, f hiera.StreamingDataHash, mos ...MetaOption) {
+	global.StreamingDataHash(name, f, mos...)
+}
+
+// LookupKey registers a LookupKey function under the given name with the global registry. The optional MetaOptions
+// describe the function to the host.
+func LookupKey(name string, f hiera.LookupKey, mos ...MetaOption) {
+	global.LookupKey(name, f, mos...)
 }
 
 // EachDataDig calls the given actor once with each registered DataDig function in the global registry
@@ -118,11 +225,23 @@ func EachDataHash(actor func(name string, f hiera.DataHash)) {
 	global.EachDataHash(actor)
 }
 
+// EachStreamingDataHash calls the given actor once with each registered StreamingDataHash function in the global
+// registry
+func EachStreamingDataHash(actor func(name string, f hiera.StreamingDataHash)) {
+	global.EachStreamingDataHash(actor)
+}
+
 // EachLookupKey calls the given actor once with each registered LookupKey function in the global registry
 func EachLookupKey(actor func(name string, f hiera.LookupKey)) {
 	global.EachLookupKey(actor)
 }
 
+// Metadata returns the metadata of all functions registered with the global registry, keyed by function type
+// and function name.
+func Metadata() dgo.Map {
+	return global.Metadata()
+}
+
 // Empty returns true if no functions have been registered with the global registry
 func Empty() bool {
 	return global.Empty()
@@ -6,6 +6,7 @@ import (
 	require "github.com/lyraproj/dgo/dgo_test"
 
 	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
 	"github.com/lyraproj/hierasdk/hiera"
 	"github.com/lyraproj/hierasdk/register"
 )
@@ -45,6 +46,30 @@ func TestDataHash(t *testing.T) {
 	require.Equal(t, `l1l2`, x)
 }
 
+func TestStreamingDataHash(t *testing.T) {
+	register.Clean()
+	register.StreamingDataHash(`l1`, func(ic hiera.ProviderContext, yield func(string, dgo.Value)) {},
+		register.WithDescription(`streams`))
+	register.DataHash(`l2`, func(ic hiera.ProviderContext) dgo.Value {
+		return nil
+	})
+	x := ``
+	register.EachStreamingDataHash(func(n string, _ hiera.StreamingDataHash) {
+		x += n
+	})
+	require.Equal(t, `l1`, x)
+	require.False(t, register.Empty())
+	require.Equal(t, vf.Map(`data_hash`, vf.Map(`l1`, vf.Map(`description`, `streams`))), register.Metadata())
+	require.Panic(t, func() {
+		register.DataHash(`l1`, func(ic hiera.ProviderContext) dgo.Value {
+			return nil
+		})
+	}, `already registered`)
+	require.Panic(t, func() {
+		register.StreamingDataHash(`l2`, func(ic hiera.ProviderContext, yield func(string, dgo.Value)) {})
+	}, `already registered`)
+}
+
 func TestLookupKey(t *testing.T) {
 	register.Clean()
 	register.LookupKey(`l1`, func(ic hiera.ProviderContext, key string) dgo.Value {
@@ -83,3 +108,30 @@ func TestCombo(t *testing.T) {
 	})
 	require.Equal(t, `l1l1l1`, x)
 }
+
+func TestMetadata(t *testing.T) {
+	register.Clean()
+	register.DataHash(`l1`, func(ic hiera.ProviderContext) dgo.Value {
+		return nil
+	},
+		register.WithDescription(`reads data from a file`),
+		register.WithRequiredOption(`path`, `string`, `path to the file`),
+		register.WithOption(`strict`, `bool`, ``),
+		register.WithSensitiveOption(`token`, `string`, `access token`),
+		register.WithExample("- name: common\n  data_hash: l1\n  options:\n    path: common.yaml\n"),
+		register.WithDeprecation(`use l2 instead`))
+	register.LookupKey(`l2`, func(ic hiera.ProviderContext, key string) dgo.Value {
+		return nil
+	})
+	require.Equal(t, vf.Map(`data_hash`, vf.Map(`l1`, vf.Map(
+		`description`, `reads data from a file`,
+		`options`, vf.Map(
+			`path`, vf.Map(`type`, `string`, `description`, `path to the file`, `required`, true),
+			`strict`, vf.Map(`type`, `bool`),
+			`token`, vf.Map(`type`, `string`, `description`, `access token`, `sensitive`, true)),
+		`examples`, vf.Strings("- name: common\n  data_hash: l1\n  options:\n    path: common.yaml\n"),
+		`deprecated`, `use l2 instead`))), register.Metadata())
+	require.Equal(t, []string{`token`}, register.Global().FunctionMeta(`data_hash`, `l1`).SensitiveOptions())
+	require.True(t, register.Global().FunctionMeta(`lookup_key`, `l2`) == nil)
+	require.True(t, register.Global().FunctionMeta(`data_dig`, `l1`) == nil)
+}
@@ -0,0 +1,129 @@
+package register
+
+import (
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+)
+
+type (
+	// Meta contains the metadata that describes a registered function to the host so that it can render help
+	// for the function and validate its use.
+	Meta struct {
+		// Description is a short description of what the function does
+		Description string
+
+		// Options documents the options that the function understands, in the order they were declared
+		Options []OptionDoc
+
+		// Examples are hiera.yaml snippets that show how the function is used in a hierarchy
+		Examples []string
+
+		// Deprecated is a deprecation notice. An empty string means that the function isn't deprecated
+		Deprecated string
+	}
+
+	// OptionDoc documents one option that a function reads from its ProviderContext
+	OptionDoc struct {
+		// Name is the name of the option
+		Name string
+
+		// Type is the type of the option in dgo type syntax, e.g. "string" or "[]string"
+		Type string
+
+		// Description describes the purpose of the option
+		Description string
+
+		// Required is true when the function cannot operate without the option
+		Required bool
+
+		// Sensitive is true when the value of the option must not be revealed in error messages and logs
+		Sensitive bool
+	}
+
+	// MetaOption is passed to the registration functions to add metadata to the registered function
+	MetaOption func(*Meta)
+)
+
+// WithDescription sets the description of the registered function
+func WithDescription(description string) MetaOption {
+	return func(m *Meta) { m.Description = description }
+}
+
+// WithOption documents an optional option of the registered function
+func WithOption(name, typ, description string) MetaOption {
+	return func(m *Meta) {
+		m.Options = append(m.Options, OptionDoc{Name: name, Type: typ, Description: description})
+	}
+}
+
+// WithRequiredOption documents a required option of the registered function
+func WithRequiredOption(name, typ, description string) MetaOption {
+	return func(m *Meta) {
+		m.Options = append(m.Options, OptionDoc{Name: name, Type: typ, Description: description, Required: true})
+	}
+}
+
+// WithSensitiveOption documents an option of the registered function that holds a secret such as a password or a
+// token. The value of such an option is redacted from error messages.
+func WithSensitiveOption(name, typ, description string) MetaOption {
+	return func(m *Meta) {
+		m.Options = append(m.Options, OptionDoc{Name: name, Type: typ, Description: description, Sensitive: true})
+	}
+}
+
+// WithExample adds an example hiera.yaml snippet to the registered function
+func WithExample(example string) MetaOption {
+	return func(m *Meta) { m.Examples = append(m.Examples, example) }
+}
+
+// WithDeprecation marks the registered function as deprecated using the given notice
+func WithDeprecation(notice string) MetaOption {
+	return func(m *Meta) { m.Deprecated = notice }
+}
+
+// ToMap returns the metadata as a Map suitable for transfer to the host. Empty fields are omitted.
+func (m *Meta) ToMap() dgo.Map {
+	r := vf.MutableMap(nil)
+	if m.Description != `` {
+		r.Put(`description`, m.Description)
+	}
+	if len(m.Options) > 0 {
+		om := vf.MutableMap(nil)
+		for i := range m.Options {
+			od := &m.Options[i]
+			d := vf.MutableMap(nil)
+			if od.Type != `` {
+				d.Put(`type`, od.Type)
+			}
+			if od.Description != `` {
+				d.Put(`description`, od.Description)
+			}
+			if od.Required {
+				d.Put(`required`, true)
+			}
+			if od.Sensitive {
+				d.Put(`sensitive`, true)
+			}
+			om.Put(od.Name, d)
+		}
+		r.Put(`options`, om)
+	}
+	if len(m.Examples) > 0 {
+		r.Put(`examples`, vf.Strings(m.Examples...))
+	}
+	if m.Deprecated != `` {
+		r.Put(`deprecated`, m.Deprecated)
+	}
+	return r
+}
+
+// SensitiveOptions returns the names of the options that are documented as sensitive
+func (m *Meta) SensitiveOptions() []string {
+	var ns []string
+	for i := range m.Options {
+		if m.Options[i].Sensitive {
+			ns = append(ns, m.Options[i].Name)
+		}
+	}
+	return ns
+}
@@ -0,0 +1,397 @@
+package register
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/typ"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+)
+
+type (
+	// optionStruct describes the fields of a struct that options are decoded into
+	optionStruct struct {
+		fields []*optionField
+	}
+
+	// optionField describes a struct field that holds one option
+	optionField struct {
+		name        string
+		index       int
+		typ         string
+		description string
+		required    bool
+		sensitive   bool
+		dflt        dgo.Value
+	}
+)
+
+var (
+	optionStructs sync.Map
+
+	durationType = reflect.TypeOf(time.Duration(0))
+	valueType    = reflect.TypeOf((*dgo.Value)(nil)).Elem()
+)
+
+// DecodeOptions decodes the options of the given ProviderContext into the struct that the given target points to.
+// The option that corresponds to an exported field is named by the field's "hiera" tag, or by the field's name in
+// lower case when the field has no such tag. The tag may be followed by the flags "required" and "sensitive", e.g.
+//
+//	type Options struct {
+//		Path    string        `hiera:"path,required" description:"path to the data file"`
+//		Token   string        `hiera:"token,sensitive"`
+//		Timeout time.Duration `hiera:"timeout" default:"5s"`
+//		Ignored string        `hiera:"-"`
+//	}
+//
+// A "default" tag holds the value that is used when the option is missing. It is used verbatim for string and
+// duration fields and parsed as JSON for other fields. A "description" tag documents the option.
+//
+// The lowercased field name makes untagged fields match the lowercase option names that Hiera uses. It differs from
+// hiera.ToData, which uses the "json" tag or the field name verbatim, so a struct that is used both for options and
+// for results should tag every field with a "hiera" tag.
+//
+// Fields may be strings, booleans, numbers, durations (parsed from strings such as "1m30s"), []byte (from binary
+// values), slices, maps with string keys, nested structs, pointers to such types, dgo.Value, and interface{}.
+// Booleans, strings, numbers, and durations are converted by a hiera.OptionReader that doesn't coerce, so the rules
+// and error messages are the same as when the options are read using ProviderContext.Options. Sensitive values are
+// unwrapped unless the field is a dgo.Value.
+//
+// A missing required option, or an option that cannot be decoded into its field, results in a *hiera.OptionError.
+// DecodeOptions panics if the target isn't a pointer to a struct or if the struct has fields that cannot hold an
+// option.
+func DecodeOptions(ctx hiera.ProviderContext, target interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		panic(fmt.Errorf(`DecodeOptions: expected a pointer to a struct, got %T`, target))
+	}
+	return decodeStruct(``, ctx.Option, rv.Elem())
+}
+
+// WithOptionsFrom documents the options that DecodeOptions decodes into the given struct or pointer to a struct.
+// Options that are already documented by preceding MetaOptions are not documented again.
+func WithOptionsFrom(options interface{}) MetaOption {
+	t := reflect.TypeOf(options)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		panic(fmt.Errorf(`WithOptionsFrom: expected a struct, got %T`, options))
+	}
+	os := optionsOf(t)
+	return func(m *Meta) {
+		for _, f := range os.fields {
+			if !m.hasOption(f.name) {
+				m.Options = append(m.Options, OptionDoc{
+					Name: f.name, Type: f.typ, Description: f.description, Required: f.required, Sensitive: f.sensitive})
+			}
+		}
+	}
+}
+
+func (m *Meta) hasOption(name string) bool {
+	for i := range m.Options {
+		if m.Options[i].Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// optionsOf returns the description of the given struct type. It panics if the struct cannot hold options.
+func optionsOf(t reflect.Type) *optionStruct {
+	if os, ok := optionStructs.Load(t); ok {
+		return os.(*optionStruct)
+	}
+	os := &optionStruct{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get(`hiera`)
+		if sf.PkgPath != `` || tag == `-` {
+			continue
+		}
+		parts := strings.Split(tag, `,`)
+		f := &optionField{name: parts[0], index: i, typ: typeString(sf.Type), description: sf.Tag.Get(`description`)}
+		if f.name == `` {
+			f.name = strings.ToLower(sf.Name)
+		}
+		for _, flag := range parts[1:] {
+			switch flag {
+			case `required`:
+				f.required = true
+			case `sensitive`:
+				f.sensitive = true
+			case `omitempty`:
+				// Only affects hiera.ToData, which allows the same struct to be used for options and results
+			default:
+				panic(fmt.Errorf(`%s.%s: unknown hiera tag flag '%s'`, t, sf.Name, flag))
+			}
+		}
+		if d, ok := sf.Tag.Lookup(`default`); ok {
+			f.dflt = parseDefault(d, sf.Type)
+			if err := assign(f.name, f.dflt, reflect.New(sf.Type).Elem()); err != nil {
+				panic(fmt.Errorf(`%s.%s: invalid default: %s`, t, sf.Name, err.Error()))
+			}
+		}
+		os.fields = append(os.fields, f)
+	}
+	optionStructs.Store(t, os)
+	return os
+}
+
+func parseDefault(d string, t reflect.Type) dgo.Value {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.String || t == durationType {
+		return vf.String(d)
+	}
+	v, err := vf.UnmarshalJSON([]byte(d))
+	if err != nil {
+		panic(fmt.Errorf(`invalid default %q: %s`, d, err.Error()))
+	}
+	return v
+}
+
+// typeString returns the dgo type syntax of the values that the given type can hold. It panics if the type cannot
+// hold an option.
+func typeString(t reflect.Type) string {
+	if t == durationType {
+		return `string`
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		if t == valueType || t.NumMethod() == 0 {
+			return `any`
+		}
+	case reflect.Ptr:
+		return typeString(t.Elem())
+	case reflect.Bool:
+		return `bool`
+	case reflect.String:
+		return `string`
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return `int`
+	case reflect.Float32, reflect.Float64:
+		return `float`
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		return compositeTypeString(t)
+	}
+	panic(fmt.Errorf(`type %s cannot hold an option`, t))
+}
+
+// compositeTypeString returns the dgo type syntax of the values that the given slice, map, or struct type can hold
+func compositeTypeString(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return `binary`
+		}
+		return `[]` + typeString(t.Elem())
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return `map[string]` + typeString(t.Elem())
+		}
+		panic(fmt.Errorf(`type %s cannot hold an option`, t))
+	}
+	fs := optionsOf(t).fields
+	es := make([]string, len(fs))
+	for i, f := range fs {
+		opt := `?`
+		if f.required {
+			opt = ``
+		}
+		es[i] = strconv.Quote(f.name) + opt + `:` + f.typ
+	}
+	return `{` + strings.Join(es, `,`) + `}`
+}
+
+// decodeStruct sets the fields of the given struct to the values that the given function returns for their names
+func decodeStruct(path string, get func(string) dgo.Value, rv reflect.Value) error {
+	for _, f := range optionsOf(rv.Type()).fields {
+		p := f.name
+		if path != `` {
+			p = path + `.` + p
+		}
+		v := get(f.name)
+		if v == nil || v == vf.Nil {
+			if f.required {
+				return hiera.NewOptionError(p, `required option is missing`)
+			}
+			if f.dflt == nil {
+				continue
+			}
+			v = f.dflt
+		}
+		if err := assign(p, v, rv.Field(f.index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assign sets the given reflected value to the given value
+func assign(path string, v dgo.Value, rv reflect.Value) error {
+	t := rv.Type()
+	if t == valueType {
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if s, ok := v.(dgo.Sensitive); ok {
+		v = s.Unwrap()
+	}
+	if t.Kind() == reflect.Interface {
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if t == durationType {
+		if v == vf.Nil {
+			return mismatch(path, t, v)
+		}
+		d, err := scalarReader(path, v).Duration(path, 0)
+		if err == nil {
+			rv.SetInt(int64(d))
+		}
+		return err
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		e := reflect.New(t.Elem())
+		if err := assign(path, v, e.Elem()); err != nil {
+			return err
+		}
+		rv.Set(e)
+		return nil
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		return assignComposite(path, v, rv)
+	}
+	if v == vf.Nil {
+		return mismatch(path, t, v)
+	}
+	return assignScalar(path, v, rv)
+}
+
+// assignComposite sets the given reflected slice, map, or struct to the given value
+func assignComposite(path string, v dgo.Value, rv reflect.Value) error {
+	t := rv.Type()
+	switch t.Kind() {
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if b, ok := v.(dgo.Binary); ok {
+				rv.SetBytes(b.GoBytes())
+				return nil
+			}
+		} else if a, ok := v.(dgo.Array); ok {
+			return assignSlice(path, a, rv)
+		}
+	case reflect.Map:
+		if m, ok := v.(dgo.Map); ok {
+			return assignMap(path, m, rv)
+		}
+	default:
+		if m, ok := v.(dgo.Map); ok {
+			return decodeStruct(path, func(n string) dgo.Value { return m.Get(n) }, rv)
+		}
+	}
+	return mismatch(path, t, v)
+}
+
+// scalarReader returns an OptionReader that reads the given value as the option with the given path
+func scalarReader(path string, v dgo.Value) hiera.OptionReader {
+	return hiera.NewMapOptionReader(vf.Map(path, v))
+}
+
+// assignScalar sets the given reflected bool, string, or number to the given value using the conversions of a
+// hiera.OptionReader
+func assignScalar(path string, v dgo.Value, rv reflect.Value) error {
+	r := scalarReader(path, v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		b, err := r.Bool(path, false)
+		if err != nil {
+			return err
+		}
+		rv.SetBool(b)
+	case reflect.String:
+		s, err := r.String(path, ``)
+		if err != nil {
+			return err
+		}
+		rv.SetString(s)
+	case reflect.Float32, reflect.Float64:
+		f, err := r.Float(path, 0)
+		if err != nil {
+			return err
+		}
+		rv.SetFloat(f)
+	default:
+		i, err := r.Int(path, 0)
+		if err != nil {
+			return err
+		}
+		n := int64(i)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if rv.OverflowInt(n) {
+				return hiera.NewOptionError(path, `value %d is out of range`, n)
+			}
+			rv.SetInt(n)
+		default:
+			if n < 0 || rv.OverflowUint(uint64(n)) {
+				return hiera.NewOptionError(path, `value %d is out of range`, n)
+			}
+			rv.SetUint(uint64(n))
+		}
+	}
+	return nil
+}
+
+func assignSlice(path string, a dgo.Array, rv reflect.Value) error {
+	s := reflect.MakeSlice(rv.Type(), a.Len(), a.Len())
+	for i := 0; i < a.Len(); i++ {
+		if err := assign(fmt.Sprintf(`%s[%d]`, path, i), a.Get(i), s.Index(i)); err != nil {
+			return err
+		}
+	}
+	rv.Set(s)
+	return nil
+}
+
+func assignMap(path string, m dgo.Map, rv reflect.Value) (err error) {
+	t := rv.Type()
+	rm := reflect.MakeMapWithSize(t, m.Len())
+	m.EachEntry(func(e dgo.MapEntry) {
+		if err != nil {
+			return
+		}
+		k, ok := e.Key().(dgo.String)
+		if !ok {
+			err = hiera.NewOptionError(path, `expected string keys, got %s`, describe(e.Key()))
+			return
+		}
+		ev := reflect.New(t.Elem()).Elem()
+		if err = assign(path+`.`+k.GoString(), e.Value(), ev); err == nil {
+			rm.SetMapIndex(reflect.ValueOf(k.GoString()).Convert(t.Key()), ev)
+		}
+	})
+	if err == nil {
+		rv.Set(rm)
+	}
+	return
+}
+
+func mismatch(path string, t reflect.Type, v dgo.Value) error {
+	return hiera.NewOptionError(path, `expected %s, got %s`, typeString(t), describe(v))
+}
+
+// describe returns the generic type of the given value
+func describe(v dgo.Value) string {
+	return typ.Generic(v.Type()).String()
+}
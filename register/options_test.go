@@ -0,0 +1,222 @@
+package register_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/newtype"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
+)
+
+type server struct {
+	Host string `hiera:"host,required"`
+	Port uint16 `hiera:"port" default:"8080"`
+}
+
+type options struct {
+	Path     string            `hiera:"path,required" description:"the path"`
+	Token    string            `hiera:"token,sensitive"`
+	Timeout  time.Duration     `hiera:"timeout" default:"5s"`
+	Retries  *int              `hiera:"retries"`
+	Ratio    float64           `hiera:"ratio" default:"0.5"`
+	Verbose  bool              `hiera:"verbose"`
+	Tags     []string          `hiera:"tags"`
+	Labels   map[string]string `hiera:"labels"`
+	Servers  []server          `hiera:"servers"`
+	Data     []byte            `hiera:"data"`
+	Extra    dgo.Value         `hiera:"extra"`
+	Any      interface{}       `hiera:"any"`
+	Untagged string
+	Ignored  string `hiera:"-"`
+	private  string
+}
+
+func context(options string) hiera.ProviderContext {
+	return hiera.NewProviderContext(url.Values{`options`: {options}})
+}
+
+func TestDecodeOptions(t *testing.T) {
+	var o options
+	require.Nil(t, register.DecodeOptions(context(`{
+		"path": "/a",
+		"token": "secret",
+		"retries": 3,
+		"ratio": 2,
+		"verbose": true,
+		"tags": ["x", "y"],
+		"labels": {"a": "b"},
+		"servers": [{"host": "example.com"}, {"host": "example.org", "port": 80}],
+		"extra": {"e": 1},
+		"any": "thing",
+		"untagged": "u",
+		"ignored": "i"}`), &o))
+	require.Equal(t, `/a`, o.Path)
+	require.Equal(t, `secret`, o.Token)
+	require.Equal(t, 5*time.Second, o.Timeout)
+	require.Equal(t, 3, *o.Retries)
+	require.Equal(t, 2.0, o.Ratio)
+	require.True(t, o.Verbose)
+	require.Equal(t, []string{`x`, `y`}, o.Tags)
+	require.Equal(t, map[string]string{`a`: `b`}, o.Labels)
+	require.Equal(t, 2, len(o.Servers))
+	require.Equal(t, `example.com`, o.Servers[0].Host)
+	require.Equal(t, 8080, o.Servers[0].Port)
+	require.Equal(t, `example.org`, o.Servers[1].Host)
+	require.Equal(t, 80, o.Servers[1].Port)
+	require.Equal(t, vf.Map(`e`, 1), o.Extra)
+	require.Equal(t, vf.String(`thing`), o.Any)
+	require.Equal(t, `u`, o.Untagged)
+	require.Equal(t, ``, o.Ignored)
+
+	o = options{}
+	require.Nil(t, register.DecodeOptions(context(`{"path": "/a", "timeout": "1m"}`), &o))
+	require.Equal(t, time.Minute, o.Timeout)
+	require.Equal(t, 0.5, o.Ratio)
+	require.True(t, o.Retries == nil)
+}
+
+func TestDecodeOptions_sensitive(t *testing.T) {
+	var o options
+	c := hiera.NewProviderContext(nil)
+	require.Equal(t, `option 'path': required option is missing`, register.DecodeOptions(c, &o).Error())
+
+	var s struct {
+		Token  string    `hiera:"token"`
+		Secret dgo.Value `hiera:"secret"`
+	}
+	c = &sensitiveContext{c}
+	require.Nil(t, register.DecodeOptions(c, &s))
+	require.Equal(t, `x`, s.Token)
+	require.Equal(t, vf.Sensitive(`x`), s.Secret)
+}
+
+type sensitiveContext struct {
+	hiera.ProviderContext
+}
+
+func (c *sensitiveContext) Option(name string) dgo.Value {
+	return vf.Sensitive(`x`)
+}
+
+type mapContext struct {
+	hiera.ProviderContext
+	options dgo.Map
+}
+
+func (c *mapContext) Option(name string) dgo.Value {
+	return c.options.Get(name)
+}
+
+func TestDecodeOptions_values(t *testing.T) {
+	var o struct {
+		Data   []byte            `hiera:"data"`
+		Limit  *int              `hiera:"limit" default:"3"`
+		Labels map[string]string `hiera:"labels,omitempty"`
+	}
+	c := &mapContext{hiera.NewProviderContext(nil), vf.Map(`data`, vf.Binary([]byte{1, 2}, false))}
+	require.Nil(t, register.DecodeOptions(c, &o))
+	require.Equal(t, []byte{1, 2}, o.Data)
+	require.Equal(t, 3, *o.Limit)
+
+	c.options = vf.Map(`labels`, vf.Map(1, `a`))
+	err := register.DecodeOptions(c, &o)
+	require.True(t, err != nil)
+	require.Equal(t, `option 'labels': expected string keys, got int`, err.Error())
+}
+
+func TestDecodeOptions_errors(t *testing.T) {
+	for opts, msg := range map[string]string{
+		`{}`:                                 `option 'path': required option is missing`,
+		`{"path": null}`:                     `option 'path': required option is missing`,
+		`{"path": 1}`:                        `option 'path': expected string, got int`,
+		`{"path": "/a", "timeout": "soon"}`:  `option 'timeout': invalid duration "soon"`,
+		`{"path": "/a", "timeout": 5}`:       `option 'timeout': expected duration string, got int`,
+		`{"path": "/a", "retries": "3"}`:     `option 'retries': expected int, got string`,
+		`{"path": "/a", "tags": ["a", 1]}`:   `option 'tags[1]': expected string, got int`,
+		`{"path": "/a", "labels": {"a": 1}}`: `option 'labels.a': expected string, got int`,
+		`{"path": "/a", "servers": [{}]}`:    `option 'servers[0].host': required option is missing`,
+		`{"path": "/a", "servers": [{"host": "h", "port": 65536}]}`: `option 'servers[0].port': value 65536 is out of range`,
+		`{"path": "/a", "servers": [{"host": "h", "port": -1}]}`:    `option 'servers[0].port': value -1 is out of range`,
+		`{"path": "/a", "verbose": "yes"}`:                          `option 'verbose': expected bool, got string`,
+		`{"path": "/a", "data": "AQID"}`:                            `option 'data': expected binary, got string`,
+		`{"path": "/a", "ratio": "x"}`:                              `option 'ratio': expected float, got string`,
+		`{"path": "/a", "tags": [null]}`:                            `option 'tags[0]': expected string, got nil`,
+		`{"path": "/a", "labels": {"a": 1, "b": 2}}`:                `option 'labels.a': expected string, got int`,
+	} {
+		var o options
+		err := register.DecodeOptions(context(opts), &o)
+		require.True(t, err != nil, opts)
+		require.Equal(t, msg, err.Error())
+		_, ok := err.(*hiera.OptionError)
+		require.True(t, ok)
+	}
+}
+
+func TestDecodeOptions_fieldErrors(t *testing.T) {
+	var o struct {
+		Small     int8            `hiera:"small"`
+		Durations []time.Duration `hiera:"durations"`
+	}
+	err := register.DecodeOptions(context(`{"small": 300}`), &o)
+	require.True(t, err != nil)
+	require.Equal(t, `option 'small': value 300 is out of range`, err.Error())
+
+	err = register.DecodeOptions(context(`{"durations": [null]}`), &o)
+	require.True(t, err != nil)
+	require.Equal(t, `option 'durations[0]': expected string, got nil`, err.Error())
+}
+
+func TestDecodeOptions_panics(t *testing.T) {
+	c := hiera.NewProviderContext(nil)
+	require.Panic(t, func() { _ = register.DecodeOptions(c, options{}) }, `expected a pointer to a struct`)
+	require.Panic(t, func() {
+		_ = register.DecodeOptions(c, &struct {
+			C chan int
+		}{})
+	}, `cannot hold an option`)
+	require.Panic(t, func() {
+		_ = register.DecodeOptions(c, &struct {
+			M map[int]string
+		}{})
+	}, `cannot hold an option`)
+	require.Panic(t, func() {
+		_ = register.DecodeOptions(c, &struct {
+			A string `hiera:"a,optional"`
+		}{})
+	}, `unknown hiera tag flag 'optional'`)
+	require.Panic(t, func() {
+		_ = register.DecodeOptions(c, &struct {
+			A int `hiera:"a" default:"x"`
+		}{})
+	}, `invalid default`)
+	require.Panic(t, func() {
+		_ = register.DecodeOptions(c, &struct {
+			A int `hiera:"a" default:"1.5"`
+		}{})
+	}, `invalid default`)
+}
+
+func TestWithOptionsFrom(t *testing.T) {
+	m := &register.Meta{}
+	register.WithOption(`tags`, `[]string`, `documented tags`)(m)
+	register.WithOptionsFrom(&options{})(m)
+	require.Equal(t, 13, len(m.Options))
+	require.Equal(t, register.OptionDoc{Name: `tags`, Type: `[]string`, Description: `documented tags`}, m.Options[0])
+	require.Equal(t, register.OptionDoc{Name: `path`, Type: `string`, Description: `the path`, Required: true},
+		m.Options[1])
+	require.Equal(t, []string{`token`}, m.SensitiveOptions())
+	for _, od := range m.Options {
+		// All types must be valid dgo types
+		require.NotNil(t, newtype.Parse(od.Type))
+		if od.Name == `servers` {
+			require.Equal(t, `[]{"host":string,"port"?:int}`, od.Type)
+		}
+	}
+	require.Panic(t, func() { register.WithOptionsFrom(``) }, `expected a struct`)
+}
@@ -0,0 +1,241 @@
+package register
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/hierasdk/hiera"
+)
+
+var (
+	contextType     = reflect.TypeOf((*hiera.ProviderContext)(nil)).Elem()
+	arrayType       = reflect.TypeOf((*dgo.Array)(nil)).Elem()
+	errorType       = reflect.TypeOf((*error)(nil)).Elem()
+	stringType      = reflect.TypeOf(``)
+	yieldType       = reflect.TypeOf((func(string, dgo.Value))(nil))
+	nativeYieldType = reflect.TypeOf((func(string, interface{}))(nil))
+)
+
+// typedFunction is a function that optionally receives its options decoded into a struct by DecodeOptions and that
+// may return a Go value and an error instead of a dgo.Value
+type typedFunction struct {
+	f        reflect.Value
+	options  reflect.Type
+	ptr      bool
+	hasValue bool
+	hasError bool
+}
+
+// newTypedFunction validates that the given function takes a hiera.ProviderContext, optionally followed by a struct
+// or a pointer to a struct, followed by the given arguments. The function must return a value and optionally an
+// error when hasValue is true, and optionally an error otherwise. It panics if the function doesn't comply. A
+// yieldType argument also accepts a function that yields interface{} values.
+func newTypedFunction(tp, name string, f interface{}, hasValue bool, args ...reflect.Type) *typedFunction {
+	tf := &typedFunction{f: reflect.ValueOf(f), hasValue: hasValue}
+	ft := reflect.TypeOf(f)
+	if !tf.init(ft, args) {
+		sig := `func(hiera.ProviderContext[, <options struct>]`
+		for _, a := range args {
+			sig += `, ` + a.String()
+		}
+		sig += `)`
+		if hasValue {
+			sig += ` (<value>[, error])`
+		} else {
+			sig += ` [error]`
+		}
+		panic(fmt.Errorf(`%s function '%s' must be a %s, got %T`, tp, name, sig, f))
+	}
+	if tf.options != nil {
+		// Validate the struct now rather than when the function is called
+		optionsOf(tf.options)
+	}
+	return tf
+}
+
+func (tf *typedFunction) init(ft reflect.Type, args []reflect.Type) bool {
+	if ft == nil || ft.Kind() != reflect.Func || ft.NumIn() == 0 || ft.In(0) != contextType {
+		return false
+	}
+	argStart, ok := tf.initOptions(ft, len(args))
+	if !ok {
+		return false
+	}
+	for i, a := range args {
+		at := ft.In(argStart + i)
+		if !(at == a || a == yieldType && at == nativeYieldType) {
+			return false
+		}
+	}
+	return tf.initResults(ft)
+}
+
+// initOptions recognizes the optional options parameter that follows the context. It returns the index of the first
+// of the given number of arguments that follow it and false if the function has the wrong number of parameters or
+// if the options parameter isn't a struct or a pointer to a struct.
+func (tf *typedFunction) initOptions(ft reflect.Type, nArgs int) (int, bool) {
+	switch ft.NumIn() {
+	case 1 + nArgs:
+		return 1, true
+	case 2 + nArgs:
+		ot := ft.In(1)
+		if ot.Kind() == reflect.Ptr {
+			ot = ot.Elem()
+			tf.ptr = true
+		}
+		if ot.Kind() != reflect.Struct {
+			return 0, false
+		}
+		tf.options = ot
+		return 2, true
+	}
+	return 0, false
+}
+
+// initResults recognizes the value and the optional error that the function returns
+func (tf *typedFunction) initResults(ft reflect.Type) bool {
+	nOut := ft.NumOut()
+	if nOut > 0 && ft.Out(nOut-1) == errorType {
+		tf.hasError = true
+		nOut--
+	}
+	if tf.hasValue {
+		return nOut == 1 && ft.Out(0) != errorType
+	}
+	return nOut == 0
+}
+
+// call decodes the options of the given context and calls the function with the context, the options, and the
+// given arguments. A decoding error, or an error returned by the function, is raised as a panic. The value
+// returned by the function is returned, or nil if the function doesn't return a value.
+func (tf *typedFunction) call(ctx hiera.ProviderContext, args ...reflect.Value) reflect.Value {
+	in := []reflect.Value{reflect.ValueOf(ctx)}
+	if tf.options != nil {
+		ov := reflect.New(tf.options)
+		if err := decodeStruct(``, ctx.Option, ov.Elem()); err != nil {
+			panic(err)
+		}
+		if !tf.ptr {
+			ov = ov.Elem()
+		}
+		in = append(in, ov)
+	}
+	ft := tf.f.Type()
+	for _, a := range args {
+		if a.Type() == yieldType && ft.In(len(in)) == nativeYieldType {
+			yield := a.Interface().(func(string, dgo.Value))
+			a = reflect.ValueOf(func(key string, value interface{}) { yield(key, hiera.ToData(value)) })
+		}
+		in = append(in, a)
+	}
+	out := tf.f.Call(in)
+	if tf.hasError {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			panic(err)
+		}
+	}
+	if tf.hasValue {
+		return out[0]
+	}
+	return reflect.Value{}
+}
+
+// value calls the function and converts its value to data. A nil value means that no value was found.
+func (tf *typedFunction) value(ctx hiera.ProviderContext, args ...reflect.Value) dgo.Value {
+	rv := tf.call(ctx, args...)
+	switch rv.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+		if rv.IsNil() {
+			return nil
+		}
+	}
+	return hiera.ToData(rv.Interface())
+}
+
+// metaOptions returns the given MetaOptions followed by one that documents the options of the function
+func (tf *typedFunction) metaOptions(mos []MetaOption) []MetaOption {
+	if tf.options == nil {
+		return mos
+	}
+	return append(mos[:len(mos):len(mos)], WithOptionsFrom(reflect.Zero(tf.options).Interface()))
+}
+
+// TypedDataDig registers a data_dig function of the form
+//
+//	func(ctx hiera.ProviderContext, options T, key dgo.Array) (V, error)
+//
+// where T is a struct or a pointer to a struct that the options of each call are decoded into using DecodeOptions.
+// The function isn't called when the options cannot be decoded. The options of T are documented in the metadata
+// of the function unless the given MetaOptions document them. The options argument may be omitted.
+//
+// V is any type that hiera.ToData can convert, including dgo.Value, Go structs, maps, and slices. A nil pointer,
+// map, slice, or interface means that no value was found. The error result may be omitted. A non nil error fails
+// the call in the same way as a panic does.
+func (r *Registry) TypedDataDig(name string, f interface{}, mos ...MetaOption) {
+	tf := newTypedFunction(`data_dig`, name, f, true, arrayType)
+	r.DataDig(name, func(ctx hiera.ProviderContext, key dgo.Array) dgo.Value {
+		return tf.value(ctx, reflect.ValueOf(key))
+	}, tf.metaOptions(mos)...)
+}
+
+// TypedDataHash registers a data_hash function of the form
+//
+//	func(ctx hiera.ProviderContext, options T) (V, error)
+//
+// See TypedDataDig for details.
+func (r *Registry) TypedDataHash(name string, f interface{}, mos ...MetaOption) {
+	tf := newTypedFunction(`data_hash`, name, f, true)
+	r.DataHash(name, func(ctx hiera.ProviderContext) dgo.Value {
+		return tf.value(ctx)
+	}, tf.metaOptions(mos)...)
+}
+
+// TypedStreamingDataHash registers a streaming data_hash function of the form
+//
+//	func(ctx hiera.ProviderContext, options T, yield func(key string, value dgo.Value)) error
+//
+// The yield function may also be a func(key string, value interface{}) in which case the yielded values are
+// converted using hiera.ToData. See TypedDataDig for details.
+func (r *Registry) TypedStreamingDataHash(name string, f interface{}, mos ...MetaOption) {
+	tf := newTypedFunction(`data_hash`, name, f, false, yieldType)
+	r.StreamingDataHash(name, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) {
+		tf.call(ctx, reflect.ValueOf(yield))
+	}, tf.metaOptions(mos)...)
+}
+
+// TypedLookupKey registers a lookup_key function of the form
+//
+//	func(ctx hiera.ProviderContext, options T, key string) (V, error)
+//
+// See TypedDataDig for details.
+func (r *Registry) TypedLookupKey(name string, f interface{}, mos ...MetaOption) {
+	tf := newTypedFunction(`lookup_key`, name, f, true, stringType)
+	r.LookupKey(name, func(ctx hiera.ProviderContext, key string) dgo.Value {
+		return tf.value(ctx, reflect.ValueOf(key))
+	}, tf.metaOptions(mos)...)
+}
+
+// TypedDataDig registers a typed data_dig function under the given name with the global registry. See
+// Registry.TypedDataDig for details.
+func TypedDataDig(name string, f interface{}, mos ...MetaOption) {
+	global.TypedDataDig(name, f, mos...)
+}
+
+// TypedDataHash registers a typed data_hash function under the given name with the global registry. See
+// Registry.TypedDataHash for details.
+func TypedDataHash(name string, f interface{}, mos ...MetaOption) {
+	global.TypedDataHash(name, f, mos...)
+}
+
+// TypedStreamingDataHash registers a typed streaming data_hash function under the given name with the global
+// registry. See Registry.TypedStreamingDataHash for details.
+func TypedStreamingDataHash(name string, f interface{}, mos ...MetaOption) {
+	global.TypedStreamingDataHash(name, f, mos...)
+}
+
+// TypedLookupKey registers a typed lookup_key function under the given name with the global registry. See
+// Registry.TypedLookupKey for details.
+func TypedLookupKey(name string, f interface{}, mos ...MetaOption) {
+	global.TypedLookupKey(name, f, mos...)
+}
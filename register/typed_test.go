@@ -0,0 +1,170 @@
+package register_test
+
+import (
+	"errors"
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/register"
+)
+
+type greeting struct {
+	Greeting string `hiera:"greeting" default:"hello" description:"the greeting"`
+	Name     string `hiera:"name,required"`
+}
+
+func TestTypedFunctions(t *testing.T) {
+	r := register.NewRegistry()
+	r.TypedDataDig(`dd`, func(ctx hiera.ProviderContext, o greeting, key dgo.Array) dgo.Value {
+		return vf.String(o.Greeting + ` ` + o.Name + ` ` + key.String())
+	})
+	r.TypedDataHash(`dh`, func(ctx hiera.ProviderContext, o *greeting) dgo.Value {
+		return vf.Map(o.Greeting, o.Name)
+	}, register.WithDescription(`greets`))
+	r.TypedStreamingDataHash(`sdh`, func(ctx hiera.ProviderContext, o greeting, yield func(string, dgo.Value)) {
+		yield(o.Greeting, vf.String(o.Name))
+	})
+	r.TypedLookupKey(`lk`, func(ctx hiera.ProviderContext, o greeting, key string) dgo.Value {
+		if key == `none` {
+			return nil
+		}
+		return vf.String(o.Greeting + ` ` + key)
+	})
+
+	ctx := context(`{"name": "bob"}`)
+	r.EachDataDig(func(_ string, f hiera.DataDig) {
+		require.Equal(t, `hello bob ["a"]`, f(ctx, vf.Values(`a`)))
+	})
+	r.EachDataHash(func(_ string, f hiera.DataHash) {
+		require.Equal(t, vf.Map(`hello`, `bob`), f(ctx))
+		require.Panic(t, func() { f(context(`{}`)) }, `option 'name': required option is missing`)
+	})
+	r.EachStreamingDataHash(func(_ string, f hiera.StreamingDataHash) {
+		f(context(`{"name": "bob", "greeting": "hi"}`), func(k string, v dgo.Value) {
+			require.Equal(t, `hi`, k)
+			require.Equal(t, `bob`, v)
+		})
+	})
+	r.EachLookupKey(func(_ string, f hiera.LookupKey) {
+		require.Equal(t, `hello x`, f(ctx, `x`))
+		require.True(t, f(ctx, `none`) == nil)
+	})
+
+	require.Equal(t, vf.Map(
+		`description`, `greets`,
+		`options`, vf.Map(
+			`greeting`, vf.Map(`type`, `string`, `description`, `the greeting`),
+			`name`, vf.Map(`type`, `string`, `required`, true))), r.FunctionMeta(`data_hash`, `dh`).ToMap())
+}
+
+func TestTypedFunctions_global(t *testing.T) {
+	register.Clean()
+	register.TypedDataDig(`dd`, func(ctx hiera.ProviderContext, key dgo.Array) dgo.Value { return key })
+	register.TypedDataHash(`dh`, func(ctx hiera.ProviderContext, o greeting) dgo.Value { return nil })
+	register.TypedStreamingDataHash(`sdh`, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) {
+		yield(`a`, vf.Integer(1))
+	})
+	register.TypedLookupKey(`lk`, func(ctx hiera.ProviderContext, key string) dgo.Value { return vf.String(key) })
+
+	ctx := context(`{}`)
+	register.EachDataDig(func(n string, f hiera.DataDig) {
+		require.Equal(t, `dd`, n)
+		require.Equal(t, vf.Values(`a`), f(ctx, vf.Values(`a`)))
+	})
+	var names []string
+	register.EachDataHash(func(n string, _ hiera.DataHash) { names = append(names, n) })
+	register.EachStreamingDataHash(func(n string, f hiera.StreamingDataHash) {
+		names = append(names, n)
+		f(ctx, func(k string, v dgo.Value) {
+			require.Equal(t, `a`, k)
+			require.Equal(t, 1, v)
+		})
+	})
+	register.EachLookupKey(func(n string, f hiera.LookupKey) {
+		names = append(names, n)
+		require.Equal(t, `x`, f(ctx, `x`))
+	})
+	require.Equal(t, []string{`dh`, `sdh`, `lk`}, names)
+	require.Equal(t, `string`, register.Global().FunctionMeta(`data_hash`, `dh`).ToMap().Get(`options`).(dgo.Map).
+		Get(`greeting`).(dgo.Map).Get(`type`))
+}
+
+func TestTypedFunctions_invalid(t *testing.T) {
+	r := register.NewRegistry()
+	require.Panic(t, func() {
+		r.TypedDataHash(`dh`, func(ctx hiera.ProviderContext, o greeting, x int) dgo.Value { return nil })
+	}, `data_hash function 'dh' must be a func\(hiera.ProviderContext\[, <options struct>\]\) \(<value>\[, error\]\)`)
+	require.Panic(t, func() {
+		r.TypedLookupKey(`lk`, func(ctx hiera.ProviderContext, o string, key string) dgo.Value { return nil })
+	}, `lookup_key function 'lk' must be a func\(hiera.ProviderContext\[, <options struct>\], string\)`)
+	require.Panic(t, func() {
+		r.TypedDataDig(`dd`, func(ctx hiera.ProviderContext, o greeting, key dgo.Array) {})
+	}, `must be a`)
+	require.Panic(t, func() {
+		r.TypedDataDig(`dd`, func(ctx hiera.ProviderContext, key dgo.Array) error { return nil })
+	}, `must be a`)
+	require.Panic(t, func() {
+		r.TypedStreamingDataHash(`sdh`, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) int { return 0 })
+	}, `data_hash function 'sdh' must be a `+
+		`func\(hiera.ProviderContext\[, <options struct>\], func\(string, dgo.Value\)\) \[error\]`)
+	require.Panic(t, func() { r.TypedLookupKey(`lk`, `not a function`) }, `must be a`)
+	require.Panic(t, func() {
+		r.TypedLookupKey(`lk`, func(ctx hiera.ProviderContext, key int) dgo.Value { return nil })
+	}, `must be a`)
+	require.Panic(t, func() {
+		r.TypedDataHash(`dh`, func(ctx hiera.ProviderContext, o struct{ C chan int }) dgo.Value { return nil })
+	}, `cannot hold an option`)
+	require.True(t, r.Empty())
+}
+
+type person struct {
+	Name     string   `json:"name"`
+	Nick     string   `json:"nick,omitempty"`
+	Password string   `hiera:"password,sensitive"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+func TestTypedFunctions_native(t *testing.T) {
+	r := register.NewRegistry()
+	r.TypedDataHash(`dh`, func(ctx hiera.ProviderContext) (map[string]person, error) {
+		if _, ok := ctx.StringOption(`fail`); ok {
+			return nil, errors.New(`failed`)
+		}
+		if _, ok := ctx.StringOption(`none`); ok {
+			return nil, nil
+		}
+		return map[string]person{`bob`: {Name: `Bob`, Password: `secret`}}, nil
+	})
+	r.TypedLookupKey(`lk`, func(ctx hiera.ProviderContext, key string) *person {
+		if key == `none` {
+			return nil
+		}
+		return &person{Name: key, Nick: `n`, Tags: []string{`a`}}
+	})
+	r.TypedStreamingDataHash(`sdh`, func(ctx hiera.ProviderContext, o greeting, yield func(string, interface{})) error {
+		yield(`p`, person{Name: o.Name})
+		return errors.New(`stream failed`)
+	})
+
+	ctx := context(`{"name": "bob"}`)
+	r.EachDataHash(func(_ string, f hiera.DataHash) {
+		require.Equal(t, vf.Map(`bob`, vf.Map(`name`, `Bob`, `password`, vf.Sensitive(`secret`))), f(ctx))
+		require.True(t, f(context(`{"none": "x"}`)) == nil)
+		require.Panic(t, func() { f(context(`{"fail": "x"}`)) }, `failed`)
+	})
+	r.EachLookupKey(func(_ string, f hiera.LookupKey) {
+		require.Equal(t, vf.Map(`name`, `x`, `nick`, `n`, `password`, vf.Sensitive(``), `tags`, vf.Values(`a`)), f(ctx, `x`))
+		require.True(t, f(ctx, `none`) == nil)
+	})
+	r.EachStreamingDataHash(func(_ string, f hiera.StreamingDataHash) {
+		var entries []dgo.Value
+		require.Panic(t, func() {
+			f(ctx, func(k string, v dgo.Value) { entries = append(entries, vf.String(k), v) })
+		}, `stream failed`)
+		require.Equal(t, vf.Values(`p`, vf.Map(`name`, `bob`, `password`, vf.Sensitive(``))), vf.Array(entries))
+	})
+}
@@ -0,0 +1,65 @@
+// Package richjson implements a JSON encoding of dgo values that preserves the values that plain JSON cannot
+// represent. Such values are encoded as a JSON object with a "__type" and a "__value" key using the dialect of the
+// dgo streamer package, e.g. a binary value is encoded as
+//
+//	{"__type":"binary","__value":"AQID"}
+//
+// The encoding preserves floats with integral values, binary values, timestamps, sensitive values, dgo types, and
+// maps with keys that are not strings. A map that is encoded as plain JSON must not have a "__type" key.
+package richjson
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/streamer"
+	"github.com/lyraproj/dgo/vf"
+)
+
+// ContentType is the media type of rich JSON encoded data
+const ContentType = `application/vnd.dgo.rich+json`
+
+func options() *streamer.Options {
+	return &streamer.Options{Dialect: streamer.DgoDialect(), RichData: true, DedupLevel: streamer.NoDedup}
+}
+
+// Marshal returns the rich JSON encoding of the given value
+func Marshal(v dgo.Value) (bs []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = toError(r)
+		}
+	}()
+	var b bytes.Buffer
+	streamer.New(nil, options()).Stream(v, &jsonWriter{b: &b})
+	return b.Bytes(), nil
+}
+
+// Unmarshal decodes the given rich JSON encoded data
+func Unmarshal(data []byte) (v dgo.Value, err error) {
+	if v, err = vf.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			v = nil
+			err = toError(r)
+		}
+	}()
+	d := streamer.DataDecoder(nil, nil)
+	streamer.New(nil, options()).Stream(v, d)
+	return d.Value(), nil
+}
+
+func toError(r interface{}) error {
+	switch r := r.(type) {
+	case error:
+		return r
+	case string:
+		return errors.New(r)
+	default:
+		return fmt.Errorf(`%v`, r)
+	}
+}
@@ -0,0 +1,27 @@
+package richjson
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+)
+
+func TestToError(t *testing.T) {
+	err := errors.New(`boom`)
+	require.Same(t, err, toError(err))
+	require.Equal(t, `boom`, toError(`boom`).Error())
+	require.Equal(t, `42`, toError(42).Error())
+}
+
+// The streamer never produces references since dedup is disabled, but the writer must still be a valid consumer
+func TestJSONWriter_AddRef(t *testing.T) {
+	var b bytes.Buffer
+	w := &jsonWriter{b: &b}
+	w.AddArray(2, func() {
+		w.AddRef(0)
+		w.AddRef(1)
+	})
+	require.Equal(t, `[{"__ref":0},{"__ref":1}]`, b.String())
+}
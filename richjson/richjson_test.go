@@ -0,0 +1,53 @@
+package richjson_test
+
+import (
+	"testing"
+	"time"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/typ"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/richjson"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ts := time.Date(2020, 3, 4, 5, 6, 7, 890123456, time.FixedZone(``, 3600))
+	for _, v := range []dgo.Value{
+		vf.Nil,
+		vf.True,
+		vf.Integer(42),
+		vf.Float(42),
+		vf.Float(1e100),
+		vf.String(`text`),
+		vf.Binary([]byte{0, 1, 2, 255}, true),
+		vf.Time(ts),
+		vf.Sensitive(`secret`),
+		typ.String,
+		vf.Values(1, `two`, vf.Values()),
+		vf.Map(`a`, 1, 2, `b`, `c`, vf.Sensitive(vf.Values(`x`, vf.Binary([]byte{1}, true)))),
+		vf.Map(1, vf.Binary([]byte{1}, true), `x`, vf.Map(`y`, vf.Values(1, 2.5)), `z`, nil),
+	} {
+		bs, err := richjson.Marshal(v)
+		require.Nil(t, err)
+		r, err := richjson.Unmarshal(bs)
+		require.Nil(t, err)
+		require.Equal(t, v, r)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	bs, err := richjson.Marshal(vf.Map(`b`, vf.Binary([]byte{1, 2, 3}, true), `s`, vf.Sensitive(`x`)))
+	require.Nil(t, err)
+	require.Equal(t, `{"b":{"__type":"binary","__value":"AQID"},"s":{"__type":"sensitive","__value":"x"}}`, string(bs))
+}
+
+func TestUnmarshal_errors(t *testing.T) {
+	_, err := richjson.Unmarshal([]byte(`{"__type":"time","__value":"yesterday"}`))
+	require.NotNil(t, err)
+	_, err = richjson.Unmarshal([]byte(`{"__type":"unknown","__value":1}`))
+	require.Equal(t, `unable to decode __type: unknown`, err.Error())
+	_, err = richjson.Unmarshal([]byte(`{`))
+	require.NotNil(t, err)
+}
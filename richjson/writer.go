@@ -0,0 +1,101 @@
+package richjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/streamer"
+)
+
+// jsonWriter is a streamer.Consumer that writes JSON. It is used instead of streamer.JSON because that consumer
+// emits the wrong delimiter after a container that is nested in a map that is encoded as an array.
+type jsonWriter struct {
+	b      *bytes.Buffer
+	frames []frame
+}
+
+// frame tracks the number of values written to a container
+type frame struct {
+	isMap bool
+	count int
+}
+
+func (j *jsonWriter) CanDoBinary() bool {
+	return false
+}
+
+func (j *jsonWriter) CanDoTime() bool {
+	return false
+}
+
+func (j *jsonWriter) CanDoComplexKeys() bool {
+	return false
+}
+
+func (j *jsonWriter) StringDedupThreshold() int {
+	return 0
+}
+
+func (j *jsonWriter) AddArray(_ int, doer dgo.Doer) {
+	j.container('[', ']', false, doer)
+}
+
+func (j *jsonWriter) AddMap(_ int, doer dgo.Doer) {
+	j.container('{', '}', true, doer)
+}
+
+func (j *jsonWriter) Add(element dgo.Value) {
+	j.delimit()
+	var v interface{}
+	switch e := element.(type) {
+	case dgo.String:
+		v = e.GoString()
+	case dgo.Float:
+		v = e.GoFloat()
+	case dgo.Integer:
+		v = e.GoInt()
+	case dgo.Boolean:
+		v = e.GoBool()
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	if _, ok := v.(float64); ok && !bytes.ContainsAny(bs, `.eE`) {
+		// Retain the distinction between floats and integers
+		bs = append(bs, '.', '0')
+	}
+	j.b.Write(bs)
+}
+
+func (j *jsonWriter) AddRef(ref int) {
+	j.delimit()
+	_, _ = fmt.Fprintf(j.b, `{"%s":%d}`, streamer.DgoDialect().RefKey(), ref)
+}
+
+func (j *jsonWriter) container(start, end byte, isMap bool, doer dgo.Doer) {
+	j.delimit()
+	j.b.WriteByte(start)
+	j.frames = append(j.frames, frame{isMap: isMap})
+	doer()
+	j.frames = j.frames[:len(j.frames)-1]
+	j.b.WriteByte(end)
+}
+
+// delimit writes the delimiter that must precede the next value of the current container
+func (j *jsonWriter) delimit() {
+	if len(j.frames) == 0 {
+		return
+	}
+	f := &j.frames[len(j.frames)-1]
+	if f.count > 0 {
+		if f.isMap && f.count%2 == 1 {
+			j.b.WriteByte(':')
+		} else {
+			j.b.WriteByte(',')
+		}
+	}
+	f.count++
+}
@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+)
+
+// CompressThreshold is the minimum size in bytes of a response body that is compressed. Smaller bodies are sent
+// as is since compressing them gains little.
+const CompressThreshold = 1024
+
+// compressWriter is an http.ResponseWriter that compresses the response body using the encoding that was
+// negotiated with the client. The body is buffered until it reaches the CompressThreshold so that small bodies can
+// be sent uncompressed. The close method must be called when the response is complete.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	cw       io.WriteCloser
+	sent     bool
+	closed   bool
+}
+
+// compress returns a compressWriter that uses the best encoding that the given request accepts
+func compress(w http.ResponseWriter, r *http.Request) *compressWriter {
+	w.Header().Add(`Vary`, `Accept-Encoding`)
+	return &compressWriter{ResponseWriter: w, encoding: negotiateEncoding(r.Header.Get(`Accept-Encoding`))}
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *compressWriter) Write(bs []byte) (int, error) {
+	if c.cw != nil {
+		return c.cw.Write(bs)
+	}
+	if c.encoding == `` || c.sent {
+		c.sendHeader()
+		return c.ResponseWriter.Write(bs)
+	}
+	c.buf = append(c.buf, bs...)
+	if len(c.buf) >= CompressThreshold {
+		if err := c.startCompression(); err != nil {
+			return 0, err
+		}
+	}
+	return len(bs), nil
+}
+
+func (c *compressWriter) startCompression() error {
+	h := c.Header()
+	h.Set(`Content-Encoding`, c.encoding)
+	h.Del(`Content-Length`)
+	c.sendHeader()
+	if c.encoding == `gzip` {
+		c.cw = gzip.NewWriter(c.ResponseWriter)
+	} else {
+		c.cw = zlib.NewWriter(c.ResponseWriter)
+	}
+	buf := c.buf
+	c.buf = nil
+	_, err := c.cw.Write(buf)
+	return err
+}
+
+func (c *compressWriter) sendHeader() {
+	if !c.sent {
+		c.sent = true
+		if c.status != 0 {
+			c.ResponseWriter.WriteHeader(c.status)
+		}
+	}
+}
+
+// close completes the response by flushing the compressor or, if the body never reached the CompressThreshold,
+// by sending the buffered body uncompressed. Calls after the first have no effect.
+func (c *compressWriter) close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.cw != nil {
+		return c.cw.Close()
+	}
+	c.sendHeader()
+	if len(c.buf) > 0 {
+		buf := c.buf
+		c.buf = nil
+		_, err := c.ResponseWriter.Write(buf)
+		return err
+	}
+	return nil
+}
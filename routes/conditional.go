@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/lyraproj/hierasdk/hiera"
+)
+
+// newContext returns a ProviderContext for the given request that sends change notifications to the given
+// Notifier. The SetVersion method of the context reports that the host has the value when the ETag of the version
+// matches the If-None-Match header of the request.
+func newContext(r *http.Request, q url.Values, contentType string, n hiera.Notifier) hiera.ProviderContext {
+	opts := []hiera.ContextOption{hiera.WithNotifier(n)}
+	if inm := r.Header.Get(`If-None-Match`); inm != `` {
+		opts = append(opts, hiera.WithVersionCheck(func(version string) bool {
+			return etagMatches(inm, etag(version, contentType))
+		}))
+	}
+	return hiera.NewProviderContext(q, opts...)
+}
+
+// checkVersion sets the ETag header when the function has declared a version and returns true if the response
+// should be 304 Not Modified.
+func checkVersion(w http.ResponseWriter, r *http.Request, ctx hiera.ProviderContext, contentType string) bool {
+	v := ctx.Version()
+	if v == `` {
+		return false
+	}
+	et := etag(v, contentType)
+	w.Header().Set(`ETag`, et)
+	return etagMatches(r.Header.Get(`If-None-Match`), et)
+}
+
+// etag returns the weak ETag for the given version of a value that is encoded using the given content type. The
+// ETag is weak since the encoded value may be compressed.
+func etag(version, contentType string) string {
+	h := sha256.Sum256([]byte(contentType + "\x00" + version))
+	return `W/"` + hex.EncodeToString(h[:16]) + `"`
+}
+
+// etagMatches returns true if the given If-None-Match header value matches the given ETag using weak comparison
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == `` {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, `W/`)
+	for _, t := range strings.Split(ifNoneMatch, `,`) {
+		t = strings.TrimSpace(t)
+		if t == `*` || strings.TrimPrefix(t, `W/`) == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lyraproj/hierasdk/events"
+)
+
+// KeepAliveInterval is the interval at which a comment is sent on an idle "/events" stream so that intermediaries
+// don't close the connection.
+const KeepAliveInterval = 30 * time.Second
+
+// notifier publishes the change notifications of one function to the global events.Broker
+type notifier struct {
+	event events.Event
+}
+
+func newNotifier(kind, name string) *notifier {
+	return &notifier{event: events.Event{Kind: kind, Function: name}}
+}
+
+func (n *notifier) WatchFile(path string) {
+	events.WatchFile(path, n.event)
+}
+
+func (n *notifier) Invalidate(reason string) {
+	e := n.event
+	e.Reason = reason
+	events.Publish(e)
+}
+
+// handleEvents serves the events of the given Broker as server-sent events. Each event is sent with the event type
+// "invalidate" and the JSON representation of the events.Event as its data. The stream ends when the client goes
+// away or when the Broker ends the subscription. A comment is sent when no event has been sent for the given
+// keep-alive interval.
+func handleEvents(w http.ResponseWriter, r *http.Request, b *events.Broker, keepAliveInterval time.Duration) {
+	if r.Method != http.MethodGet {
+		http.Error(w, ``, http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `streaming is not supported`, http.StatusInternalServerError)
+		return
+	}
+	ch, cancel := b.Subscribe()
+	defer cancel()
+
+	h := w.Header()
+	h.Set(`Content-Type`, `text/event-stream`)
+	h.Set(`Cache-Control`, `no-cache`)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(e)
+			if _, err := fmt.Fprintf(w, "event: invalidate\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
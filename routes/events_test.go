@@ -0,0 +1,106 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	require "github.com/lyraproj/dgo/dgo_test"
+
+	"github.com/lyraproj/hierasdk/events"
+)
+
+// flushRecorder is a ResponseRecorder that sends the body written so far on a channel each time it is flushed
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed chan string
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushed <- r.Body.String()
+}
+
+// noFlusher is an http.ResponseWriter that isn't an http.Flusher
+type noFlusher struct {
+	http.ResponseWriter
+}
+
+func TestNotifier(t *testing.T) {
+	ch, cancel := events.Global().Subscribe()
+	defer cancel()
+	newNotifier(`data_hash`, `my_dh`).Invalidate(`changed`)
+	require.Equal(t, events.Event{Kind: `data_hash`, Function: `my_dh`, Reason: `changed`}, <-ch)
+}
+
+func TestHandleEvents(t *testing.T) {
+	b := events.NewBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	rr := &flushRecorder{ResponseRecorder: httptest.NewRecorder(), flushed: make(chan string)}
+	done := make(chan bool)
+	go func() {
+		handleEvents(rr, httptest.NewRequest(http.MethodGet, `/events`, nil).WithContext(ctx), b, 10*time.Millisecond)
+		close(done)
+	}()
+	require.Equal(t, ``, <-rr.flushed)
+	require.Equal(t, ": keep-alive\n\n", <-rr.flushed)
+	b.Publish(events.Event{Function: `my_dh`})
+	for body := ``; !strings.Contains(body, "event: invalidate\ndata: {\"function\":\"my_dh\"}\n\n"); {
+		body = <-rr.flushed
+	}
+	cancel()
+	for running := true; running; {
+		select {
+		case <-rr.flushed:
+		case <-done:
+			running = false
+		}
+	}
+	require.Equal(t, `text/event-stream`, rr.Header().Get(`Content-Type`))
+}
+
+func TestHandleEvents_closed(t *testing.T) {
+	b := events.NewBroker()
+	b.Close()
+	rr := &flushRecorder{ResponseRecorder: httptest.NewRecorder(), flushed: make(chan string, 1)}
+	handleEvents(rr, httptest.NewRequest(http.MethodGet, `/events`, nil), b, time.Minute)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, ``, rr.Body.String())
+}
+
+func TestHandleEvents_writeErrors(t *testing.T) {
+	b := events.NewBroker()
+	fw := &failingWriter{ResponseRecorder: httptest.NewRecorder()}
+	handleEvents(fw, httptest.NewRequest(http.MethodGet, `/events`, nil), b, 10*time.Millisecond)
+	require.Equal(t, []string{": keep-alive\n\n"}, fw.writes)
+
+	done := make(chan bool)
+	fw = &failingWriter{ResponseRecorder: httptest.NewRecorder()}
+	go func() {
+		handleEvents(fw, httptest.NewRequest(http.MethodGet, `/events`, nil), b, time.Minute)
+		close(done)
+	}()
+	// The event is published until the subscription is established
+	for published := false; !published; {
+		b.Publish(events.Event{Function: `my_dh`})
+		select {
+		case <-done:
+			published = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	require.Equal(t, "event: invalidate\ndata: {\"function\":\"my_dh\"}\n\n", fw.writes[0])
+}
+
+func TestHandleEvents_badRequests(t *testing.T) {
+	rr := httptest.NewRecorder()
+	handleEvents(rr, httptest.NewRequest(http.MethodPost, `/events`, nil), events.NewBroker(), time.Minute)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handleEvents(noFlusher{rr}, httptest.NewRequest(http.MethodGet, `/events`, nil), events.NewBroker(), time.Minute)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.Equal(t, "streaming is not supported\n", rr.Body.String())
+}
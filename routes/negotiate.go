@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lyraproj/hierasdk/cbor"
+	"github.com/lyraproj/hierasdk/richjson"
+)
+
+const jsonContentType = `application/json`
+
+// negotiateEncoding returns "gzip" or "deflate" depending on what the given Accept-Encoding header value accepts,
+// or an empty string when the client doesn't accept any of them. gzip is preferred when both have the same
+// quality.
+func negotiateEncoding(acceptEncoding string) string {
+	return negotiate(acceptEncoding, ``, `gzip`, `deflate`)
+}
+
+// negotiateContentType returns the content type to use for the response to a request with the given Accept header
+// value. It returns cbor.ContentType, richjson.ContentType, or "application/json". JSON is used unless another
+// content type is accepted with a higher quality, or with the same quality but more specifically than JSON.
+func negotiateContentType(accept string) string {
+	if accept == `` {
+		return jsonContentType
+	}
+	if ct := negotiate(accept, `application/*`, jsonContentType, cbor.ContentType, richjson.ContentType); ct != `` {
+		return ct
+	}
+	return jsonContentType
+}
+
+// negotiate returns the one of the offered values that the given header value accepts with the highest quality,
+// or an empty string if no offered value is accepted. The given wildcard, and "*" or "*/*", match any value but
+// a value that is named explicitly takes precedence. Ties are resolved in favor of the value that is offered first.
+func negotiate(header, wildcard string, offers ...string) string {
+	best := ``
+	bestQ := 0.0
+	bestExplicit := false
+	for _, offer := range offers {
+		q, explicit := quality(header, wildcard, offer)
+		if q > bestQ || q == bestQ && q > 0 && explicit && !bestExplicit {
+			best, bestQ, bestExplicit = offer, q, explicit
+		}
+	}
+	return best
+}
+
+// quality returns the quality with which the given header value accepts the given value and whether that quality
+// comes from an explicit mention of the value rather than from a wildcard.
+func quality(header, wildcard, value string) (float64, bool) {
+	q := 0.0
+	for _, part := range strings.Split(header, `,`) {
+		params := strings.Split(part, `;`)
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		pq := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, `q=`) {
+				if f, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					pq = f
+				}
+			}
+		}
+		switch {
+		case name == value:
+			return pq, true
+		case name == `*` || name == `*/*` || wildcard != `` && name == wildcard:
+			if pq > q {
+				q = pq
+			}
+		}
+	}
+	return q, false
+}
@@ -8,33 +8,38 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 
 	"github.com/lyraproj/dgo/dgo"
 	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/cbor"
+	"github.com/lyraproj/hierasdk/events"
 	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/hierakey"
 	"github.com/lyraproj/hierasdk/register"
+	"github.com/lyraproj/hierasdk/richjson"
 )
 
-func callDataDig(q url.Values, f interface{}) dgo.Value {
+// callDataDig calls the data_dig function with the segments of the key parameter, which is either a JSON array of
+// segments or a dotted Hiera key, see hierakey.Parse
+func callDataDig(ctx hiera.ProviderContext, q url.Values, f interface{}) dgo.Value {
 	if k := q.Get(`key`); k != `` {
-		v, err := vf.UnmarshalJSON([]byte(k))
+		key, err := hierakey.Parse(k)
 		if err != nil {
 			panic(err)
 		}
-		if key, ok := v.(dgo.Array); ok {
-			return f.(hiera.DataDig)(hiera.NewProviderContext(q), key)
-		}
+		return f.(hiera.DataDig)(ctx, key)
 	}
 	return nil
 }
 
-func callDataHash(q url.Values, f interface{}) dgo.Value {
-	return f.(hiera.DataHash)(hiera.NewProviderContext(q))
+func callDataHash(ctx hiera.ProviderContext, _ url.Values, f interface{}) dgo.Value {
+	return f.(hiera.DataHash)(ctx)
 }
 
-func callLookupKey(q url.Values, f interface{}) dgo.Value {
+func callLookupKey(ctx hiera.ProviderContext, q url.Values, f interface{}) dgo.Value {
 	if key := q.Get(`key`); key != `` {
-		return f.(hiera.LookupKey)(hiera.NewProviderContext(q), key)
+		return f.(hiera.LookupKey)(ctx, key)
 	}
 	return nil
 }
@@ -55,34 +60,109 @@ func catch(f func() error) (err error) {
 	return
 }
 
-func handleLookup(w http.ResponseWriter, r *http.Request, f func(url.Values, interface{}) dgo.Value, luFunc interface{}) {
+// errorStatus returns the HTTP status of the response to a function call that failed with the given error
+func errorStatus(err error) int {
+	var oe *hiera.OptionError
+	var se *hierakey.SyntaxError
+	if errors.As(err, &oe) || errors.As(err, &se) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func handleLookup(w http.ResponseWriter, r *http.Request,
+	f func(hiera.ProviderContext, url.Values, interface{}) dgo.Value, luFunc interface{}, sensitiveOptions []string,
+	n hiera.Notifier) {
 	if r.Method != http.MethodGet {
 		http.Error(w, ``, http.StatusMethodNotAllowed)
 		return
 	}
 	q := r.URL.Query()
+	cw := compress(w, r)
 	err := catch(func() error {
-		if r := f(q, luFunc); r != nil {
-			return sendData(w, r)
+		ct := negotiateContentType(r.Header.Get(`Accept`))
+		ctx := newContext(r, q, ct, n)
+		v := f(ctx, q, luFunc)
+		if checkVersion(w, r, ctx, ct) {
+			cw.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+		if v != nil {
+			return sendData(cw, r, v)
 		}
-		http.Error(w, `404 value not found`, http.StatusNotFound)
+		http.Error(cw, `404 value not found`, http.StatusNotFound)
 		return nil
 	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(cw, redact(err.Error(), q, sensitiveOptions), errorStatus(err))
+	}
+	_ = cw.close()
+}
+
+func sendData(w http.ResponseWriter, r *http.Request, d dgo.Value) error {
+	ud, sensitive := plainData(d)
+	ct := negotiateContentType(r.Header.Get(`Accept`))
+	var bs []byte
+	var err error
+	switch ct {
+	case cbor.ContentType:
+		// CBOR and rich JSON retain the sensitive values so they are flagged in the header for consistency only
+		bs, err = cbor.Marshal(d)
+	case richjson.ContentType:
+		bs, err = richjson.Marshal(d)
+	default:
+		bs, err = json.Marshal(ud)
+	}
+	if err != nil {
+		return err
+	}
+	if ct != cbor.ContentType {
+		bs = append(bs, '\n')
 	}
+	flagSensitive(w.Header(), sensitive)
+	w.Header().Set("Content-Type", ct)
+	_, err = w.Write(bs)
+	return err
 }
 
-func sendData(w http.ResponseWriter, d dgo.Value) error {
-	w.Header().Set("Content-Type", "application/json")
-	return json.NewEncoder(w).Encode(d)
+func sensitiveOptions(reg *register.Registry, tp, name string) []string {
+	if m := reg.FunctionMeta(tp, name); m != nil {
+		return m.SensitiveOptions()
+	}
+	return nil
 }
 
 // Register create a http.ServeMux and add handlers to it for all lookup functions that has been registered with
 // register.DataDig, register.DataHash, and register.LookupKey. The created ServeMux is returned along with a
 // Map keyed by function type where each value is a Slice of function names.
+//
+// The ServeMux also serves the path "/meta" which responds with a Map containing the "functions" Map and, when
+// functions have been registered with metadata, a "meta" Map with the metadata of each function.
+//
+// The values of options that are registered as sensitive are redacted from error messages. Values that a function
+// wraps using vf.Sensitive are unwrapped in the response and flagged using the hiera.SensitiveHeader. A function
+// that fails with a *hiera.OptionError, e.g. because its options cannot be decoded, gets a 400 Bad Request response.
+//
+// Responses are encoded as JSON unless the Accept header of the request prefers cbor.ContentType or
+// richjson.ContentType. CBOR preserves the distinction between integers and floats, binary values, timestamps, and
+// sensitive values. Rich JSON preserves binary values, timestamps, sensitive values, and dgo types.
+//
+// A function that declares the version of its value using ProviderContext.SetVersion gets an ETag header in its
+// response. A request with an If-None-Match header that matches the ETag gets a 304 Not Modified response.
+//
+// The ServeMux serves the change notifications that functions publish using ProviderContext.WatchFile and
+// ProviderContext.Invalidate, and that the plugin publishes using the events package, as server-sent events on the
+// path "/events".
+//
+// Response bodies of at least CompressThreshold bytes are compressed using gzip or deflate when the request
+// accepts one of them in its Accept-Encoding header.
 func Register() (http.Handler, dgo.Map) {
-	if register.Empty() {
+	return RegisterWith(register.Global())
+}
+
+// RegisterWith is like Register but uses the functions of the given registry instead of the global registry.
+func RegisterWith(reg *register.Registry) (http.Handler, dgo.Map) {
+	if reg.Empty() {
 		panic(errors.New(`no lookup functions have been registered`))
 	}
 
@@ -92,22 +172,32 @@ func Register() (http.Handler, dgo.Map) {
 	var dataHashNames []dgo.Value
 	var lookupKeyNames []dgo.Value
 
-	register.EachDataDig(func(name string, f hiera.DataDig) {
+	reg.EachDataDig(func(name string, f hiera.DataDig) {
 		dataDigNames = append(dataDigNames, vf.String(name))
+		n := newNotifier(`data_dig`, name)
 		router.HandleFunc(`/data_dig/`+name, func(w http.ResponseWriter, r *http.Request) {
-			handleLookup(w, r, callDataDig, f)
+			handleLookup(w, r, callDataDig, f, sensitiveOptions(reg, `data_dig`, name), n)
+		})
+	})
+	reg.EachDataHash(func(name string, f hiera.DataHash) {
+		dataHashNames = append(dataHashNames, vf.String(name))
+		n := newNotifier(`data_hash`, name)
+		router.HandleFunc(`/data_hash/`+name, func(w http.ResponseWriter, r *http.Request) {
+			handleLookup(w, r, callDataHash, f, sensitiveOptions(reg, `data_hash`, name), n)
 		})
 	})
-	register.EachDataHash(func(name string, f hiera.DataHash) {
+	reg.EachStreamingDataHash(func(name string, f hiera.StreamingDataHash) {
 		dataHashNames = append(dataHashNames, vf.String(name))
+		n := newNotifier(`data_hash`, name)
 		router.HandleFunc(`/data_hash/`+name, func(w http.ResponseWriter, r *http.Request) {
-			handleLookup(w, r, callDataHash, f)
+			handleStream(w, r, f, sensitiveOptions(reg, `data_hash`, name), n)
 		})
 	})
-	register.EachLookupKey(func(name string, f hiera.LookupKey) {
+	reg.EachLookupKey(func(name string, f hiera.LookupKey) {
 		lookupKeyNames = append(lookupKeyNames, vf.String(name))
+		n := newNotifier(`lookup_key`, name)
 		router.HandleFunc(`/lookup_key/`+name, func(w http.ResponseWriter, r *http.Request) {
-			handleLookup(w, r, callLookupKey, f)
+			handleLookup(w, r, callLookupKey, f, sensitiveOptions(reg, `lookup_key`, name), n)
 		})
 	})
 	m := vf.MutableMap(nil)
@@ -115,10 +205,30 @@ func Register() (http.Handler, dgo.Map) {
 		m.Put(`data_dig`, vf.Array(dataDigNames))
 	}
 	if len(dataHashNames) > 0 {
+		sort.Slice(dataHashNames, func(i, j int) bool { return dataHashNames[i].String() < dataHashNames[j].String() })
 		m.Put(`data_hash`, vf.Array(dataHashNames))
 	}
 	if len(lookupKeyNames) > 0 {
 		m.Put(`lookup_key`, vf.Array(lookupKeyNames))
 	}
+	meta := vf.MutableMap(nil)
+	meta.Put(`functions`, m)
+	if md := reg.Metadata(); md.Len() > 0 {
+		meta.Put(`meta`, md)
+	}
+	router.HandleFunc(`/meta`, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, ``, http.StatusMethodNotAllowed)
+			return
+		}
+		cw := compress(w, r)
+		if err := sendData(cw, r, meta); err != nil {
+			http.Error(cw, err.Error(), http.StatusInternalServerError)
+		}
+		_ = cw.close()
+	})
+	router.HandleFunc(`/events`, func(w http.ResponseWriter, r *http.Request) {
+		handleEvents(w, r, events.Global(), KeepAliveInterval)
+	})
 	return router, m
 }
@@ -1,17 +1,26 @@
 package routes
 
 import (
+	"compress/gzip"
+	"compress/zlib"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/lyraproj/dgo/dgo"
 	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/cbor"
 	"github.com/lyraproj/hierasdk/hiera"
 	"github.com/lyraproj/hierasdk/register"
+	"github.com/lyraproj/hierasdk/richjson"
 )
 
 func TestNoHandler(t *testing.T) {
@@ -37,6 +46,43 @@ func TestMetaHandler(t *testing.T) {
 	}
 }
 
+func TestMetaHandler_metadata(t *testing.T) {
+	register.Clean()
+	register.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value { return nil },
+		register.WithDescription(`my data hash`))
+	register.LookupKey(`my_lk`, func(ctx hiera.ProviderContext, key string) dgo.Value { return nil })
+	testRequestResponse(t, "/meta", nil, http.StatusOK,
+		`{"functions":{"data_hash":["my_dh"],"lookup_key":["my_lk"]},"meta":{"data_hash":{"my_dh":{"description":"my data hash"}}}}`)
+}
+
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	writes []string
+}
+
+func (w *failingWriter) Write(bs []byte) (int, error) {
+	w.writes = append(w.writes, string(bs))
+	return 0, errors.New(`write failed`)
+}
+
+func TestMetaHandler_errors(t *testing.T) {
+	register.Clean()
+	register.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value { return nil })
+	handler, _ := Register()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, `/meta`, nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+
+	fw := &failingWriter{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(fw, httptest.NewRequest(http.MethodGet, `/meta`, nil))
+	if len(fw.writes) != 2 || fw.writes[1] != "write failed\n" {
+		t.Errorf(`expected the write error to be sent, got %q`, fw.writes)
+	}
+}
+
 func TestDataDigHandler(t *testing.T) {
 	register.Clean()
 	register.DataDig(`my_dd`, func(ctx hiera.ProviderContext, key dgo.Array) dgo.Value {
@@ -46,8 +92,14 @@ func TestDataDigHandler(t *testing.T) {
 		return nil
 	})
 	testRequestResponse(t, "/data_dig/my_dd", url.Values{`key`: {`["config", "path"]`}}, http.StatusOK, `"/a/b"`)
+	testRequestResponse(t, "/data_dig/my_dd", url.Values{`key`: {`config.path`}}, http.StatusOK, `"/a/b"`)
+	testRequestResponse(t, "/data_dig/my_dd", url.Values{`key`: {`"config".'path'`}}, http.StatusOK, `"/a/b"`)
 	testRequestResponse(t, "/data_dig/my_dd", url.Values{`key`: {`"config"`}}, http.StatusNotFound, `404 value not found`)
-	testRequestResponse(t, "/data_dig/my_dd", url.Values{`key`: {`["config", "path"`}}, http.StatusInternalServerError, `EOF`)
+	testRequestResponse(t, "/data_dig/my_dd", nil, http.StatusNotFound, `404 value not found`)
+	testRequestResponse(t, "/data_dig/my_dd", url.Values{`key`: {`["config", "path"`}}, http.StatusBadRequest,
+		`invalid key "[\"config\", \"path\"": EOF`)
+	testRequestResponse(t, "/data_dig/my_dd", url.Values{`key`: {`config..path`}}, http.StatusBadRequest,
+		`invalid key "config..path": empty segment at offset 7`)
 	testRequestResponse(t, "/data_dig/my_rd", nil, http.StatusNotFound, `404 page not found`)
 }
 
@@ -104,6 +156,511 @@ func TestDataHashHandler_panic(t *testing.T) {
 	testRequestResponse(t, "/data_hash/my_dh_int_panic", nil, http.StatusInternalServerError, `error 44`)
 }
 
+func TestDataHashHandler_sensitiveOptions(t *testing.T) {
+	register.Clean()
+	register.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		panic(fmt.Errorf(`login with %s and %s failed with status 401, %s`,
+			ctx.Option(`token`), ctx.Option(`auth`), ctx.Option(`user`)))
+	}, register.WithSensitiveOption(`token`, `string`, ``), register.WithSensitiveOption(`auth`, `map`, ``))
+	testRequestResponse(t, "/data_hash/my_dh",
+		url.Values{`options`: {`{"token":"xyz","auth":{"password":"abc","pin":401},"user":"bob"}`}},
+		http.StatusInternalServerError,
+		`login with [REDACTED] and {"password":"[REDACTED]","pin":401} failed with status 401, bob`)
+	testRequestResponse(t, "/data_hash/my_dh",
+		url.Values{`options`: {`{"token":["xyz","abc"],"auth":"pw","user":"bob"}`}},
+		http.StatusInternalServerError,
+		`login with ["[REDACTED]","[REDACTED]"] and [REDACTED] failed with status 401, bob`)
+	testRequestResponse(t, "/data_hash/my_dh", url.Values{`options`: {`{"token":"xyz"`}},
+		http.StatusInternalServerError, `EOF`)
+}
+
+func TestDataHashHandler_typed(t *testing.T) {
+	register.Clean()
+	register.TypedDataHash(`my_dh`, func(ctx hiera.ProviderContext, o struct {
+		Port  int    `hiera:"port,required"`
+		Token string `hiera:"token,sensitive"`
+	}) dgo.Value {
+		return vf.Map(`port`, o.Port)
+	})
+	testRequestResponse(t, "/data_hash/my_dh", url.Values{`options`: {`{"port":8080}`}}, http.StatusOK, `{"port":8080}`)
+	testRequestResponse(t, "/data_hash/my_dh", url.Values{`options`: {`{"token":"xyz"}`}},
+		http.StatusBadRequest, `option 'port': required option is missing`)
+	testRequestResponse(t, "/data_hash/my_dh", url.Values{`options`: {`{"port":"8080","token":"xyz"}`}},
+		http.StatusBadRequest, `option 'port': expected int, got string`)
+	testRequestResponse(t, "/meta", nil, http.StatusOK, `{"functions":{"data_hash":["my_dh"]},"meta":{"data_hash":`+
+		`{"my_dh":{"options":{"port":{"type":"int","required":true},"token":{"type":"string","sensitive":true}}}}}}`)
+}
+
+func TestLookupKeyHandler_native(t *testing.T) {
+	type host struct {
+		Name     string `json:"name"`
+		Port     int    `json:"port,omitempty"`
+		Password string `hiera:"password,sensitive"`
+	}
+	register.Clean()
+	register.TypedLookupKey(`my_lk`, func(ctx hiera.ProviderContext, key string) (*host, error) {
+		switch key {
+		case `db`:
+			return &host{Name: `db.example.com`, Password: `x`}, nil
+		case `broken`:
+			return nil, errors.New(`broken host`)
+		}
+		return nil, nil
+	})
+	testRequestResponse(t, "/lookup_key/my_lk", url.Values{`key`: {`db`}}, http.StatusOK,
+		`{"name":"db.example.com","password":"x"}`)
+	testRequestResponse(t, "/lookup_key/my_lk", url.Values{`key`: {`web`}}, http.StatusNotFound, `404 value not found`)
+	testRequestResponse(t, "/lookup_key/my_lk", url.Values{`key`: {`broken`}}, http.StatusInternalServerError,
+		`broken host`)
+}
+
+func TestLookupKeyHandler_time(t *testing.T) {
+	when := time.Date(2001, 12, 14, 21, 59, 43, 100000000, time.FixedZone(``, -5*3600))
+	register.Clean()
+	register.TypedLookupKey(`my_lk`, func(ctx hiera.ProviderContext, key string) (time.Time, error) {
+		return when, nil
+	})
+	register.StreamingDataHash(`my_sdh`, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) {
+		yield(`when`, vf.Values(vf.Time(when)))
+	})
+	testRequestResponse(t, "/lookup_key/my_lk", url.Values{`key`: {`x`}}, http.StatusOK,
+		`"2001-12-14T21:59:43.1-05:00"`)
+	testRequestResponse(t, "/data_hash/my_sdh", nil, http.StatusOK, `{"when":["2001-12-14T21:59:43.1-05:00"]}`)
+}
+
+func TestDataHashHandler_sensitiveResult(t *testing.T) {
+	register.Clean()
+	register.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		return vf.Map(`user`, `bob`, `password`, vf.Sensitive(`abc`), `a/b`, vf.Values(1, vf.Sensitive(2)))
+	})
+	register.LookupKey(`my_lk`, func(ctx hiera.ProviderContext, key string) dgo.Value {
+		return vf.Sensitive(vf.Values(key))
+	})
+	register.LookupKey(`my_plain`, func(ctx hiera.ProviderContext, key string) dgo.Value {
+		return vf.Values(key)
+	})
+	rr := testRequestResponse(t, "/data_hash/my_dh", nil, http.StatusOK,
+		`{"user":"bob","password":"abc","a/b":[1,2]}`)
+	if h := rr.Header().Get(hiera.SensitiveHeader); h != `["/password","/a~1b/1"]` {
+		t.Errorf(`unexpected sensitive header %s`, h)
+	}
+	rr = testRequestResponse(t, "/lookup_key/my_lk", url.Values{`key`: {`x`}}, http.StatusOK, `["x"]`)
+	if h := rr.Header().Get(hiera.SensitiveHeader); h != `[""]` {
+		t.Errorf(`unexpected sensitive header %s`, h)
+	}
+	rr = testRequestResponse(t, "/lookup_key/my_plain", url.Values{`key`: {`x`}}, http.StatusOK, `["x"]`)
+	if h, ok := rr.Header()[hiera.SensitiveHeader]; ok {
+		t.Errorf(`unexpected sensitive header %s`, h)
+	}
+}
+
+func TestStreamingDataHashHandler(t *testing.T) {
+	register.Clean()
+	register.StreamingDataHash(`my_sdh`, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) {
+		if ctx.Option(`fail`) != nil {
+			panic(fmt.Errorf(`goodbye %s`, ctx.Option(`token`)))
+		}
+		n, _ := ctx.IntOption(`count`)
+		for i := 0; i < n; i++ {
+			if i == 1 {
+				yield(`b`, vf.Sensitive(vf.Values(`x`)))
+			} else {
+				yield(string(rune('a'+i)), vf.Value(i))
+			}
+		}
+		if ctx.Option(`abort`) != nil {
+			panic(`goodbye`)
+		}
+		if ctx.Option(`nan`) != nil {
+			yield(`nan`, vf.Float(math.NaN()))
+		}
+	}, register.WithSensitiveOption(`token`, `string`, ``))
+	register.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value { return nil })
+	rr := testRequestResponse(t, "/data_hash/my_sdh", url.Values{`options`: {`{"count":3}`}}, http.StatusOK,
+		`{"a":0,"b":["x"],"c":2}`)
+	if h := rr.Header().Get(hiera.SensitiveHeader); h != `["/b"]` {
+		t.Errorf(`unexpected sensitive header %s`, h)
+	}
+	testRequestResponse(t, "/data_hash/my_sdh", nil, http.StatusNotFound, `404 value not found`)
+	testRequestResponse(t, "/data_hash/my_sdh", url.Values{`options`: {`{"fail":true,"token":"xyz"}`}},
+		http.StatusInternalServerError, `goodbye [REDACTED]`)
+	err := catch(func() error {
+		testRequestResponse(t, "/data_hash/my_sdh", url.Values{`options`: {`{"count":3,"abort":true}`}}, http.StatusOK, ``)
+		return nil
+	})
+	if err != http.ErrAbortHandler {
+		t.Errorf(`expected abort, got %v`, err)
+	}
+	err = catch(func() error {
+		testRequestResponse(t, "/data_hash/my_sdh", url.Values{`options`: {`{"count":1,"nan":true}`}}, http.StatusOK, ``)
+		return nil
+	})
+	if err != http.ErrAbortHandler {
+		t.Errorf(`expected abort when a value cannot be encoded, got %v`, err)
+	}
+	_, m := Register()
+	if ex := vf.Map(`data_hash`, vf.Values(`my_dh`, `my_sdh`)); !m.Equals(ex) {
+		t.Errorf(`expected %s, got %s`, ex, m)
+	}
+
+	r, _ := http.NewRequest("POST", "/data_hash/my_sdh", nil)
+	rr = httptest.NewRecorder()
+	handler, _ := Register()
+	handler.ServeHTTP(rr, r)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	register.Clean()
+	big := strings.Repeat(`x`, 2*CompressThreshold)
+	register.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		if ctx.Option(`small`) != nil {
+			return vf.Map(`a`, `b`)
+		}
+		return vf.Map(`a`, big)
+	})
+	register.StreamingDataHash(`my_sdh`, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) {
+		yield(`a`, vf.String(big))
+		yield(`b`, vf.Sensitive(`secret`))
+	})
+	handler, _ := Register()
+
+	t.Run(`negotiation`, func(t *testing.T) {
+		expected := `{"a":"` + big + `"}` + "\n"
+		for ae, enc := range map[string]string{
+			``:                        ``,
+			`gzip`:                    `gzip`,
+			`deflate`:                 `deflate`,
+			`deflate, gzip`:           `gzip`,
+			`gzip;q=0.5, deflate`:     `deflate`,
+			`gzip;q=0, deflate;q=0`:   ``,
+			`br, identity`:            ``,
+			`GZIP;q=0.8, deflate;q=1`: `deflate`,
+		} {
+			rr := getEncoded(t, handler, `/data_hash/my_dh`, ae, ``)
+			if e := rr.Header().Get(`Content-Encoding`); e != enc {
+				t.Errorf(`Accept-Encoding %q: expected Content-Encoding %q, got %q`, ae, enc, e)
+			}
+			if body := decodeBody(t, rr); body != expected {
+				t.Errorf(`Accept-Encoding %q: unexpected body %q`, ae, body)
+			}
+		}
+	})
+
+	t.Run(`small`, func(t *testing.T) {
+		rr := getEncoded(t, handler, `/data_hash/my_dh`, `gzip`, `{"small":true}`)
+		if e := rr.Header().Get(`Content-Encoding`); e != `` {
+			t.Errorf(`small response was compressed using %s`, e)
+		}
+		if body := rr.Body.String(); body != `{"a":"b"}`+"\n" {
+			t.Errorf(`unexpected body %q`, body)
+		}
+	})
+
+	t.Run(`stream`, func(t *testing.T) {
+		rr := getEncoded(t, handler, `/data_hash/my_sdh`, `gzip`, ``)
+		if e := rr.Header().Get(`Content-Encoding`); e != `gzip` {
+			t.Errorf(`expected streamed response to be compressed, got %q`, e)
+		}
+		if body := decodeBody(t, rr); body != `{"a":"`+big+`","b":"secret"}`+"\n" {
+			t.Errorf(`unexpected body %q`, body)
+		}
+		if h := rr.Header().Get(hiera.SensitiveHeader); h != `["/b"]` {
+			t.Errorf(`unexpected sensitive trailer %s`, h)
+		}
+	})
+
+	t.Run(`failed write`, func(t *testing.T) {
+		r, _ := http.NewRequest("GET", `/data_hash/my_dh`, nil)
+		r.Header.Set(`Accept-Encoding`, `gzip`)
+		fw := &failingWriter{ResponseRecorder: httptest.NewRecorder()}
+		handler.ServeHTTP(fw, r)
+		// The gzip header is the first write and nothing is written once it has failed
+		if e := fw.Header().Get(`Content-Encoding`); e != `gzip` || len(fw.writes) != 1 {
+			t.Errorf(`expected a single failed gzip write, got %q and %q`, e, fw.writes)
+		}
+	})
+}
+
+// getEncoded performs a GET request with the given Accept-Encoding and options and asserts that it succeeds
+func getEncoded(t *testing.T, handler http.Handler, path, acceptEncoding, options string) *httptest.ResponseRecorder {
+	t.Helper()
+	r, _ := http.NewRequest("GET", path, nil)
+	if options != `` {
+		r.URL.RawQuery = url.Values{`options`: {options}}.Encode()
+	}
+	if acceptEncoding != `` {
+		r.Header.Set(`Accept-Encoding`, acceptEncoding)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if v := rr.Header().Get(`Vary`); v != `Accept-Encoding` {
+		t.Errorf(`unexpected Vary header %q`, v)
+	}
+	return rr
+}
+
+// decodeBody returns the body of the given response, decompressed according to its Content-Encoding
+func decodeBody(t *testing.T, rr *httptest.ResponseRecorder) string {
+	t.Helper()
+	var rd io.Reader
+	var err error
+	switch rr.Header().Get(`Content-Encoding`) {
+	case `gzip`:
+		rd, err = gzip.NewReader(rr.Body)
+	case `deflate`:
+		rd, err = zlib.NewReader(rr.Body)
+	default:
+		rd = rr.Body
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bs)
+}
+
+func TestCompression_streamTrailer(t *testing.T) {
+	register.Clean()
+	big := strings.Repeat(`x`, 2*CompressThreshold)
+	register.StreamingDataHash(`my_sdh`, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) {
+		if ctx.Option(`small`) == nil {
+			yield(`a`, vf.String(big))
+		}
+		yield(`b`, vf.Sensitive(`secret`))
+	})
+	handler, _ := Register()
+	s := httptest.NewServer(handler)
+	defer s.Close()
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	for _, tc := range []struct{ acceptEncoding, options, body string }{
+		{`gzip`, ``, `{"a":"` + big + `","b":"secret"}` + "\n"},
+		{`deflate`, ``, `{"a":"` + big + `","b":"secret"}` + "\n"},
+		{`gzip`, `{"small":true}`, `{"b":"secret"}` + "\n"},
+	} {
+		r, _ := http.NewRequest("GET", s.URL+`/data_hash/my_sdh?`+url.Values{`options`: {tc.options}}.Encode(), nil)
+		r.Header.Set(`Accept-Encoding`, tc.acceptEncoding)
+		resp, err := client.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rd io.Reader = resp.Body
+		switch resp.Header.Get(`Content-Encoding`) {
+		case `gzip`:
+			rd, err = gzip.NewReader(resp.Body)
+		case `deflate`:
+			rd, err = zlib.NewReader(resp.Body)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs, err := ioutil.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The trailer is available once the body has been read to its end
+		_, _ = ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if string(bs) != tc.body {
+			t.Errorf(`%s %s: unexpected body %q`, tc.acceptEncoding, tc.options, bs)
+		}
+		if h := resp.Trailer.Get(hiera.SensitiveHeader); h != `["/b"]` {
+			t.Errorf(`%s %s: unexpected sensitive trailer %q`, tc.acceptEncoding, tc.options, h)
+		}
+	}
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	for accept, ct := range map[string]string{
+		``:                                   `application/json`,
+		`*/*`:                                `application/json`,
+		`application/cbor`:                   `application/cbor`,
+		`application/cbor, */*`:              `application/cbor`,
+		`application/json, application/cbor`: `application/json`,
+		`application/json;q=0.9, application/cbor`:                    `application/cbor`,
+		`application/*, application/cbor;q=0.5`:                       `application/json`,
+		`text/plain`:                                                  `application/json`,
+		`application/vnd.dgo.rich+json`:                               `application/vnd.dgo.rich+json`,
+		`application/vnd.dgo.rich+json;q=0.5, application/cbor;q=0.6`: `application/cbor`,
+	} {
+		if a := negotiateContentType(accept); a != ct {
+			t.Errorf(`Accept %q: expected %s, got %s`, accept, ct, a)
+		}
+	}
+}
+
+func TestCBOR(t *testing.T) {
+	register.Clean()
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	data := vf.Map(`f`, 1.0, `t`, vf.Time(ts), `b`, vf.Binary([]byte{1, 2}, true), `s`, vf.Sensitive(`x`))
+	register.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value { return data })
+	register.StreamingDataHash(`my_sdh`, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) {
+		data.EachEntry(func(e dgo.MapEntry) { yield(e.Key().String(), e.Value()) })
+	})
+	handler, _ := Register()
+	for _, path := range []string{`/data_hash/my_dh`, `/data_hash/my_sdh`} {
+		r, _ := http.NewRequest("GET", path, nil)
+		r.Header.Set(`Accept`, `application/cbor`)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		if ct := rr.Header().Get(`Content-Type`); ct != `application/cbor` {
+			t.Errorf(`unexpected content type %s`, ct)
+		}
+		if h := rr.Header().Get(hiera.SensitiveHeader); h != `["/s"]` {
+			t.Errorf(`unexpected sensitive header %s`, h)
+		}
+		v, err := cbor.Unmarshal(rr.Body.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !data.Equals(v) {
+			t.Errorf(`expected %s, got %s`, data, v)
+		}
+	}
+}
+
+func TestRichJSON(t *testing.T) {
+	register.Clean()
+	data := vf.Map(`t`, vf.Time(time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)), `b`, vf.Binary([]byte{1, 2}, true))
+	register.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value { return data })
+	register.StreamingDataHash(`my_sdh`, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) {
+		data.EachEntry(func(e dgo.MapEntry) { yield(e.Key().String(), e.Value()) })
+	})
+	handler, _ := Register()
+	for _, path := range []string{`/data_hash/my_dh`, `/data_hash/my_sdh`} {
+		r, _ := http.NewRequest("GET", path, nil)
+		r.Header.Set(`Accept`, richjson.ContentType)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		if ct := rr.Header().Get(`Content-Type`); ct != richjson.ContentType {
+			t.Errorf(`unexpected content type %s`, ct)
+		}
+		expected := `{"t":{"__type":"time","__value":"2020-01-02T03:04:05.000000006Z"},` +
+			`"b":{"__type":"binary","__value":"AQI="}}` + "\n"
+		if body := rr.Body.String(); body != expected {
+			t.Errorf(`expected %s, got %s`, expected, body)
+		}
+	}
+}
+
+func TestDataHashHandler_marshalError(t *testing.T) {
+	register.Clean()
+	register.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value { return vf.Map(`f`, math.NaN()) })
+	testRequestResponse(t, "/data_hash/my_dh", nil, http.StatusInternalServerError,
+		`json: error calling MarshalJSON for type *internal.hashMap: invalid character 'N' looking for beginning of value`)
+}
+
+func TestConditionalRequests(t *testing.T) {
+	register.Clean()
+	produced := 0
+	register.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value {
+		v, _ := ctx.StringOption(`version`)
+		if ctx.SetVersion(v) {
+			return nil
+		}
+		produced++
+		return vf.Map(`version`, v)
+	})
+	register.StreamingDataHash(`my_sdh`, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) {
+		v, _ := ctx.StringOption(`version`)
+		if ctx.SetVersion(v) {
+			return
+		}
+		produced++
+		yield(`version`, vf.String(v))
+	})
+	register.StreamingDataHash(`my_sdh2`, func(ctx hiera.ProviderContext, yield func(string, dgo.Value)) {
+		// Ignores the result of SetVersion
+		v, _ := ctx.StringOption(`version`)
+		ctx.SetVersion(v)
+		produced++
+		yield(`version`, vf.String(v))
+		yield(`name`, vf.String(`my_sdh2`))
+	})
+	handler, _ := Register()
+
+	for _, tc := range []struct {
+		path     string
+		produced int
+	}{
+		{`/data_hash/my_dh`, 3},
+		{`/data_hash/my_sdh`, 3},
+		// The value is produced for the 304 response too since the function ignores the result of SetVersion
+		{`/data_hash/my_sdh2`, 4},
+	} {
+		path := tc.path
+		produced = 0
+		rr := getVersion(handler, path, `1`, ``, ``)
+		et := rr.Header().Get(`ETag`)
+		if rr.Code != http.StatusOK || !strings.HasPrefix(et, `W/"`) {
+			t.Fatalf(`%s: expected 200 with an ETag, got %d %q`, path, rr.Code, et)
+		}
+
+		rr = getVersion(handler, path, `1`, et, ``)
+		if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 || rr.Header().Get(`ETag`) != et {
+			t.Errorf(`%s: expected 304 with ETag %s, got %d %q`, path, et, rr.Code, rr.Header().Get(`ETag`))
+		}
+
+		rr = getVersion(handler, path, `2`, et, ``)
+		if rr.Code != http.StatusOK || rr.Header().Get(`ETag`) == et {
+			t.Errorf(`%s: expected 200 with a new ETag, got %d`, path, rr.Code)
+		}
+
+		rr = getVersion(handler, path, `1`, et, `application/cbor`)
+		if rr.Code != http.StatusOK || rr.Header().Get(`ETag`) == et {
+			t.Errorf(`%s: expected 200 with an ETag for the CBOR encoding, got %d`, path, rr.Code)
+		}
+
+		if produced != tc.produced {
+			t.Errorf(`%s: expected value to be produced %d times, got %d`, path, tc.produced, produced)
+		}
+	}
+}
+
+// getVersion performs a GET request with the given version option and If-None-Match and Accept headers
+func getVersion(handler http.Handler, path, version, ifNoneMatch, accept string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("GET", path, nil)
+	r.URL.RawQuery = url.Values{`options`: {`{"version":"` + version + `"}`}}.Encode()
+	if ifNoneMatch != `` {
+		r.Header.Set(`If-None-Match`, ifNoneMatch)
+	}
+	if accept != `` {
+		r.Header.Set(`Accept`, accept)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+	return rr
+}
+
+func TestEtagMatches(t *testing.T) {
+	et := etag(`1`, `application/json`)
+	for inm, match := range map[string]bool{
+		``:                            false,
+		`*`:                           true,
+		et:                            true,
+		et[2:]:                        true,
+		`"x", ` + et:                  true,
+		`"x", W/"y"`:                  false,
+		etag(`1`, `application/cbor`): false,
+	} {
+		if etagMatches(inm, et) != match {
+			t.Errorf(`If-None-Match %q: expected match to be %t`, inm, match)
+		}
+	}
+}
+
 func TestDataHashHandler_post(t *testing.T) {
 	register.Clean()
 	register.DataHash(`my_dh`, func(ctx hiera.ProviderContext) dgo.Value {
@@ -123,7 +680,8 @@ func TestDataHashHandler_post(t *testing.T) {
 	}
 }
 
-func testRequestResponse(t *testing.T, path string, query url.Values, expectedStatus int, expectedBody string) {
+func testRequestResponse(t *testing.T, path string, query url.Values, expectedStatus int,
+	expectedBody string) *httptest.ResponseRecorder {
 	t.Helper()
 	r, err := http.NewRequest("GET", path, nil)
 	if err != nil {
@@ -155,4 +713,5 @@ func testRequestResponse(t *testing.T, path string, query url.Values, expectedSt
 	if body != expectedBody {
 		t.Errorf("handler returned unexpected body: got %s want %s", body, expectedBody)
 	}
+	return rr
 }
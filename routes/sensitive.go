@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/hiera"
+)
+
+// Redacted replaces the values of sensitive options in error messages
+const Redacted = `[REDACTED]`
+
+// redact replaces all occurrences of the string values found in the given options in the given message with
+// Redacted. Strings nested in arrays and maps are also considered. Numbers and booleans are not redacted since
+// their text, e.g. "1" or "true", is likely to also appear in unrelated parts of the message.
+func redact(msg string, q url.Values, options []string) string {
+	if len(options) == 0 {
+		return msg
+	}
+	om, ok := parseOptions(q).(dgo.Map)
+	if !ok {
+		return msg
+	}
+	var secrets []string
+	var collect func(v dgo.Value)
+	collect = func(v dgo.Value) {
+		switch v := v.(type) {
+		case dgo.String:
+			if s := v.GoString(); s != `` {
+				secrets = append(secrets, s)
+			}
+		case dgo.Array:
+			v.Each(collect)
+		case dgo.Map:
+			v.EachValue(collect)
+		}
+	}
+	for _, o := range options {
+		collect(om.Get(o))
+	}
+	for _, s := range secrets {
+		msg = strings.Replace(msg, s, Redacted, -1)
+	}
+	return msg
+}
+
+func parseOptions(q url.Values) dgo.Value {
+	if jo := q.Get(`options`); jo != `` {
+		if v, err := vf.UnmarshalJSON([]byte(jo)); err == nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// plainData returns the given value in a form that encodes as plain JSON, together with the JSON pointers to the
+// values that were sensitive. All dgo.Sensitive values are replaced by the values that they wrap and all dgo.Time
+// values by RFC 3339 strings.
+func plainData(v dgo.Value) (dgo.Value, []string) {
+	var pointers []string
+	var unwrap func(v dgo.Value, pointer string) dgo.Value
+	unwrap = func(v dgo.Value, pointer string) dgo.Value {
+		switch c := v.(type) {
+		case dgo.Sensitive:
+			pointers = append(pointers, pointer)
+			return unwrap(c.Unwrap(), pointer)
+		case dgo.Time:
+			return vf.String(c.GoTime().Format(time.RFC3339Nano))
+		case dgo.Array:
+			changed := false
+			vs := make([]dgo.Value, c.Len())
+			c.EachWithIndex(func(e dgo.Value, i int) {
+				vs[i] = unwrap(e, pointer+`/`+strconv.Itoa(i))
+				if vs[i] != e {
+					changed = true
+				}
+			})
+			if changed {
+				return vf.Array(vs)
+			}
+		case dgo.Map:
+			changed := false
+			m := c.Map(func(e dgo.MapEntry) interface{} {
+				u := unwrap(e.Value(), pointer+`/`+escapePointer(e.Key().String()))
+				if u != e.Value() {
+					changed = true
+				}
+				return u
+			})
+			if changed {
+				return m
+			}
+		}
+		return v
+	}
+	v = unwrap(v, ``)
+	return v, pointers
+}
+
+func escapePointer(s string) string {
+	return strings.Replace(strings.Replace(s, `~`, `~0`, -1), `/`, `~1`, -1)
+}
+
+func flagSensitive(h http.Header, pointers []string) {
+	if len(pointers) > 0 {
+		js, _ := json.Marshal(pointers)
+		h.Set(hiera.SensitiveHeader, string(js))
+	}
+}
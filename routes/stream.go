@@ -0,0 +1,147 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lyraproj/dgo/dgo"
+	"github.com/lyraproj/dgo/vf"
+	"github.com/lyraproj/hierasdk/cbor"
+	"github.com/lyraproj/hierasdk/hiera"
+	"github.com/lyraproj/hierasdk/richjson"
+)
+
+// handleStream calls the given StreamingDataHash and writes each yielded entry to the response as soon as it is
+// produced. The response is a JSON object, or a CBOR map of indefinite length when the request prefers CBOR, that
+// is sent using chunked transfer encoding. Sensitive values are flagged in a hiera.SensitiveHeader trailer since they
+// are not known until the last entry has been produced.
+//
+// An error that occurs before the first entry has been written results in a 500 response. An error that occurs
+// after that point aborts the response so that the client sees an incomplete map.
+func handleStream(w http.ResponseWriter, r *http.Request, f hiera.StreamingDataHash, sensitiveOptions []string,
+	n hiera.Notifier) {
+	if r.Method != http.MethodGet {
+		http.Error(w, ``, http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	cw := compress(w, r)
+	ct := negotiateContentType(r.Header.Get(`Accept`))
+	s := &streamWriter{w: cw, r: r, contentType: ct}
+	switch ct {
+	case cbor.ContentType:
+		s.cbor = cbor.NewEncoder(cw)
+	case richjson.ContentType:
+		s.rich = true
+	}
+	err := catch(func() error {
+		s.ctx = newContext(r, q, ct, n)
+		f(s.ctx, s.yield)
+		switch {
+		case s.notModified || !s.started && checkVersion(cw, r, s.ctx, ct):
+			cw.WriteHeader(http.StatusNotModified)
+		case !s.started:
+			http.Error(cw, `404 value not found`, http.StatusNotFound)
+		default:
+			s.finish()
+			// The compressor must be flushed and closed before the trailer is set since the trailer is sent right
+			// after the body that has been written so far
+			s.check(cw.close())
+			flagSensitive(cw.Header(), s.sensitive)
+		}
+		return nil
+	})
+	if err != nil {
+		if s.started {
+			panic(http.ErrAbortHandler)
+		}
+		http.Error(cw, redact(err.Error(), q, sensitiveOptions), errorStatus(err))
+	}
+	_ = cw.close()
+}
+
+// streamWriter writes the entries of a map to the response. The map is written as a JSON object or, when cbor is
+// set, as a CBOR map of indefinite length. The values of the JSON object are rich JSON when rich is set. All entries
+// are ignored when the version that the function declared before yielding its first entry matches the request.
+type streamWriter struct {
+	w           http.ResponseWriter
+	r           *http.Request
+	ctx         hiera.ProviderContext
+	contentType string
+	cbor        *cbor.Encoder
+	rich        bool
+	started     bool
+	notModified bool
+	sensitive   []string
+}
+
+func (s *streamWriter) yield(key string, value dgo.Value) {
+	if s.notModified {
+		return
+	}
+	if !s.started {
+		if checkVersion(s.w, s.r, s.ctx, s.contentType) {
+			s.notModified = true
+			return
+		}
+		h := s.w.Header()
+		h.Set(`Trailer`, hiera.SensitiveHeader)
+		if s.cbor != nil {
+			h.Set(`Content-Type`, cbor.ContentType)
+			s.check(s.cbor.StartMap())
+		} else {
+			if s.rich {
+				h.Set(`Content-Type`, richjson.ContentType)
+			} else {
+				h.Set(`Content-Type`, `application/json`)
+			}
+			s.write([]byte{'{'})
+		}
+		s.started = true
+	} else if s.cbor == nil {
+		s.write([]byte{','})
+	}
+	uv, sensitive := plainData(value)
+	for _, p := range sensitive {
+		s.sensitive = append(s.sensitive, `/`+escapePointer(key)+p)
+	}
+	if s.cbor != nil {
+		s.check(s.cbor.Encode(vf.String(key)))
+		s.check(s.cbor.Encode(value))
+		return
+	}
+	s.encode(key)
+	s.write([]byte{':'})
+	if s.rich {
+		bs, err := richjson.Marshal(value)
+		s.check(err)
+		s.write(bs)
+	} else {
+		s.encode(uv)
+	}
+}
+
+func (s *streamWriter) encode(v interface{}) {
+	bs, err := json.Marshal(v)
+	s.check(err)
+	s.write(bs)
+}
+
+func (s *streamWriter) check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (s *streamWriter) write(bs []byte) {
+	_, err := s.w.Write(bs)
+	s.check(err)
+}
+
+func (s *streamWriter) finish() {
+	if s.cbor != nil {
+		s.check(s.cbor.End())
+	} else {
+		s.write([]byte("}\n"))
+	}
+}